@@ -0,0 +1,8 @@
+{{- define "web.fullname" -}}
+{{- printf "%s-%s" .Release.Name .Chart.Name | trunc 63 | trimSuffix "-" -}}
+{{- end -}}
+
+{{- define "web.labels" -}}
+app: {{ include "web.fullname" . }}
+chart: {{ .Chart.Name }}-{{ .Chart.Version }}
+{{- end -}}
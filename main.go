@@ -6,8 +6,10 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
 	"syscall"
+	"time"
 
 	"github.com/urcomputeringpal/kubevalidator/validator"
 )
@@ -35,18 +37,69 @@ func runWithContext(ctx context.Context) error {
 		return errors.New("PRIVATE_KEY_FILE required")
 	}
 
+	// Optional directory of JSON schemas to use instead of fetching them over
+	// the network
+	var schemaDir string
+	if dir, ok := os.LookupEnv("SCHEMA_DIR"); ok {
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		schemaDir = absDir
+	}
+
+	// Optional directory in which to cache schemas fetched over the network
+	var schemaCache *validator.SchemaCache
+	if dir, ok := os.LookupEnv("SCHEMA_CACHE_DIR"); ok {
+		ttl := 24 * time.Hour
+		if ttlString, ok := os.LookupEnv("SCHEMA_CACHE_TTL"); ok {
+			parsedTTL, err := time.ParseDuration(ttlString)
+			if err != nil {
+				return errors.New("SCHEMA_CACHE_TTL must be a duration like 24h")
+			}
+			ttl = parsedTTL
+		}
+		maxBytes := int64(256 * 1024 * 1024)
+		if maxBytesString, ok := os.LookupEnv("SCHEMA_CACHE_MAX_BYTES"); ok {
+			parsedMaxBytes, err := strconv.ParseInt(maxBytesString, 10, 64)
+			if err != nil {
+				return errors.New("SCHEMA_CACHE_MAX_BYTES must be an integer")
+			}
+			maxBytes = parsedMaxBytes
+		}
+		cache, err := validator.NewSchemaCache(dir, ttl, maxBytes)
+		if err != nil {
+			return err
+		}
+		schemaCache = cache
+	}
+
+	// Files which haven't changed are cached in memory by the SHA of their
+	// blob
+	blobCacheMaxBytes := int64(64 * 1024 * 1024)
+	if maxBytesString, ok := os.LookupEnv("BLOB_CACHE_MAX_BYTES"); ok {
+		parsedMaxBytes, err := strconv.ParseInt(maxBytesString, 10, 64)
+		if err != nil {
+			return errors.New("BLOB_CACHE_MAX_BYTES must be an integer")
+		}
+		blobCacheMaxBytes = parsedMaxBytes
+	}
+
 	v := &validator.Server{
 		Port:           portInt,
 		WebhookSecret:  webhookSecret,
 		AppID:          appIDInt,
 		PrivateKeyFile: privateKeyFile,
+		SchemaDir:      schemaDir,
+		SchemaCache:    schemaCache,
+		BlobCache:      validator.NewBlobCache(blobCacheMaxBytes),
 	}
 
 	return v.Run(ctx)
 }
 
 func cancelOnInterrupt(ctx context.Context, f context.CancelFunc) {
-	term := make(chan os.Signal)
+	term := make(chan os.Signal, 1)
 	signal.Notify(term, os.Interrupt, syscall.SIGTERM)
 
 	for {
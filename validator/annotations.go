@@ -2,10 +2,21 @@ package validator
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/google/go-github/github"
 )
 
+// annotationLevels ranks the levels of annotations, and never, which is
+// higher than all of them
+var annotationLevels = map[string]int{
+	"notice":  1,
+	"warning": 2,
+	"failure": 3,
+	"never":   4,
+}
+
 // Annotations is an array of pointers to CheckRunAnnotations
 type Annotations []*github.CheckRunAnnotation
 
@@ -20,3 +31,164 @@ func (a Annotations) Less(i, j int) bool {
 	two := fmt.Sprintf("%d:%s", a[j].GetStartLine(), a[j].GetMessage())
 	return one < two
 }
+
+// countLevel returns the number of annotations with the given level
+func (a Annotations) countLevel(level string) int {
+	count := 0
+	for _, annotation := range a {
+		if annotation.GetAnnotationLevel() == level {
+			count++
+		}
+	}
+	return count
+}
+
+// conclusion returns the conclusion of a check run with these annotations.
+// Annotations at or above failOn fail it, and failures which don't fail it
+// make it neutral.
+func (a Annotations) conclusion(failOn string) string {
+	neutral := false
+	for _, annotation := range a {
+		level := annotation.GetAnnotationLevel()
+		if annotationLevels[level] >= annotationLevels[failOn] {
+			return "failure"
+		}
+		if level == "failure" {
+			neutral = true
+		}
+	}
+	if neutral {
+		return "neutral"
+	}
+	return "success"
+}
+
+// batches splits the annotations into batches of at most size annotations.
+// There's always at least one batch, even if it's empty.
+func (a Annotations) batches(size int) []Annotations {
+	batches := []Annotations{}
+	for start := 0; start < len(a); start += size {
+		end := start + size
+		if end > len(a) {
+			end = len(a)
+		}
+		batches = append(batches, a[start:end])
+	}
+	if len(batches) == 0 {
+		batches = append(batches, nil)
+	}
+	return batches
+}
+
+// truncate returns the first max annotations and the rest, preferring those
+// with higher levels and otherwise preserving their order
+func (a Annotations) truncate(max int) (Annotations, Annotations) {
+	if len(a) <= max {
+		return a, nil
+	}
+	prioritized := make(Annotations, len(a))
+	copy(prioritized, a)
+	sort.SliceStable(prioritized, func(i, j int) bool {
+		return annotationLevels[prioritized[i].GetAnnotationLevel()] > annotationLevels[prioritized[j].GetAnnotationLevel()]
+	})
+	return prioritized[:max], prioritized[max:]
+}
+
+// overflowReport lists annotations which couldn't be written to a check run
+// in Markdown, truncated to fit in the text of a check run
+func (a Annotations) overflowReport() string {
+	var report strings.Builder
+	report.WriteString("### Annotations not shown\n\n")
+	for i, annotation := range a {
+		line := fmt.Sprintf("* `%s:%d` **%s** %s: %s\n", annotation.GetPath(), annotation.GetStartLine(), annotation.GetAnnotationLevel(), annotation.GetTitle(), annotation.GetMessage())
+		more := fmt.Sprintf("* ...and %d more\n", len(a)-i)
+		if report.Len()+len(line)+len(more) > maxTextLength {
+			report.WriteString(more)
+			break
+		}
+		report.WriteString(line)
+	}
+	return report.String()
+}
+
+// onChangedLines splits the annotations into those on the lines added or
+// changed by the patches of the changed files and the rest. Annotations of the configuration,
+// and of changed files which GitHub didn't include a patch for, are kept.
+func (a Annotations) onChangedLines(changedFiles []*github.CommitFile) (Annotations, Annotations) {
+	patches := make(map[string]string)
+	for _, file := range changedFiles {
+		patches[file.GetFilename()] = file.GetPatch()
+	}
+
+	var changed, unchanged Annotations
+	for _, annotation := range a {
+		patch, ok := patches[annotation.GetPath()]
+		if annotation.GetPath() == configPath || (ok && patch == "") {
+			changed = append(changed, annotation)
+			continue
+		}
+		start := annotation.GetStartLine()
+		end := annotation.GetEndLine()
+		if end < start {
+			end = start
+		}
+		inHunk := false
+		for _, r := range hunkRanges(patch) {
+			if start <= r.End && end >= r.Start {
+				inHunk = true
+				break
+			}
+		}
+		if inHunk {
+			changed = append(changed, annotation)
+		} else {
+			unchanged = append(unchanged, annotation)
+		}
+	}
+	return changed, unchanged
+}
+
+// unreportedSummary describes annotations which weren't reported because they
+// were found on lines that haven't changed, counting those in files which
+// haven't changed at all separately
+func (a Annotations) unreportedSummary(changedFiles []*github.CommitFile) string {
+	changed := changedFileSet(changedFiles)
+	var onUnchangedLines, inUnchangedFiles Annotations
+	for _, annotation := range a {
+		if changed[annotation.GetPath()] {
+			onUnchangedLines = append(onUnchangedLines, annotation)
+		} else {
+			inUnchangedFiles = append(inUnchangedFiles, annotation)
+		}
+	}
+
+	var found []string
+	if counts := onUnchangedLines.levelCounts(); counts != "" {
+		found = append(found, fmt.Sprintf("%s found on unchanged lines", counts))
+	}
+	if counts := inUnchangedFiles.levelCounts(); counts != "" {
+		found = append(found, fmt.Sprintf("%s found in unchanged files", counts))
+	}
+	if len(found) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s weren't reported.", strings.Join(found, " and "))
+}
+
+// levelCounts counts the annotations at each level, like "2 errors, 1 notice"
+func (a Annotations) levelCounts() string {
+	var counts []string
+	for _, level := range []struct{ level, singular, plural string }{
+		{"failure", "error", "errors"},
+		{"warning", "warning", "warnings"},
+		{"notice", "notice", "notices"},
+	} {
+		count := a.countLevel(level.level)
+		if count == 1 {
+			counts = append(counts, fmt.Sprintf("1 %s", level.singular))
+		} else if count > 1 {
+			counts = append(counts, fmt.Sprintf("%d %s", count, level.plural))
+		}
+	}
+	return strings.Join(counts, ", ")
+}
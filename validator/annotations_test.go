@@ -0,0 +1,158 @@
+package validator
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/google/go-github/github"
+)
+
+func TestConclusion(t *testing.T) {
+	annotations := func(levels ...string) Annotations {
+		var a Annotations
+		for _, level := range levels {
+			a = append(a, &github.CheckRunAnnotation{AnnotationLevel: github.String(level)})
+		}
+		return a
+	}
+	tests := []struct {
+		annotations Annotations
+		failOn      string
+		want        string
+	}{
+		{annotations(), "failure", "success"},
+		{annotations("notice", "warning"), "failure", "success"},
+		{annotations("warning", "failure"), "failure", "failure"},
+		{annotations("notice", "warning"), "warning", "failure"},
+		{annotations("notice"), "warning", "success"},
+		{annotations("notice"), "notice", "failure"},
+		{annotations("warning", "failure"), "never", "neutral"},
+		{annotations("warning"), "never", "success"},
+	}
+	for _, test := range tests {
+		if conclusion := test.annotations.conclusion(test.failOn); conclusion != test.want {
+			t.Errorf("failOn %s with %d annotations: expected %s, got %s", test.failOn, len(test.annotations), test.want, conclusion)
+		}
+	}
+}
+
+func TestBatches(t *testing.T) {
+	annotations := make(Annotations, 120)
+	var sizes []int
+	for _, batch := range annotations.batches(annotationsPerRequest) {
+		sizes = append(sizes, len(batch))
+	}
+	if fmt.Sprint(sizes) != "[50 50 20]" {
+		t.Errorf("expected batches of [50 50 20], got %v", sizes)
+	}
+	if batches := Annotations(nil).batches(annotationsPerRequest); len(batches) != 1 || len(batches[0]) != 0 {
+		t.Errorf("expected a single empty batch, got %v", batches)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	var annotations Annotations
+	for i, level := range []string{"notice", "failure", "warning", "failure"} {
+		annotations = append(annotations, &github.CheckRunAnnotation{
+			StartLine:       github.Int(i + 1),
+			AnnotationLevel: github.String(level),
+		})
+	}
+	kept, overflow := annotations.truncate(2)
+	if len(kept) != 2 || kept[0].GetStartLine() != 2 || kept[1].GetStartLine() != 4 {
+		t.Errorf("expected the failures to be kept, got %v", kept)
+	}
+	if len(overflow) != 2 || overflow[0].GetStartLine() != 3 || overflow[1].GetStartLine() != 1 {
+		t.Errorf("expected the warning and notice to overflow, got %v", overflow)
+	}
+	if kept, overflow := annotations.truncate(4); len(kept) != 4 || overflow != nil {
+		t.Errorf("expected nothing to overflow, got %v", overflow)
+	}
+}
+
+func TestOverflowReport(t *testing.T) {
+	annotations := Annotations{{
+		Path:            github.String("a.yaml"),
+		StartLine:       github.Int(3),
+		AnnotationLevel: github.String("failure"),
+		Title:           github.String("Invalid Deployment a"),
+		Message:         github.String("replicas: Invalid type"),
+	}}
+	want := "### Annotations not shown\n\n* `a.yaml:3` **failure** Invalid Deployment a: replicas: Invalid type\n"
+	if report := annotations.overflowReport(); report != want {
+		t.Errorf("expected %q, got %q", want, report)
+	}
+
+	for i := 0; i < 2000; i++ {
+		annotations = append(annotations, annotations[0])
+	}
+	report := annotations.overflowReport()
+	if len(report) > maxTextLength {
+		t.Errorf("expected the report to fit in %d characters, got %d", maxTextLength, len(report))
+	}
+	if !strings.HasSuffix(report, " more\n") {
+		t.Errorf("expected the report to count the annotations left out, got %q", report[len(report)-100:])
+	}
+}
+
+func TestOnChangedLines(t *testing.T) {
+	annotation := func(path string, start int, end int) *github.CheckRunAnnotation {
+		return &github.CheckRunAnnotation{
+			Path:            github.String(path),
+			StartLine:       github.Int(start),
+			EndLine:         github.Int(end),
+			AnnotationLevel: github.String("failure"),
+		}
+	}
+	changedFiles := []*github.CommitFile{
+		{Filename: github.String("a.yaml"), Patch: github.String("@@ -8,2 +8,3 @@\n a\n+b\n c")},
+		{Filename: github.String("large.yaml")},
+	}
+	annotations := Annotations{
+		annotation("a.yaml", 1, 1),
+		annotation("a.yaml", 9, 9),
+		annotation("a.yaml", 5, 8),
+		annotation("a.yaml", 11, 12),
+		annotation("large.yaml", 100, 100),
+		annotation("unchanged.yaml", 1, 1),
+		annotation(configPath, 1, 1),
+	}
+	locations := func(a Annotations) []string {
+		var locations []string
+		for _, annotation := range a {
+			locations = append(locations, fmt.Sprintf("%s:%d", annotation.GetPath(), annotation.GetStartLine()))
+		}
+		return locations
+	}
+
+	changed, unchanged := annotations.onChangedLines(changedFiles)
+	if diff := deep.Equal(locations(changed), []string{"a.yaml:9", "large.yaml:100", configPath + ":1"}); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(locations(unchanged), []string{"a.yaml:1", "a.yaml:5", "a.yaml:11", "unchanged.yaml:1"}); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestUnreportedSummary(t *testing.T) {
+	var annotations Annotations
+	for _, level := range []string{"failure", "notice", "failure", "notice", "warning"} {
+		annotations = append(annotations, &github.CheckRunAnnotation{Path: github.String("a.yaml"), AnnotationLevel: github.String(level)})
+	}
+	changedFiles := []*github.CommitFile{{Filename: github.String("a.yaml")}}
+	want := "2 errors, 1 warning, 2 notices found on unchanged lines weren't reported."
+	if summary := annotations.unreportedSummary(changedFiles); summary != want {
+		t.Errorf("expected %q, got %q", want, summary)
+	}
+
+	annotations = append(annotations, &github.CheckRunAnnotation{Path: github.String("unchanged.yaml"), AnnotationLevel: github.String("failure")})
+	want = "2 errors, 1 warning, 2 notices found on unchanged lines and 1 error found in unchanged files weren't reported."
+	if summary := annotations.unreportedSummary(changedFiles); summary != want {
+		t.Errorf("expected %q, got %q", want, summary)
+	}
+	if summary := Annotations(nil).unreportedSummary(changedFiles); summary != "" {
+		t.Errorf("expected no summary, got %q", summary)
+	}
+}
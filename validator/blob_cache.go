@@ -0,0 +1,115 @@
+package validator
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/google/go-github/github"
+)
+
+// BlobCache keeps the contents of files in memory by the SHA of their blob,
+// which only changes when their contents do, so that files which aren't being
+// changed are fetched from GitHub once rather than on every check suite.
+type BlobCache struct {
+	// MaxBytes bounds the size of the cached blobs. The least recently used
+	// blobs are evicted first. Zero means unbounded.
+	MaxBytes int64
+
+	mu    sync.Mutex
+	blobs map[string]*list.Element
+	order *list.List
+	size  int64
+}
+
+// blobCacheEntry is a single cached blob
+type blobCacheEntry struct {
+	sha string
+	b   []byte
+}
+
+// NewBlobCache initializes a BlobCache
+func NewBlobCache(maxBytes int64) *BlobCache {
+	return &BlobCache{
+		MaxBytes: maxBytes,
+	}
+}
+
+// Get returns the contents of the blob with sha if they're cached
+func (bc *BlobCache) Get(sha string) ([]byte, bool) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	element, ok := bc.blobs[sha]
+	if !ok {
+		return nil, false
+	}
+	bc.order.MoveToFront(element)
+	return element.Value.(*blobCacheEntry).b, true
+}
+
+// Add caches the contents of the blob with sha, evicting the least recently
+// used blobs to stay within MaxBytes
+func (bc *BlobCache) Add(sha string, b []byte) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	if bc.blobs == nil {
+		bc.blobs = make(map[string]*list.Element)
+		bc.order = list.New()
+	}
+	if _, ok := bc.blobs[sha]; ok {
+		return
+	}
+	if bc.MaxBytes > 0 && int64(len(b)) > bc.MaxBytes {
+		return
+	}
+	bc.blobs[sha] = bc.order.PushFront(&blobCacheEntry{sha: sha, b: b})
+	bc.size += int64(len(b))
+	for bc.MaxBytes > 0 && bc.size > bc.MaxBytes {
+		oldest := bc.order.Back()
+		entry := oldest.Value.(*blobCacheEntry)
+		bc.order.Remove(oldest)
+		delete(bc.blobs, entry.sha)
+		bc.size -= int64(len(entry.b))
+	}
+}
+
+// bytesForFile loads the contents of file at the head of the check suite,
+// using the blob cache when the SHA of its blob is known
+func (c *Context) bytesForFile(e *github.CheckSuiteEvent, file *github.CommitFile) (*[]byte, error) {
+	sha := file.GetSHA()
+	if c.BlobCache != nil && sha != "" {
+		if b, ok := c.BlobCache.Get(sha); ok {
+			return &b, nil
+		}
+	}
+	b, err := c.bytesForFilename(e, file.GetFilename())
+	if err != nil {
+		return nil, err
+	}
+	if c.BlobCache != nil && sha != "" {
+		c.BlobCache.Add(sha, *b)
+	}
+	return b, nil
+}
+
+// maxConcurrentLoads is the most files loaded from GitHub at once
+const maxConcurrentLoads = 8
+
+// loadFiles loads the contents of files concurrently, returning them in the
+// same order as files along with the error encountered loading each of them
+func (c *Context) loadFiles(e *github.CheckSuiteEvent, files []*github.CommitFile) ([]*[]byte, []error) {
+	contents := make([]*[]byte, len(files))
+	errs := make([]error, len(files))
+	semaphore := make(chan struct{}, maxConcurrentLoads)
+	var wg sync.WaitGroup
+	for i, file := range files {
+		wg.Add(1)
+		go func(i int, file *github.CommitFile) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			contents[i], errs[i] = c.bytesForFile(e, file)
+		}(i, file)
+	}
+	wg.Wait()
+	return contents, errs
+}
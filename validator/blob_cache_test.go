@@ -0,0 +1,28 @@
+package validator
+
+import "testing"
+
+func TestBlobCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewBlobCache(10)
+	cache.Add("a", []byte("aaaa"))
+	cache.Add("b", []byte("bbbb"))
+	// Using a makes b the least recently used
+	if b, ok := cache.Get("a"); !ok || string(b) != "aaaa" {
+		t.Fatalf("expected a to be cached, got %q", b)
+	}
+	cache.Add("c", []byte("cccc"))
+
+	if _, ok := cache.Get("b"); ok {
+		t.Error("expected b to be evicted")
+	}
+	for _, sha := range []string{"a", "c"} {
+		if _, ok := cache.Get(sha); !ok {
+			t.Errorf("expected %s to be cached", sha)
+		}
+	}
+
+	cache.Add("d", []byte("too large to cache"))
+	if _, ok := cache.Get("d"); ok {
+		t.Error("expected blobs larger than the cache not to be cached")
+	}
+}
@@ -1,19 +1,14 @@
 package validator
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
 	"sort"
 	"strings"
 
 	"github.com/google/go-github/github"
-	multierror "github.com/hashicorp/go-multierror"
-	"github.com/instrumenta/kubeval/kubeval"
-	yamlpatch "github.com/krishicks/yaml-patch"
-	difflib "github.com/pmezard/go-difflib/difflib"
 	"github.com/xeipuuv/gojsonschema"
-	"sourcegraph.com/sourcegraph/go-diff/diff"
+	yaml "gopkg.in/yaml.v2"
 )
 
 // Candidate reprensets a file to be validated
@@ -22,11 +17,12 @@ type Candidate struct {
 	context *Context
 	file    *github.CommitFile
 	schemas []*KubeValidatorConfigSchema
-}
+	rows    []*resourceRow
+	fixes   []fix
 
-const (
-	placeholderString = "AAA___KUBEVALIDATOR___PLACEHOLDER___AAA"
-)
+	// rendered is set when bytes were rendered from file rather than loaded
+	rendered *renderedSource
+}
 
 var (
 	defaultSchema = &KubeValidatorConfigSchema{
@@ -34,12 +30,22 @@ var (
 		SchemaFork: "garethr",
 		ConfigType: "kubernetes",
 	}
+	// defaultLocalSchema is used instead of defaultSchema when this instance
+	// has been configured with a schema directory
+	defaultLocalSchema = &KubeValidatorConfigSchema{
+		Version:    "master",
+		ConfigType: "kubernetes",
+	}
 )
 
 // NewCandidate initializes a validation Candidate
 func NewCandidate(context *Context, file *github.CommitFile, schemas []*KubeValidatorConfigSchema) *Candidate {
 	if len(schemas) == 0 {
-		schemas = append(schemas, defaultSchema)
+		if context.SchemaDir != "" {
+			schemas = append(schemas, defaultLocalSchema)
+		} else {
+			schemas = append(schemas, defaultSchema)
+		}
 	}
 	return &Candidate{
 		context: context,
@@ -52,125 +58,167 @@ func (c *Candidate) setBytes(b *[]byte) {
 	c.bytes = b
 }
 
-// LoadBytes hydrates bytes from GitHub and returns a CheckRunAnnotation if
-// an error is encountered
+// LoadBytes hydrates bytes from GitHub, through the blob cache, and returns a
+// CheckRunAnnotation if an error is encountered
 func (c *Candidate) LoadBytes() *github.CheckRunAnnotation {
-	b, err := c.context.bytesForFilename(c.context.Event.(*github.CheckSuiteEvent), c.file.GetFilename())
+	// Rendered candidates already have their bytes
+	if c.rendered != nil {
+		return nil
+	}
+	b, err := c.context.bytesForFile(c.context.Event.(*github.CheckSuiteEvent), c.file)
 	if err != nil {
-		return &github.CheckRunAnnotation{
-			Path:            c.file.Filename,
-			BlobHRef:        c.file.BlobURL,
-			StartLine:       github.Int(1),
-			EndLine:         github.Int(1),
-			AnnotationLevel: github.String("failure"),
-			Title:           github.String(fmt.Sprintf("Error loading %s", c.file.GetFilename())),
-			Message:         github.String(fmt.Sprintf("%+v", err)),
-		}
+		return c.loadErrorAnnotation(err)
 	}
 
 	c.bytes = b
 	return nil
 }
 
+// loadErrorAnnotation reports an error encountered loading the Candidate
+func (c *Candidate) loadErrorAnnotation(err error) *github.CheckRunAnnotation {
+	return &github.CheckRunAnnotation{
+		Path:            c.file.Filename,
+		BlobHRef:        c.file.BlobURL,
+		StartLine:       github.Int(1),
+		EndLine:         github.Int(1),
+		AnnotationLevel: github.String("failure"),
+		Title:           github.String(fmt.Sprintf("Error loading %s", c.file.GetFilename())),
+		Message:         github.String(fmt.Sprintf("%+v", err)),
+	}
+}
+
 // MarkdownListItem returns a string that represents the Candidate designed for
 // use in a Markdown List
 func (c *Candidate) MarkdownListItem() string {
+	if c.rendered != nil {
+		return fmt.Sprintf("* [`./%s`](%s) %s", c.file.GetFilename(), c.file.GetBlobURL(), c.rendered.Description)
+	}
 	return fmt.Sprintf("* [`./%s`](%s)", c.file.GetFilename(), c.file.GetBlobURL())
 }
 
 // Validate bytes with kubeval and return an array of CheckRunAnnotation
 func (c *Candidate) Validate() Annotations {
 	var annotations Annotations
+	c.rows = nil
+	c.fixes = nil
+	if c.bytes != nil {
+		annotations = append(annotations, c.parseErrorAnnotations()...)
+	}
 	for _, schema := range c.schemas {
-		kubeval.SchemaLocation = schema.SchemaLocation()
-
-		// TODO move more of this into KubeValidatorConfigSchema
-		if schema.Version != "" {
-			kubeval.Version = schema.Version
-		}
+		schemaLocation := schema.SchemaLocation(c.context.SchemaDir)
+		v := newSchemaValidator(schemaLocation, schema, c.context.schemaLoader(), c.context.crds)
+		v.compiled = c.context.compiledSchemas()
+		docs := c.docs(schema)
 
-		// TODO configurable
-		kubeval.Strict = true
-		if schema.ConfigType == "openstack" {
-			kubeval.OpenShift = true
-		} else {
-			kubeval.OpenShift = false
-		}
-
-		var schemaName string
-		if schema.Name != "" {
-			schemaName = schema.Name
-		} else if schema.Version != "" {
-			schemaName = schema.Version
-		} else {
-			schemaName = "master"
-		}
+		schemaName := schema.displayName()
 
-		if c.bytes == nil {
+		if schema.SchemaPath != "" && c.context.SchemaDir == "" {
 			annotations = append(annotations, &github.CheckRunAnnotation{
 				Path:            c.file.Filename,
 				BlobHRef:        c.file.BlobURL,
 				StartLine:       github.Int(1),
 				EndLine:         github.Int(1),
 				AnnotationLevel: github.String("failure"),
-				Title:           github.String("Candidate has no bytes?"),
-				Message:         github.String(fmt.Sprintf("%+v", c)),
+				Title:           github.String(fmt.Sprintf("Couldn't load %s schemas from %s", schemaName, schema.SchemaPath)),
+				Message:         github.String("schemaPath requires this instance of kubevalidator to be configured with a schema directory"),
 			})
 			continue
 		}
 
-		results, err := kubeval.Validate(*c.bytes, c.file.GetFilename())
-
-		if err != nil {
-			if merr, ok := err.(*multierror.Error); ok {
-				merr.ErrorFormat = abbreviatedErrorFormat
-			}
-			var title *string
-			var message *string
-			if len(results) > 0 {
-				title = github.String(fmt.Sprintf("Internal error when validating %s against %s schemas from %s", results[0].Kind, schemaName, schema.SchemaLocation()))
-				message = github.String(fmt.Sprintf("This may indicate an incorrect 'apiVersion' or 'kind' field, a missing upstream schema version, or an intermittent error. Details:\n\n%s", err))
-			} else {
-				title = github.String(fmt.Sprintf("Internal error when validating against %s schemas from %s", schemaName, schema.SchemaLocation()))
-				message = github.String(fmt.Sprintf("%s", err))
-			}
+		if c.bytes == nil {
 			annotations = append(annotations, &github.CheckRunAnnotation{
 				Path:            c.file.Filename,
 				BlobHRef:        c.file.BlobURL,
 				StartLine:       github.Int(1),
 				EndLine:         github.Int(1),
 				AnnotationLevel: github.String("failure"),
-				Title:           title,
-				Message:         message,
+				Title:           github.String("Candidate has no bytes?"),
+				Message:         github.String(fmt.Sprintf("%+v", c)),
 			})
 			continue
 		}
 
+		// Errors are reported for each of the resources they prevented from
+		// being validated, rather than hiding the results of the others
+		results, _ := v.Validate(*c.bytes, c.file.GetFilename())
+		documents := splitDocuments(*c.bytes)
+		startLines := documentStartLines(*c.bytes)
+
+		for i, result := range results {
+			deprecation := c.deprecationAnnotation(result, schema, schemaName, documents[result.Document], startLines[result.Document])
+			if deprecation != nil {
+				annotations = append(annotations, deprecation)
+				apiDeprecation := findDeprecation(result.APIVersion, result.Kind)
+				if f, ok := apiVersionFix(documents[result.Document], result.Path, apiDeprecation, schema.Version); ok && c.rendered == nil {
+					c.addFix(f.offset(startLines[result.Document]))
+				}
+			}
+			c.recordOutcome(i, result, schemaName, outcomeFor(result, deprecation))
+		}
+
 		for _, result := range results {
+			if result.Err != nil {
+				// Parse errors are reported by parseErrorAnnotations
+				if _, ok := result.Err.(*parseError); !ok {
+					annotations = append(annotations, c.internalErrorAnnotation(result, schemaName, schemaLocation, startLines[result.Document]))
+				}
+				continue
+			}
+			if result.Skipped {
+				var reason string
+				if len(schema.OnlyKinds) > 0 {
+					reason = fmt.Sprintf("%s isn't listed in onlyKinds", result.Kind)
+				} else {
+					reason = fmt.Sprintf("%s is listed in skipKinds", result.Kind)
+				}
+				annotations = append(annotations, &github.CheckRunAnnotation{
+					Path:            c.file.Filename,
+					BlobHRef:        c.file.BlobURL,
+					StartLine:       github.Int(1),
+					EndLine:         github.Int(1),
+					AnnotationLevel: github.String("notice"),
+					Title:           github.String(fmt.Sprintf("Skipped validating %s against %s schema", result.Kind, schemaName)),
+					Message:         github.String(reason),
+				})
+				continue
+			}
+			if result.MissingSchema != "" {
+				annotations = append(annotations, &github.CheckRunAnnotation{
+					Path:            c.file.Filename,
+					BlobHRef:        c.file.BlobURL,
+					StartLine:       github.Int(1),
+					EndLine:         github.Int(1),
+					AnnotationLevel: github.String("notice"),
+					Title:           github.String(fmt.Sprintf("No %s schema found for %s", schemaName, result.Kind)),
+					Message:         github.String(fmt.Sprintf("%s wasn't validated as %s couldn't be found", result.Kind, result.MissingSchema)),
+				})
+				continue
+			}
 			for _, error := range result.Errors {
 				startLine := 1
 				endLine := 1
-				if schema.LineNumbers == true {
-					switch error.Type() {
-					default:
-						// fmt.Println(error.Type())
-						startLine, endLine = detectLineNumbersDefault(c.bytes, error)
+				details := resultErrorDetailString(error)
+				if schema.lineNumbers() {
+					if r, ok := locateError(documents[result.Document], result.Path, error); ok {
+						// Positions are found within the document, so offset
+						// them by the lines of the documents before it
+						startLine = r.Start.Line + startLines[result.Document] - 1
+						endLine = r.End.Line + startLines[result.Document] - 1
+						// Rendered output doesn't share columns with its source
+						if startLine == endLine && c.rendered == nil {
+							details += fmt.Sprintf("* columns: %d-%d\n", r.Start.Column, r.End.Column)
+						}
 					}
 				}
 
-				var message *string
-				if schema.Version == "" || schema.Version == "master" {
-					message = github.String(error.String())
-				} else {
-					versionComponents := strings.Split(schema.Version, ".")
-					apiVersionComponents := strings.Split(result.APIVersion, "/")
-					// :eyeroll: reverse a slice
-					for i := len(apiVersionComponents)/2 - 1; i >= 0; i-- {
-						opp := len(apiVersionComponents) - 1 - i
-						apiVersionComponents[i], apiVersionComponents[opp] = apiVersionComponents[opp], apiVersionComponents[i]
-					}
-					apiVersionString := strings.Join(apiVersionComponents, "-")
-					message = github.String(fmt.Sprintf("%s; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v%s/#%s-%s for more details", error.String(), strings.Join(versionComponents[:2], "."), strings.ToLower(result.Kind), apiVersionString))
+				description := error.String()
+				suggestions := suggestionsFor(result.Schema, error)
+				if len(suggestions) > 0 {
+					description += "; " + suggestionString(suggestions)
+					details += fmt.Sprintf("* suggestions: %s\n", strings.Join(suggestions, ", "))
+				}
+				if f, ok := fixFor(documents[result.Document], result.Path, error, suggestions); ok && c.rendered == nil {
+					c.addFix(f.offset(startLines[result.Document]))
 				}
 
 				annotations = append(annotations, &github.CheckRunAnnotation{
@@ -178,88 +226,149 @@ func (c *Candidate) Validate() Annotations {
 					BlobHRef:        c.file.BlobURL,
 					StartLine:       &startLine,
 					EndLine:         &endLine,
-					AnnotationLevel: github.String("failure"),
+					AnnotationLevel: github.String(c.level(error.Type(), "", result.Kind, "failure")),
 					Title:           github.String(fmt.Sprintf("Error validating %s against %s schema", result.Kind, schemaName)),
-					Message:         message,
-					RawDetails:      github.String(resultErrorDetailString(error)),
+					Message:         github.String(withDocsLink(description, docs.URL(result.APIVersion, result.Kind, contextSegments(error)))),
+					RawDetails:      github.String(details),
 				})
 			}
 		}
 	}
+	c.rendered.mapAnnotations(annotations)
 	sort.Sort(annotations)
 	return annotations
 }
 
-func detectLineNumbersDefault(b *[]byte, e gojsonschema.ResultError) (int, int) {
-	var dotted string
-	rootContext := strings.TrimPrefix(e.Context().String(), "(root).")
-	dotted = fmt.Sprintf(".%s", rootContext)
-	path := yamlpatch.OpPath(strings.Replace(dotted, ".", "/", -1))
-	// log.Println(e.String())
-	// log.Println(e.Type())
-	// log.Println(path)
-	var patch yamlpatch.Patch
-	var s interface{}
-	s = placeholderString
-	value := yamlpatch.NewNode(&s)
-	operation := yamlpatch.Operation{
-		Op:    "replace",
-		Path:  path,
-		Value: value,
+// internalErrorAnnotation reports a resource which couldn't be validated at
+// the start of its document
+func (c *Candidate) internalErrorAnnotation(result validationResult, schemaName string, schemaLocation string, line int) *github.CheckRunAnnotation {
+	title := fmt.Sprintf("Internal error when validating against %s schemas from %s", schemaName, schemaLocation)
+	message := result.Err.Error()
+	if result.Kind != "" {
+		title = fmt.Sprintf("Internal error when validating %s against %s schemas from %s", result.Kind, schemaName, schemaLocation)
+		message = fmt.Sprintf("This may indicate an incorrect 'apiVersion' or 'kind' field, a missing upstream schema version, or an intermittent error. Details:\n\n%s", result.Err)
 	}
-	patch = append(patch, operation)
-	patchedBytes, err := patch.Apply(*b)
-	if err != nil {
-		return 1, 1
+	return &github.CheckRunAnnotation{
+		Path:            c.file.Filename,
+		BlobHRef:        c.file.BlobURL,
+		StartLine:       github.Int(line),
+		EndLine:         github.Int(line),
+		AnnotationLevel: github.String("failure"),
+		Title:           github.String(title),
+		Message:         github.String(message),
 	}
+}
 
-	difflibDiff := difflib.UnifiedDiff{
-		A:        difflib.SplitLines(string(*b)),
-		B:        difflib.SplitLines(string(patchedBytes)),
-		FromFile: "Original",
-		ToFile:   "Current",
-		Context:  0,
+// level returns the configured level of the annotation reporting an error, or
+// defaultLevel if none has been configured
+func (c *Candidate) level(errorType string, rule string, kind string, defaultLevel string) string {
+	if c.context == nil {
+		return defaultLevel
 	}
-	unifiedDiffString, err := difflib.GetUnifiedDiffString(difflibDiff)
-	if err != nil {
-		return 1, 1
+	return c.context.severity.level(errorType, rule, kind, defaultLevel)
+}
+
+// docs returns a docsResolver for schema which uses the configured
+// documentation URL templates and reference version
+func (c *Candidate) docs(schema *KubeValidatorConfigSchema) *docsResolver {
+	if c.context == nil {
+		return newDocsResolver(schema, nil, "")
 	}
+	return newDocsResolver(schema, c.context.docs, c.context.docsVersion)
+}
 
-	// log.Println(unifiedDiffString)
-	fileDiff, err := diff.ParseFileDiff([]byte(unifiedDiffString))
-	if err != nil {
-		return 1, 1
+// parseErrorAnnotations reports each of the documents which couldn't be
+// decoded at the position the YAML parser gave, and each of the items of
+// Lists which aren't resources
+func (c *Candidate) parseErrorAnnotations() Annotations {
+	var annotations Annotations
+	startLines := documentStartLines(*c.bytes)
+	for i, document := range splitDocuments(*c.bytes) {
+		var spec interface{}
+		err := yaml.Unmarshal(document, &spec)
+		if err == nil {
+			body, _ := convertToStringKeys(spec).(map[string]interface{})
+			for _, item := range expandList(body) {
+				if item.err == nil {
+					continue
+				}
+				line, _ := detectLineNumbersForPath(&document, item.pointer)
+				annotations = append(annotations, &github.CheckRunAnnotation{
+					Path:            c.file.Filename,
+					BlobHRef:        c.file.BlobURL,
+					StartLine:       github.Int(startLines[i] + line - 1),
+					EndLine:         github.Int(startLines[i] + line - 1),
+					AnnotationLevel: github.String(c.level("parse_error", "", "", "failure")),
+					Title:           github.String(fmt.Sprintf("Couldn't parse %s", c.file.GetFilename())),
+					Message:         github.String(item.err.Message),
+				})
+			}
+			continue
+		}
+		e := newParseError(document, err)
+		line := startLines[i]
+		if e.Line > 0 {
+			line += e.Line - 1
+		}
+		var details *string
+		// Rendered output doesn't share columns with its source
+		if e.Column > 0 && c.rendered == nil {
+			details = github.String(fmt.Sprintf("* column: %d\n", e.Column))
+		}
+		annotations = append(annotations, &github.CheckRunAnnotation{
+			Path:            c.file.Filename,
+			BlobHRef:        c.file.BlobURL,
+			StartLine:       github.Int(line),
+			EndLine:         github.Int(line),
+			AnnotationLevel: github.String(c.level("parse_error", "", "", "failure")),
+			Title:           github.String(fmt.Sprintf("Couldn't parse %s", c.file.GetFilename())),
+			Message:         github.String(e.Message),
+			RawDetails:      details,
+		})
 	}
+	return annotations
+}
 
-	for _, hunk := range fileDiff.Hunks {
-		scanner := bufio.NewScanner(bytes.NewReader(hunk.Body))
+// locateError returns the range of a document an error refers to, within the
+// resource found at the JSON pointer prefix
+func locateError(b []byte, prefix string, e gojsonschema.ResultError) (yamlRange, bool) {
+	root := parseNodes(b)
+	if root == nil {
+		return yamlRange{}, false
+	}
+	key, node, ok := root.lookup(append(pointerSegments(prefix), contextSegments(e)...))
+	if !ok {
+		return yamlRange{}, false
+	}
 
-		line := 1
-		found := false
-		for scanner.Scan() {
-			if strings.Contains(scanner.Text(), placeholderString) {
-				found = true
-				continue
+	// The context of an additional property is the mapping containing it,
+	// while required properties are reported on the mapping missing them
+	if e.Type() == "additional_property_not_allowed" {
+		if property, ok := e.Details()["property"].(string); ok {
+			if propertyKey, _, ok := node.lookup([]string{property}); ok && propertyKey != nil {
+				return yamlRange{Start: propertyKey.start, End: propertyKey.end}, true
 			}
-			line++
 		}
-		if found {
-			// log.Printf("%+v", hunk)
-			startLine := int(hunk.NewStartLine)
-			endLine := int(hunk.NewStartLine + hunk.NewLines)
-			// log.Printf("start: %d end: %d", startLine, endLine)
+	}
+	return entryRange(key, node), true
+}
 
-			// if e.Type() == "additional_property_not_allowed" {
-			// 	return line, line+1
-			// }
-			return startLine, endLine
-		}
+// contextSegments splits the context of an error into the keys and indexes
+// leading to the value it refers to
+func contextSegments(e gojsonschema.ResultError) []string {
+	// Keys often contain dots, so the context is split on a character they
+	// can't contain
+	return strings.Split(e.Context().String("\x00"), "\x00")[1:]
+}
 
-		if err := scanner.Err(); err != nil {
-			continue
-		}
+// detectLineNumbersForPath returns the lines of b containing the value found at
+// a JSON pointer like /spec/replicas
+func detectLineNumbersForPath(b *[]byte, pointer string) (int, int) {
+	r, ok := locatePointer(*b, pointer)
+	if !ok {
+		return 1, 1
 	}
-	return 1, 1
+	return r.Start.Line, r.End.Line
 }
 
 func resultErrorDetailString(e gojsonschema.ResultError) string {
@@ -276,17 +385,3 @@ func resultErrorDetailString(e gojsonschema.ResultError) string {
 
 	return buffer.String()
 }
-
-// Like ListFormatFunc but shorter
-func abbreviatedErrorFormat(es []error) string {
-	if len(es) == 1 {
-		return es[0].Error()
-	}
-
-	points := make([]string, len(es))
-	for i, err := range es {
-		points[i] = fmt.Sprintf("* %s", err)
-	}
-
-	return strings.Join(points, "\n\t")
-}
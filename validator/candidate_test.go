@@ -1,9 +1,11 @@
 package validator
 
 import (
+	"fmt"
 	"io/ioutil"
 	"path/filepath"
 	"sort"
+	"strings"
 	"testing"
 
 	"github.com/go-test/deep"
@@ -46,32 +48,32 @@ func TestAnnotationsForInvalidCandidate(t *testing.T) {
 		{
 			Path:            github.String("deployment.yaml"),
 			BlobHRef:        github.String("https://github.com/octocat/Hello-World/blob/837db83be4137ca555d9a5598d0a1ea2987ecfee/deployment.yaml"),
-			StartLine:       github.Int(1),
-			EndLine:         github.Int(1),
+			StartLine:       github.Int(6),
+			EndLine:         github.Int(7),
 			AnnotationLevel: github.String("failure"),
 			Title:           github.String("Error validating Deployment against master schema"),
-			Message:         github.String("selector: selector is required"),
+			Message:         github.String("selector: selector is required; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.32/#deploymentspec-v1-apps for more details"),
 			RawDetails:      github.String("* context: (root).spec\n* field: selector\n* property: selector\n"),
 		},
 		{
 			Path:            github.String("deployment.yaml"),
 			BlobHRef:        github.String("https://github.com/octocat/Hello-World/blob/837db83be4137ca555d9a5598d0a1ea2987ecfee/deployment.yaml"),
-			StartLine:       github.Int(1),
-			EndLine:         github.Int(1),
+			StartLine:       github.Int(6),
+			EndLine:         github.Int(7),
 			AnnotationLevel: github.String("failure"),
 			Title:           github.String("Error validating Deployment against master schema"),
-			Message:         github.String("spec.replicas: Invalid type. Expected: integer, given: string"),
-			RawDetails:      github.String("* context: (root).spec.replicas\n* expected: integer\n* field: spec.replicas\n* given: string\n"),
+			Message:         github.String("template: template is required; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.32/#deploymentspec-v1-apps for more details"),
+			RawDetails:      github.String("* context: (root).spec\n* field: template\n* property: template\n"),
 		},
 		{
 			Path:            github.String("deployment.yaml"),
 			BlobHRef:        github.String("https://github.com/octocat/Hello-World/blob/837db83be4137ca555d9a5598d0a1ea2987ecfee/deployment.yaml"),
-			StartLine:       github.Int(1),
-			EndLine:         github.Int(1),
+			StartLine:       github.Int(7),
+			EndLine:         github.Int(7),
 			AnnotationLevel: github.String("failure"),
 			Title:           github.String("Error validating Deployment against master schema"),
-			Message:         github.String("template: template is required"),
-			RawDetails:      github.String("* context: (root).spec\n* field: template\n* property: template\n"),
+			Message:         github.String("spec.replicas: Invalid type. Expected: integer, given: string; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.32/#deploymentspec-v1-apps for more details"),
+			RawDetails:      github.String("* context: (root).spec.replicas\n* expected: integer\n* field: spec.replicas\n* given: string\n* columns: 3-16\n"),
 		}}
 
 	if len(annotations) != len(want) {
@@ -109,32 +111,32 @@ func TestAnnotationsForCandidateWithMultipleFailures(t *testing.T) {
 		{
 			Path:            github.String("deployment.yaml"),
 			BlobHRef:        github.String("https://github.com/octocat/Hello-World/blob/837db83be4137ca555d9a5598d0a1ea2987ecfee/deployment.yaml"),
-			StartLine:       github.Int(1),
-			EndLine:         github.Int(1),
+			StartLine:       github.Int(8),
+			EndLine:         github.Int(8),
 			AnnotationLevel: github.String("failure"),
 			Title:           github.String("Error validating Deployment against 1.13.0 schema"),
-			Message:         github.String("extra: Additional property extra is not allowed; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.13/#deployment-v1-apps for more details"),
-			RawDetails:      github.String("* context: (root).spec\n* field: extra\n* property: extra\n"),
+			Message:         github.String("extra: Additional property extra is not allowed; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.13/#deploymentspec-v1-apps for more details"),
+			RawDetails:      github.String("* context: (root).spec\n* field: extra\n* property: extra\n* columns: 3-7\n"),
 		},
 		{
 			Path:            github.String("deployment.yaml"),
 			BlobHRef:        github.String("https://github.com/octocat/Hello-World/blob/837db83be4137ca555d9a5598d0a1ea2987ecfee/deployment.yaml"),
-			StartLine:       github.Int(1),
-			EndLine:         github.Int(1),
+			StartLine:       github.Int(9),
+			EndLine:         github.Int(9),
 			AnnotationLevel: github.String("failure"),
 			Title:           github.String("Error validating Deployment against 1.13.0 schema"),
-			Message:         github.String("spec.replicas: Invalid type. Expected: integer, given: string; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.13/#deployment-v1-apps for more details"),
-			RawDetails:      github.String("* context: (root).spec.replicas\n* expected: integer\n* field: spec.replicas\n* given: string\n"),
+			Message:         github.String("spec.replicas: Invalid type. Expected: integer, given: string; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.13/#deploymentspec-v1-apps for more details"),
+			RawDetails:      github.String("* context: (root).spec.replicas\n* expected: integer\n* field: spec.replicas\n* given: string\n* columns: 3-21\n"),
 		},
 		{
 			Path:            github.String("deployment.yaml"),
 			BlobHRef:        github.String("https://github.com/octocat/Hello-World/blob/837db83be4137ca555d9a5598d0a1ea2987ecfee/deployment.yaml"),
-			StartLine:       github.Int(1),
-			EndLine:         github.Int(1),
+			StartLine:       github.Int(23),
+			EndLine:         github.Int(23),
 			AnnotationLevel: github.String("failure"),
 			Title:           github.String("Error validating Deployment against 1.13.0 schema"),
-			Message:         github.String("extra-container: Additional property extra-container is not allowed; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.13/#deployment-v1-apps for more details"),
-			RawDetails:      github.String("* context: (root).spec.template.spec.containers.0\n* field: extra-container\n* property: extra-container\n"),
+			Message:         github.String("extra-container: Additional property extra-container is not allowed; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.13/#container-v1-core for more details"),
+			RawDetails:      github.String("* context: (root).spec.template.spec.containers.0\n* field: extra-container\n* property: extra-container\n* columns: 11-25\n"),
 		},
 	}
 
@@ -215,3 +217,347 @@ func TestAnnotationsWithCustomSchemaFailure(t *testing.T) {
 		}
 	}
 }
+
+func TestAnnotationsWithSchemaDir(t *testing.T) {
+	schemaDir, _ := filepath.Abs("../fixtures/schemas")
+	candidate := NewCandidate(
+		&Context{
+			Event:     &github.CheckSuiteEvent{},
+			SchemaDir: schemaDir,
+		}, &github.CommitFile{
+			BlobURL:  github.String("https://github.com/octocat/Hello-World/blob/837db83be4137ca555d9a5598d0a1ea2987ecfee/deployment.yaml"),
+			Filename: github.String("deployment.yaml"),
+		}, nil)
+
+	filePath, _ := filepath.Abs("../fixtures/invalid.yaml")
+	fileContents, _ := ioutil.ReadFile(filePath)
+	candidate.setBytes(&fileContents)
+	annotations := candidate.Validate()
+
+	want := []string{
+		"selector: selector is required; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.32/#deploymentspec-v1-apps for more details",
+		"template: template is required; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.32/#deploymentspec-v1-apps for more details",
+		"spec.replicas: Invalid type. Expected: integer, given: string; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.32/#deploymentspec-v1-apps for more details",
+	}
+
+	if len(annotations) != len(want) {
+		t.Errorf("a total of %d annotations were returned, wanted %d: %+v", len(annotations), len(want), github.Stringify(annotations))
+		return
+	}
+
+	for i, annotation := range annotations {
+		if annotation.GetMessage() != want[i] {
+			t.Errorf("expected %q, got %q", want[i], annotation.GetMessage())
+		}
+	}
+}
+
+func TestAnnotationsWithSchemaPath(t *testing.T) {
+	schemaDir, _ := filepath.Abs("../fixtures")
+	schema := &KubeValidatorConfigSchema{
+		SchemaPath: "schemas",
+	}
+	candidate := NewCandidate(
+		&Context{
+			Event:     &github.CheckSuiteEvent{},
+			SchemaDir: schemaDir,
+		}, &github.CommitFile{
+			Filename: github.String("deployment.yaml"),
+		}, []*KubeValidatorConfigSchema{schema})
+
+	filePath, _ := filepath.Abs("../fixtures/deployment.yaml")
+	fileContents, _ := ioutil.ReadFile(filePath)
+	candidate.setBytes(&fileContents)
+	annotations := candidate.Validate()
+
+	if len(annotations) != 0 {
+		t.Errorf("%d annotations returned, expected 0: %+v", len(annotations), github.Stringify(annotations))
+	}
+}
+
+func TestAnnotationsWithSchemaPathWithoutSchemaDir(t *testing.T) {
+	schema := &KubeValidatorConfigSchema{
+		SchemaPath: "schemas",
+	}
+	candidate := NewCandidate(
+		&Context{
+			Event: &github.CheckSuiteEvent{},
+		}, &github.CommitFile{
+			Filename: github.String("deployment.yaml"),
+		}, []*KubeValidatorConfigSchema{schema})
+
+	filePath, _ := filepath.Abs("../fixtures/deployment.yaml")
+	fileContents, _ := ioutil.ReadFile(filePath)
+	candidate.setBytes(&fileContents)
+	annotations := candidate.Validate()
+
+	want := []*github.CheckRunAnnotation{{
+		Path:            github.String("deployment.yaml"),
+		StartLine:       github.Int(1),
+		EndLine:         github.Int(1),
+		AnnotationLevel: github.String("failure"),
+		Title:           github.String("Couldn't load master schemas from schemas"),
+		Message:         github.String("schemaPath requires this instance of kubevalidator to be configured with a schema directory"),
+	}}
+
+	if diff := deep.Equal(annotations, Annotations(want)); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestAnnotationsWithSchemaOptions(t *testing.T) {
+	schemaDir, _ := filepath.Abs("../fixtures/schemas")
+	filePath, _ := filepath.Abs("../fixtures/multiple-kinds/unknown-kind.yaml")
+	fileContents, _ := ioutil.ReadFile(filePath)
+
+	tests := []struct {
+		name   string
+		schema *KubeValidatorConfigSchema
+		want   []string
+	}{
+		{
+			"strict",
+			&KubeValidatorConfigSchema{},
+			[]string{
+				"failure: Error validating Deployment against master schema: extra: Additional property extra is not allowed; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.32/#container-v1-core for more details",
+				"failure: Error validating Deployment against master schema: spec.replicas: Invalid type. Expected: integer, given: string; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.32/#deploymentspec-v1-apps for more details",
+				"failure: Internal error when validating Widget against master schemas from file://" + schemaDir,
+			},
+		},
+		{
+			"ignoreMissingSchemas",
+			&KubeValidatorConfigSchema{IgnoreMissingSchemas: true},
+			[]string{
+				"failure: Error validating Deployment against master schema: extra: Additional property extra is not allowed; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.32/#container-v1-core for more details",
+				"failure: Error validating Deployment against master schema: spec.replicas: Invalid type. Expected: integer, given: string; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.32/#deploymentspec-v1-apps for more details",
+				"notice: No master schema found for Widget: Widget wasn't validated as file://" + schemaDir + "/master-standalone-strict/widget-example-v1.json couldn't be found",
+			},
+		},
+		{
+			"not strict",
+			&KubeValidatorConfigSchema{IgnoreMissingSchemas: true, Strict: github.Bool(false)},
+			[]string{
+				"failure: Error validating Deployment against master schema: spec.replicas: Invalid type. Expected: integer, given: string; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.32/#deploymentspec-v1-apps for more details",
+				"notice: No master schema found for Widget: Widget wasn't validated as file://" + schemaDir + "/master-standalone/widget-example-v1.json couldn't be found",
+			},
+		},
+		{
+			"skipKinds",
+			&KubeValidatorConfigSchema{SkipKinds: []string{"Widget"}},
+			[]string{
+				"failure: Error validating Deployment against master schema: extra: Additional property extra is not allowed; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.32/#container-v1-core for more details",
+				"failure: Error validating Deployment against master schema: spec.replicas: Invalid type. Expected: integer, given: string; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.32/#deploymentspec-v1-apps for more details",
+				"notice: Skipped validating Widget against master schema: Widget is listed in skipKinds",
+			},
+		},
+		{
+			"onlyKinds",
+			&KubeValidatorConfigSchema{OnlyKinds: []string{"Widget"}, IgnoreMissingSchemas: true},
+			[]string{
+				"notice: No master schema found for Widget: Widget wasn't validated as file://" + schemaDir + "/master-standalone-strict/widget-example-v1.json couldn't be found",
+				"notice: Skipped validating Deployment against master schema: Deployment isn't listed in onlyKinds",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		candidate := NewCandidate(
+			&Context{
+				Event:     &github.CheckSuiteEvent{},
+				SchemaDir: schemaDir,
+			}, &github.CommitFile{
+				Filename: github.String("unknown-kind.yaml"),
+			}, []*KubeValidatorConfigSchema{test.schema})
+		candidate.setBytes(&fileContents)
+		annotations := candidate.Validate()
+
+		var got []string
+		for _, annotation := range annotations {
+			if annotation.GetAnnotationLevel() == "failure" && annotation.RawDetails == nil {
+				got = append(got, fmt.Sprintf("%s: %s", annotation.GetAnnotationLevel(), annotation.GetTitle()))
+				continue
+			}
+			got = append(got, fmt.Sprintf("%s: %s: %s", annotation.GetAnnotationLevel(), annotation.GetTitle(), annotation.GetMessage()))
+		}
+		sort.Strings(got)
+		if diff := deep.Equal(got, test.want); diff != nil {
+			t.Errorf("%s: %v", test.name, diff)
+		}
+	}
+}
+
+func TestAnnotationsForParseErrors(t *testing.T) {
+	schemaDir, _ := filepath.Abs("../fixtures/schemas")
+	tests := []struct {
+		file string
+		want []*github.CheckRunAnnotation
+	}{
+		{
+			"tab.yaml",
+			[]*github.CheckRunAnnotation{{
+				Path:            github.String("tab.yaml"),
+				StartLine:       github.Int(24),
+				EndLine:         github.Int(24),
+				AnnotationLevel: github.String("failure"),
+				Title:           github.String("Couldn't parse tab.yaml"),
+				Message:         github.String("found character that cannot start any token"),
+				RawDetails:      github.String("* column: 1\n"),
+			}},
+		},
+		{
+			"mapping.yaml",
+			[]*github.CheckRunAnnotation{{
+				Path:            github.String("mapping.yaml"),
+				StartLine:       github.Int(6),
+				EndLine:         github.Int(6),
+				AnnotationLevel: github.String("failure"),
+				Title:           github.String("Couldn't parse mapping.yaml"),
+				Message:         github.String("mapping values are not allowed in this context"),
+			}},
+		},
+	}
+
+	for _, test := range tests {
+		candidate := NewCandidate(
+			&Context{
+				Event:     &github.CheckSuiteEvent{},
+				SchemaDir: schemaDir,
+			}, &github.CommitFile{
+				Filename: github.String(test.file),
+			}, nil)
+
+		fileContents, err := ioutil.ReadFile(filepath.Join("../fixtures/parse-errors", test.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		candidate.setBytes(&fileContents)
+
+		if diff := deep.Equal(candidate.Validate(), Annotations(test.want)); diff != nil {
+			t.Errorf("%s: %v", test.file, diff)
+		}
+	}
+}
+
+func TestAnnotationsWithSuggestions(t *testing.T) {
+	schemaDir, _ := filepath.Abs("../fixtures/schemas")
+	crds := newCRDRegistry()
+	crdContents, _ := ioutil.ReadFile("../fixtures/suggestions/crd.yaml")
+	crds.Add(crdContents)
+
+	tests := []struct {
+		file    string
+		want    []string
+		details []string
+	}{
+		{
+			"deployment.yaml",
+			[]string{
+				`imagepullpolicy: Additional property imagepullpolicy is not allowed; did you mean "imagePullPolicy"?; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.32/#container-v1-core for more details`,
+				`replcas: Additional property replcas is not allowed; did you mean "replicas"?; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.32/#deploymentspec-v1-apps for more details`,
+			},
+			[]string{
+				"* context: (root).spec.template.spec.containers.0\n* field: imagepullpolicy\n* property: imagepullpolicy\n* columns: 9-23\n* suggestions: imagePullPolicy\n",
+				"* context: (root).spec\n* field: replcas\n* property: replcas\n* columns: 3-9\n* suggestions: replicas\n",
+			},
+		},
+		{
+			"backup.yaml",
+			[]string{
+				`spec.concurrencyPolicy: spec.concurrencyPolicy must be one of the following: "Allow", "Forbid", "Replace"; did you mean "Forbid"?`,
+			},
+			[]string{
+				"* allowed: \"Allow\", \"Forbid\", \"Replace\"\n* context: (root).spec.concurrencyPolicy\n* field: spec.concurrencyPolicy\n* columns: 3-30\n* suggestions: Forbid\n",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		candidate := NewCandidate(
+			&Context{
+				Event:     &github.CheckSuiteEvent{},
+				SchemaDir: schemaDir,
+				crds:      crds,
+			}, &github.CommitFile{
+				Filename: github.String(test.file),
+			}, nil)
+
+		fileContents, _ := ioutil.ReadFile(filepath.Join("../fixtures/suggestions", test.file))
+		candidate.setBytes(&fileContents)
+		annotations := candidate.Validate()
+
+		if len(annotations) != len(test.want) {
+			t.Errorf("%s: a total of %d annotations were returned, wanted %d: %s", test.file, len(annotations), len(test.want), github.Stringify(annotations))
+			continue
+		}
+		for i, annotation := range annotations {
+			if annotation.GetMessage() != test.want[i] {
+				t.Errorf("%s: expected %q, got %q", test.file, test.want[i], annotation.GetMessage())
+			}
+			if annotation.GetRawDetails() != test.details[i] {
+				t.Errorf("%s: expected details %q, got %q", test.file, test.details[i], annotation.GetRawDetails())
+			}
+		}
+	}
+}
+
+func TestAnnotationsWithSeverity(t *testing.T) {
+	schemaDir, _ := filepath.Abs("../fixtures/schemas")
+	candidate := NewCandidate(
+		&Context{
+			Event:     &github.CheckSuiteEvent{},
+			SchemaDir: schemaDir,
+			severity: &KubeValidatorConfigSeverity{
+				Types: map[string]string{"additional_property_not_allowed": "warning"},
+				Kinds: map[string]string{"Deployment": "notice"},
+			},
+		}, &github.CommitFile{
+			Filename: github.String("deployment.yaml"),
+		}, nil)
+
+	filePath, _ := filepath.Abs("../fixtures/invalid/deployment/multiple.yaml")
+	fileContents, _ := ioutil.ReadFile(filePath)
+	candidate.setBytes(&fileContents)
+	annotations := candidate.Validate()
+	if len(annotations) != 3 {
+		t.Fatalf("a total of %d annotations were returned, wanted 3: %s", len(annotations), github.Stringify(annotations))
+	}
+
+	for _, annotation := range annotations {
+		want := "notice"
+		if strings.Contains(annotation.GetMessage(), "Additional property") {
+			want = "warning"
+		}
+		if annotation.GetAnnotationLevel() != want {
+			t.Errorf("expected %q to be a %s, got %s", annotation.GetMessage(), want, annotation.GetAnnotationLevel())
+		}
+	}
+}
+
+func TestAnnotationsAfterSchemaLoadErrors(t *testing.T) {
+	schemaDir, _ := filepath.Abs("../fixtures/schemas")
+	candidate := NewCandidate(
+		&Context{
+			Event:     &github.CheckSuiteEvent{},
+			SchemaDir: schemaDir,
+		}, &github.CommitFile{
+			Filename: github.String("unknown-kind-first.yaml"),
+		}, nil)
+
+	filePath, _ := filepath.Abs("../fixtures/multiple-kinds/unknown-kind-first.yaml")
+	fileContents, _ := ioutil.ReadFile(filePath)
+	candidate.setBytes(&fileContents)
+	annotations := candidate.Validate()
+
+	var got []string
+	for _, annotation := range annotations {
+		got = append(got, fmt.Sprintf("%d %s", annotation.GetStartLine(), annotation.GetTitle()))
+	}
+	want := []string{
+		"13 Error validating Deployment against master schema",
+		"1 Internal error when validating Widget against master schemas from file://" + filepath.ToSlash(schemaDir),
+		"25 Error validating Deployment against master schema",
+	}
+	if diff := deep.Equal(got, want); diff != nil {
+		t.Error(diff)
+	}
+}
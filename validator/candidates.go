@@ -1,17 +1,50 @@
 package validator
 
-import "sort"
+import (
+	"fmt"
+	"sort"
+
+	"github.com/google/go-github/github"
+)
 
 // Candidates is an array of pointers to Candidates
 type Candidates []*Candidate
 
-// LoadBytes loads all of the files from GitHub
+// LoadBytes loads all of the files from GitHub concurrently and through the
+// blob cache. Files matched by more than one manifest are only loaded once.
 func (c *Candidates) LoadBytes() Annotations {
 	var a Annotations
+	var contexts []*Context
+	byContext := make(map[*Context]Candidates)
 	for _, candidate := range *c {
-		annotation := candidate.LoadBytes()
-		if annotation != nil {
-			a = append(a, annotation)
+		// Rendered candidates already have their bytes
+		if candidate.rendered != nil {
+			continue
+		}
+		if _, ok := byContext[candidate.context]; !ok {
+			contexts = append(contexts, candidate.context)
+		}
+		byContext[candidate.context] = append(byContext[candidate.context], candidate)
+	}
+
+	for _, context := range contexts {
+		candidates := byContext[context]
+		var files []*github.CommitFile
+		loaded := make(map[string]int)
+		for _, candidate := range candidates {
+			if _, ok := loaded[candidate.file.GetFilename()]; !ok {
+				loaded[candidate.file.GetFilename()] = len(files)
+				files = append(files, candidate.file)
+			}
+		}
+		contents, errs := context.loadFiles(context.Event.(*github.CheckSuiteEvent), files)
+		for _, candidate := range candidates {
+			i := loaded[candidate.file.GetFilename()]
+			if errs[i] != nil {
+				a = append(a, candidate.loadErrorAnnotation(errs[i]))
+				continue
+			}
+			candidate.bytes = contents[i]
 		}
 	}
 	sort.Sort(a)
@@ -30,3 +63,22 @@ func (c *Candidates) Validate() Annotations {
 	sort.Sort(a)
 	return a
 }
+
+// EvaluateRules checks all candidates against the configured rules. Files
+// matched by more than one manifest are only reported once.
+func (c *Candidates) EvaluateRules(rules []*KubeValidatorConfigRule) Annotations {
+	var a Annotations
+	seen := make(map[string]bool)
+	for _, candidate := range *c {
+		for _, annotation := range candidate.EvaluateRules(rules) {
+			key := fmt.Sprintf("%s:%d:%s", annotation.GetPath(), annotation.GetStartLine(), annotation.GetTitle())
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			a = append(a, annotation)
+		}
+	}
+	sort.Sort(a)
+	return a
+}
@@ -52,32 +52,32 @@ func TestAnnotationsForInvalidCandidates(t *testing.T) {
 		{
 			Path:            github.String("deployment.yaml"),
 			BlobHRef:        github.String("https://github.com/octocat/Hello-World/blob/837db83be4137ca555d9a5598d0a1ea2987ecfee/deployment.yaml"),
-			StartLine:       github.Int(1),
-			EndLine:         github.Int(1),
+			StartLine:       github.Int(6),
+			EndLine:         github.Int(7),
 			AnnotationLevel: github.String("failure"),
 			Title:           github.String("Error validating Deployment against master schema"),
-			Message:         github.String("selector: selector is required"),
+			Message:         github.String("selector: selector is required; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.32/#deploymentspec-v1-apps for more details"),
 			RawDetails:      github.String("* context: (root).spec\n* field: selector\n* property: selector\n"),
 		},
 		{
 			Path:            github.String("deployment.yaml"),
 			BlobHRef:        github.String("https://github.com/octocat/Hello-World/blob/837db83be4137ca555d9a5598d0a1ea2987ecfee/deployment.yaml"),
-			StartLine:       github.Int(1),
-			EndLine:         github.Int(1),
+			StartLine:       github.Int(6),
+			EndLine:         github.Int(7),
 			AnnotationLevel: github.String("failure"),
 			Title:           github.String("Error validating Deployment against master schema"),
-			Message:         github.String("spec.replicas: Invalid type. Expected: integer, given: string"),
-			RawDetails:      github.String("* context: (root).spec.replicas\n* expected: integer\n* field: spec.replicas\n* given: string\n"),
+			Message:         github.String("template: template is required; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.32/#deploymentspec-v1-apps for more details"),
+			RawDetails:      github.String("* context: (root).spec\n* field: template\n* property: template\n"),
 		},
 		{
 			Path:            github.String("deployment.yaml"),
 			BlobHRef:        github.String("https://github.com/octocat/Hello-World/blob/837db83be4137ca555d9a5598d0a1ea2987ecfee/deployment.yaml"),
-			StartLine:       github.Int(1),
-			EndLine:         github.Int(1),
+			StartLine:       github.Int(7),
+			EndLine:         github.Int(7),
 			AnnotationLevel: github.String("failure"),
 			Title:           github.String("Error validating Deployment against master schema"),
-			Message:         github.String("template: template is required"),
-			RawDetails:      github.String("* context: (root).spec\n* field: template\n* property: template\n"),
+			Message:         github.String("spec.replicas: Invalid type. Expected: integer, given: string; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.32/#deploymentspec-v1-apps for more details"),
+			RawDetails:      github.String("* context: (root).spec.replicas\n* expected: integer\n* field: spec.replicas\n* given: string\n* columns: 3-16\n"),
 		}}
 
 	if len(annotations) != len(want) {
@@ -148,32 +148,32 @@ func TestLoadingCandidatesBytesFromGitHub(t *testing.T) {
 		{
 			Path:            github.String("deployment.yaml"),
 			BlobHRef:        github.String("https://github.com/octocat/Hello-World/blob/837db83be4137ca555d9a5598d0a1ea2987ecfee/deployment.yaml"),
-			StartLine:       github.Int(1),
-			EndLine:         github.Int(1),
+			StartLine:       github.Int(8),
+			EndLine:         github.Int(8),
 			AnnotationLevel: github.String("failure"),
 			Title:           github.String("Error validating Deployment against master schema"),
-			Message:         github.String("extra: Additional property extra is not allowed"),
-			RawDetails:      github.String("* context: (root).spec\n* field: extra\n* property: extra\n"),
+			Message:         github.String("extra: Additional property extra is not allowed; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.32/#deploymentspec-v1-apps for more details"),
+			RawDetails:      github.String("* context: (root).spec\n* field: extra\n* property: extra\n* columns: 3-7\n"),
 		},
 		{
 			Path:            github.String("deployment.yaml"),
 			BlobHRef:        github.String("https://github.com/octocat/Hello-World/blob/837db83be4137ca555d9a5598d0a1ea2987ecfee/deployment.yaml"),
-			StartLine:       github.Int(1),
-			EndLine:         github.Int(1),
+			StartLine:       github.Int(9),
+			EndLine:         github.Int(9),
 			AnnotationLevel: github.String("failure"),
 			Title:           github.String("Error validating Deployment against master schema"),
-			Message:         github.String("spec.replicas: Invalid type. Expected: integer, given: string"),
-			RawDetails:      github.String("* context: (root).spec.replicas\n* expected: integer\n* field: spec.replicas\n* given: string\n"),
+			Message:         github.String("spec.replicas: Invalid type. Expected: integer, given: string; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.32/#deploymentspec-v1-apps for more details"),
+			RawDetails:      github.String("* context: (root).spec.replicas\n* expected: integer\n* field: spec.replicas\n* given: string\n* columns: 3-21\n"),
 		},
 		{
 			Path:            github.String("deployment.yaml"),
 			BlobHRef:        github.String("https://github.com/octocat/Hello-World/blob/837db83be4137ca555d9a5598d0a1ea2987ecfee/deployment.yaml"),
-			StartLine:       github.Int(1),
-			EndLine:         github.Int(1),
+			StartLine:       github.Int(23),
+			EndLine:         github.Int(23),
 			AnnotationLevel: github.String("failure"),
 			Title:           github.String("Error validating Deployment against master schema"),
-			Message:         github.String("extra-container: Additional property extra-container is not allowed"),
-			RawDetails:      github.String("* context: (root).spec.template.spec.containers.0\n* field: extra-container\n* property: extra-container\n"),
+			Message:         github.String("extra-container: Additional property extra-container is not allowed; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.32/#container-v1-core for more details"),
+			RawDetails:      github.String("* context: (root).spec.template.spec.containers.0\n* field: extra-container\n* property: extra-container\n* columns: 11-25\n"),
 		},
 	}
 
@@ -213,9 +213,7 @@ func TestLineNumbers(t *testing.T) {
 
 			ctx := context.Background()
 
-			schema := &KubeValidatorConfigSchema{
-				LineNumbers: true,
-			}
+			schema := &KubeValidatorConfigSchema{}
 			var schemas []*KubeValidatorConfigSchema
 			schemas = append(schemas, schema)
 
@@ -277,3 +275,55 @@ func TestLineNumbers(t *testing.T) {
 		return nil
 	})
 }
+
+func TestCandidatesLoadBytesUsesBlobCache(t *testing.T) {
+	client, mux, _, teardown := setup()
+	defer teardown()
+
+	fileContents, _ := ioutil.ReadFile("../fixtures/references/app.yaml")
+	loads := 0
+	mux.HandleFunc("/repos/o/r/contents/fixtures/references/app.yaml", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		loads++
+		fmt.Fprintf(w, `{
+			"type": "file",
+			"encoding": "base64",
+			"content": "%s"
+		}`, base64.StdEncoding.EncodeToString(fileContents))
+	})
+
+	ctx := context.Background()
+	e := &github.CheckSuiteEvent{
+		CheckSuite: &github.CheckSuite{
+			HeadSHA: github.String("abc"),
+		},
+		Repo: &github.Repository{
+			Name: github.String("r"),
+			Owner: &github.User{
+				Login: github.String("o"),
+			},
+		},
+	}
+	cache := NewBlobCache(0)
+	file := &github.CommitFile{
+		Filename: github.String("fixtures/references/app.yaml"),
+		SHA:      github.String("a1"),
+	}
+
+	for i := 0; i < 2; i++ {
+		c := &Context{Ctx: &ctx, Github: client, Event: e, BlobCache: cache}
+		// The same file matched by two manifests
+		candidates := Candidates{NewCandidate(c, file, nil), NewCandidate(c, file, nil)}
+		if annotations := candidates.LoadBytes(); len(annotations) != 0 {
+			t.Fatalf("unexpected annotations: %s", github.Stringify(annotations))
+		}
+		for _, candidate := range candidates {
+			if candidate.bytes == nil || !bytes.Equal(*candidate.bytes, fileContents) {
+				t.Errorf("expected candidate bytes to be loaded")
+			}
+		}
+	}
+	if loads != 1 {
+		t.Errorf("expected app.yaml to be loaded once, got %d", loads)
+	}
+}
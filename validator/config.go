@@ -2,7 +2,9 @@ package validator
 
 import (
 	"fmt"
+	"path/filepath"
 	"regexp"
+	"strings"
 
 	"github.com/bmatcuk/doublestar"
 	"github.com/google/go-github/github"
@@ -20,12 +22,96 @@ type KubeValidatorConfig struct {
 // KubeValidatorConfigSpec contains a list of manifests
 type KubeValidatorConfigSpec struct {
 	Manifests []*KubeValidatorConfigManifest `yaml:"manifests"`
+
+	// CRDs is a list of globs matching files which contain
+	// CustomResourceDefinitions. Custom resources are validated against the
+	// schemas of the CRDs found in these files and in the files being
+	// validated.
+	CRDs []string `yaml:"crds,omitempty"`
+
+	// Rules are custom assertions made about the resources in the files
+	// being validated
+	Rules []*KubeValidatorConfigRule `yaml:"rules,omitempty"`
+
+	// Severity overrides the level of the annotations reporting errors
+	Severity *KubeValidatorConfigSeverity `yaml:"severity,omitempty"`
+	// FailOn is the lowest level of annotation which fails the check run:
+	// notice, warning, failure or never. Defaults to failure. Failures which
+	// don't fail the check run conclude it as neutral.
+	FailOn string `yaml:"failOn,omitempty"`
+
+	// Docs maps API groups to templates of the URLs documenting their
+	// resources, which are linked to from annotations. Templates may contain
+	// {group}, {version}, {kind} and {field} placeholders, where field is
+	// the dotted path to the field an annotation refers to.
+	Docs map[string]string `yaml:"docs,omitempty"`
+	// DocsVersion is the major and minor version of the Kubernetes API
+	// reference linked to from annotations found with master schemas, like
+	// 1.32. Other schemas link to the reference for their own version.
+	DocsVersion string `yaml:"docsVersion,omitempty"`
+
+	// Scope is either changed, validating only the files changed by a pull
+	// request or push, or all, validating every file in the repository.
+	// Defaults to changed. Every file is validated when the configuration
+	// itself changes.
+	Scope string `yaml:"scope,omitempty"`
+
+	// ReportOn is either all, reporting every error, or changedLines,
+	// reporting only errors found on the lines added or changed.
+	// Defaults to all. Errors which aren't reported are counted in the
+	// summary of the check run.
+	ReportOn string `yaml:"reportOn,omitempty"`
+
+	// References lists the kinds of resource which references are expected
+	// to be defined in the files matching the manifest globs: ConfigMap,
+	// Secret, ServiceAccount, PersistentVolumeClaim or Service. Defaults to
+	// all but Secret, as Secrets are usually created outside of the
+	// repository.
+	References []string `yaml:"references,omitempty"`
+}
+
+// KubeValidatorConfigSeverity maps errors to the level of the annotations
+// reporting them: notice, warning or failure. Rules take precedence over
+// types, which take precedence over kinds.
+type KubeValidatorConfigSeverity struct {
+	// Types are keyed by the type of a schema error like
+	// additional_property_not_allowed, or one of parse_error, deprecated_api,
+	// duplicate_resource, dangling_reference or unmatched_selector
+	Types map[string]string `yaml:"types,omitempty"`
+	// Rules are keyed by the name of a rule
+	Rules map[string]string `yaml:"rules,omitempty"`
+	// Kinds are keyed by the kind of the resource containing an error
+	Kinds map[string]string `yaml:"kinds,omitempty"`
 }
 
-// KubeValidatorConfigManifest contains a glob and a list of schema
+// KubeValidatorConfigManifest contains a glob, a Helm chart or a kustomization
+// and a list of schema
 type KubeValidatorConfigManifest struct {
-	Glob    string                       `yaml:"glob"`
-	Schemas []*KubeValidatorConfigSchema `yaml:"schemas,omitempty"`
+	Glob string                   `yaml:"glob,omitempty"`
+	Helm *KubeValidatorConfigHelm `yaml:"helm,omitempty"`
+	// Kustomize is the path to a directory containing a kustomization.yaml
+	// which is built before validation
+	Kustomize string                       `yaml:"kustomize,omitempty"`
+	Schemas   []*KubeValidatorConfigSchema `yaml:"schemas,omitempty"`
+	// Scope overrides KubeValidatorConfigSpec.Scope for this manifest
+	Scope string `yaml:"scope,omitempty"`
+}
+
+// KubeValidatorConfigHelm points at a Helm chart which is rendered with each
+// of its values files before validation
+type KubeValidatorConfigHelm struct {
+	// Chart is the path to the chart's directory
+	Chart string `yaml:"chart"`
+	// Values is a list of values files applied on top of the chart's
+	// values.yaml. The chart is rendered once for each of them, or once with
+	// its default values if none are listed.
+	Values []string `yaml:"values,omitempty"`
+
+	ReleaseName string `yaml:"releaseName,omitempty"`
+	Namespace   string `yaml:"namespace,omitempty"`
+	// KubeVersion is the version of Kubernetes reported to the chart's
+	// templates. Defaults to the version of the manifest's first schema.
+	KubeVersion string `yaml:"kubeVersion,omitempty"`
 }
 
 // KubeValidatorConfigSchema contains options for kubeval
@@ -33,18 +119,74 @@ type KubeValidatorConfigSchema struct {
 	Name       string `yaml:"name,omitempty"`
 	SchemaFork string `yaml:"schemaFork,omitempty"`
 
-	Version     string `yaml:"version,omitempty"`
-	ConfigType  string `yaml:"type,omitempty"`
-	LineNumbers bool   `yaml:"lineNumbers,omitempty"`
+	// SchemaPath points at a directory of schemas relative to the schema
+	// directory configured on this instance of kubevalidator, allowing
+	// validation without network access.
+	SchemaPath string `yaml:"schemaPath,omitempty"`
+
+	Version    string `yaml:"version,omitempty"`
+	ConfigType string `yaml:"type,omitempty"`
+	// LineNumbers points annotations at the lines containing errors rather
+	// than the first line of the file. Defaults to true.
+	LineNumbers *bool `yaml:"lineNumbers,omitempty"`
+
+	// Strict prohibits properties that aren't in the schema. Defaults to true.
+	Strict *bool `yaml:"strict,omitempty"`
+	// IgnoreMissingSchemas reports resources for which no schema can be found
+	// as notices rather than failures
+	IgnoreMissingSchemas bool `yaml:"ignoreMissingSchemas,omitempty"`
+	// SkipKinds lists kinds which shouldn't be validated
+	SkipKinds []string `yaml:"skipKinds,omitempty"`
+	// OnlyKinds lists the only kinds which should be validated
+	OnlyKinds []string `yaml:"onlyKinds,omitempty"`
 }
 
-func (config *KubeValidatorConfig) matchingCandidates(context *Context, files []*github.CommitFile) []*Candidate {
+// KubeValidatorConfigRule asserts something about the value found at a path in
+// each of the resources it selects
+type KubeValidatorConfigRule struct {
+	Name string `yaml:"name,omitempty"`
+
+	// Kinds limits the rule to resources of these kinds
+	Kinds []string `yaml:"kinds,omitempty"`
+	// Selector limits the rule to resources with all of these labels
+	Selector map[string]string `yaml:"selector,omitempty"`
+
+	// Path to the field being asserted on, like
+	// spec.template.spec.containers[*].image
+	Path string `yaml:"path"`
+	// Operator is one of exists, not-exists, equals, not-equals, matches,
+	// not-matches, in, not-in, gt, gte, lt or lte
+	Operator string        `yaml:"operator"`
+	Value    interface{}   `yaml:"value,omitempty"`
+	Values   []interface{} `yaml:"values,omitempty"`
+
+	Message string `yaml:"message,omitempty"`
+	// Severity is the level of the annotations created when the rule isn't
+	// satisfied: notice, warning or failure. Defaults to failure.
+	Severity string `yaml:"severity,omitempty"`
+}
+
+// matchingCandidates returns a Candidate for each changed file matching a
+// manifest's glob. Manifests validating every file are also matched against
+// the files in the tree which haven't changed.
+func (config *KubeValidatorConfig) matchingCandidates(context *Context, files []*github.CommitFile, tree []*github.CommitFile) []*Candidate {
 	var candidates []*Candidate
 
-	for _, file := range files {
+	changed := changedFileSet(files)
+	allFiles := files
+	for _, file := range tree {
+		if !changed[file.GetFilename()] {
+			allFiles = append(allFiles, file)
+		}
+	}
+
+	for _, file := range allFiles {
 		if config.Spec != nil {
 			spec := *config.Spec
 			for _, manifestConfig := range spec.Manifests {
+				if !changed[file.GetFilename()] && !config.validatesAll(manifestConfig, changed) {
+					continue
+				}
 				if matched, _ := doublestar.Match(manifestConfig.Glob, file.GetFilename()); matched {
 					candidate := NewCandidate(context, file, manifestConfig.Schemas)
 					candidates = append(candidates, candidate)
@@ -56,28 +198,322 @@ func (config *KubeValidatorConfig) matchingCandidates(context *Context, files []
 	return candidates
 }
 
+// validatesAll determines whether or not every file matching a manifest is
+// validated rather than only those which have changed
+func (config *KubeValidatorConfig) validatesAll(manifest *KubeValidatorConfigManifest, changed map[string]bool) bool {
+	scope := manifest.Scope
+	if scope == "" && config.Spec != nil {
+		scope = config.Spec.Scope
+	}
+	return scope == "all" || changed[configPath]
+}
+
+// changedFileSet indexes the names of the changed files
+func changedFileSet(changedFiles []*github.CommitFile) map[string]bool {
+	changed := make(map[string]bool)
+	for _, file := range changedFiles {
+		changed[file.GetFilename()] = true
+	}
+	return changed
+}
+
+// needsTree determines whether or not any of the globbed manifests validates
+// every file, which requires listing the files in the tree
+func (config *KubeValidatorConfig) needsTree(changedFiles []*github.CommitFile) bool {
+	if config.Spec == nil {
+		return false
+	}
+	changed := changedFileSet(changedFiles)
+	for _, manifest := range config.Spec.Manifests {
+		if manifest.Glob != "" && config.validatesAll(manifest, changed) {
+			return true
+		}
+	}
+	return false
+}
+
+// manifestFiles returns the files which match a manifest glob
+func (config *KubeValidatorConfig) manifestFiles(files []*github.CommitFile) []*github.CommitFile {
+	var manifestFiles []*github.CommitFile
+	if config.Spec == nil {
+		return manifestFiles
+	}
+	for _, file := range files {
+		for _, manifestConfig := range config.Spec.Manifests {
+			if matched, _ := doublestar.Match(manifestConfig.Glob, file.GetFilename()); matched {
+				manifestFiles = append(manifestFiles, file)
+				break
+			}
+		}
+	}
+	return manifestFiles
+}
+
+// rules returns the configured rules
+func (config *KubeValidatorConfig) rules() []*KubeValidatorConfigRule {
+	if config.Spec == nil {
+		return nil
+	}
+	return config.Spec.Rules
+}
+
+// severity returns the configured severity overrides
+func (config *KubeValidatorConfig) severity() *KubeValidatorConfigSeverity {
+	if config.Spec == nil {
+		return nil
+	}
+	return config.Spec.Severity
+}
+
+// failOn returns the lowest level of annotation which fails the check run
+func (config *KubeValidatorConfig) failOn() string {
+	if config.Spec == nil || config.Spec.FailOn == "" {
+		return "failure"
+	}
+	return config.Spec.FailOn
+}
+
+// reportsChangedLinesOnly returns whether or not only errors on the lines
+// changed by a pull request or push should be reported
+func (config *KubeValidatorConfig) reportsChangedLinesOnly() bool {
+	return config.Spec != nil && config.Spec.ReportOn == "changedLines"
+}
+
+// referencedKinds returns the kinds of resource which references are
+// expected to be defined in the repository
+func (config *KubeValidatorConfig) referencedKinds() []string {
+	if config.Spec == nil || len(config.Spec.References) == 0 {
+		return defaultReferencedKinds
+	}
+	return config.Spec.References
+}
+
+// docs returns the configured documentation URL templates
+func (config *KubeValidatorConfig) docs() map[string]string {
+	if config.Spec == nil {
+		return nil
+	}
+	return config.Spec.Docs
+}
+
+// docsVersion returns the configured version of the Kubernetes API reference
+func (config *KubeValidatorConfig) docsVersion() string {
+	if config.Spec == nil {
+		return ""
+	}
+	return config.Spec.DocsVersion
+}
+
+// crdFiles returns the files which match a CRD glob
+func (config *KubeValidatorConfig) crdFiles(files []*github.CommitFile) []*github.CommitFile {
+	var crdFiles []*github.CommitFile
+	if config.Spec == nil {
+		return crdFiles
+	}
+	for _, file := range files {
+		for _, glob := range config.Spec.CRDs {
+			if matched, _ := doublestar.Match(glob, file.GetFilename()); matched {
+				crdFiles = append(crdFiles, file)
+				break
+			}
+		}
+	}
+	return crdFiles
+}
+
+// docsVersionRe matches the major and minor version of a Kubernetes release
+var docsVersionRe = regexp.MustCompile(`^\d+\.\d+$`)
+
 // Valid returns a boolean indicatating whether or not the config is well formed
 // TODO replace me with an actual schema
 func (config *KubeValidatorConfig) Valid() bool {
 	re := regexp.MustCompile(`(?mi)^[a-z][a-z\-]{0,38}$`)
 	if config.Spec != nil {
 		spec := *config.Spec
+		if !validScope(spec.Scope) {
+			return false
+		}
 		for _, manifest := range spec.Manifests {
+			if !manifest.hasSingleSource() {
+				return false
+			}
+			if !validScope(manifest.Scope) {
+				return false
+			}
+			if manifest.Helm != nil && !manifest.Helm.valid() {
+				return false
+			}
+			if manifest.Kustomize != "" && !validRelativePath(manifest.Kustomize) {
+				return false
+			}
 			for _, schema := range manifest.Schemas {
 				if schema.SchemaFork != "" && !re.MatchString(schema.SchemaFork) {
 					return false
 				}
+				if schema.SchemaFork != "" && schema.SchemaPath != "" {
+					return false
+				}
+				if schema.SchemaPath != "" && !validRelativePath(schema.SchemaPath) {
+					return false
+				}
+				if len(schema.SkipKinds) > 0 && len(schema.OnlyKinds) > 0 {
+					return false
+				}
+			}
+		}
+		for _, rule := range spec.Rules {
+			if !rule.valid() {
+				return false
+			}
+		}
+		if spec.Severity != nil && !spec.Severity.valid() {
+			return false
+		}
+		for _, template := range spec.Docs {
+			if !strings.HasPrefix(template, "https://") && !strings.HasPrefix(template, "http://") {
+				return false
+			}
+		}
+		if spec.DocsVersion != "" && !docsVersionRe.MatchString(spec.DocsVersion) {
+			return false
+		}
+		switch spec.FailOn {
+		case "", "notice", "warning", "failure", "never":
+		default:
+			return false
+		}
+		switch spec.ReportOn {
+		case "", "all", "changedLines":
+		default:
+			return false
+		}
+		for _, kind := range spec.References {
+			if !referenceableKinds[kind] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// validScope determines whether or not a scope is empty, changed or all
+func validScope(scope string) bool {
+	switch scope {
+	case "", "changed", "all":
+		return true
+	}
+	return false
+}
+
+// hasSingleSource determines whether or not exactly one of a glob, a chart or a
+// kustomization is configured
+func (manifest *KubeValidatorConfigManifest) hasSingleSource() bool {
+	sources := 0
+	if manifest.Glob != "" {
+		sources++
+	}
+	if manifest.Helm != nil {
+		sources++
+	}
+	if manifest.Kustomize != "" {
+		sources++
+	}
+	return sources == 1
+}
+
+// valid returns a boolean indicating whether or not the chart's paths are
+// well formed
+func (helm *KubeValidatorConfigHelm) valid() bool {
+	if helm.Chart == "" || !validRelativePath(helm.Chart) {
+		return false
+	}
+	for _, values := range helm.Values {
+		if values == "" || !validRelativePath(values) {
+			return false
+		}
+	}
+	return true
+}
+
+// valid returns a boolean indicating whether or not each of the levels is one
+// of notice, warning or failure
+func (severity *KubeValidatorConfigSeverity) valid() bool {
+	for _, levels := range []map[string]string{severity.Types, severity.Rules, severity.Kinds} {
+		for _, level := range levels {
+			if annotationLevels[level] == 0 || level == "never" {
+				return false
 			}
 		}
 	}
 	return true
 }
 
-// SchemaLocation composes SchemaFork with a base url
-func (schema *KubeValidatorConfigSchema) SchemaLocation() string {
+// level returns the configured level of the annotation reporting an error of
+// errorType, found by the named rule in a resource of kind, or defaultLevel
+// if none has been configured. Any of errorType, rule and kind may be empty.
+func (severity *KubeValidatorConfigSeverity) level(errorType string, rule string, kind string, defaultLevel string) string {
+	if severity == nil {
+		return defaultLevel
+	}
+	if level, ok := severity.Rules[rule]; ok && rule != "" {
+		return level
+	}
+	if level, ok := severity.Types[errorType]; ok && errorType != "" {
+		return level
+	}
+	if level, ok := severity.Kinds[kind]; ok && kind != "" {
+		return level
+	}
+	return defaultLevel
+}
+
+// displayName returns the name used to refer to a schema in check runs
+func (schema *KubeValidatorConfigSchema) displayName() string {
+	if schema.Name != "" {
+		return schema.Name
+	} else if schema.Version != "" {
+		return schema.Version
+	}
+	return "master"
+}
+
+// strict returns whether or not additional properties should be prohibited
+func (schema *KubeValidatorConfigSchema) strict() bool {
+	return schema.Strict == nil || *schema.Strict
+}
+
+// lineNumbers returns whether or not annotations should point at the lines
+// containing errors
+func (schema *KubeValidatorConfigSchema) lineNumbers() bool {
+	return schema.LineNumbers == nil || *schema.LineNumbers
+}
+
+// validRelativePath ensures a path like a SchemaPath can't escape the
+// directory it's relative to
+func validRelativePath(path string) bool {
+	if strings.HasPrefix(path, "file://") || filepath.IsAbs(path) {
+		return false
+	}
+	for _, component := range strings.Split(filepath.ToSlash(path), "/") {
+		if component == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// SchemaLocation composes SchemaFork with a base url. Schemas are loaded from
+// schemaDir instead of the network when it is set and SchemaFork isn't.
+func (schema *KubeValidatorConfigSchema) SchemaLocation(schemaDir string) string {
 	schemaFork := schema.SchemaFork
-	if schemaFork == "" {
-		return kubeval.DefaultSchemaLocation
+	if schemaFork != "" {
+		return fmt.Sprintf("https://raw.githubusercontent.com/%s/kubernetes-json-schema/master", schemaFork)
+	}
+	if schemaDir != "" {
+		return fmt.Sprintf("file://%s", filepath.ToSlash(filepath.Join(schemaDir, schema.SchemaPath)))
+	}
+	if schema.ConfigType == "openshift" {
+		return kubeval.OpenShiftSchemaLocation
 	}
-	return fmt.Sprintf("https://raw.githubusercontent.com/%s/kubernetes-json-schema/master", schemaFork)
+	return kubeval.DefaultSchemaLocation
 }
@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/go-test/deep"
 	"github.com/google/go-github/github"
 	yaml "gopkg.in/yaml.v2"
 )
@@ -32,7 +33,7 @@ func TestValidConfigMatchesCandidates(t *testing.T) {
 	files = append(files, &github.CommitFile{
 		Filename: github.String("README.md"),
 	})
-	candidates := config.matchingCandidates(&Context{}, files)
+	candidates := config.matchingCandidates(&Context{}, files, nil)
 	if len(candidates) != 1 {
 		t.Errorf("Expected 1 match, got %d", len(candidates))
 	}
@@ -45,7 +46,7 @@ func TestEmptyConfigMatchesNothing(t *testing.T) {
 		Filename: github.String("important.yaml"),
 	}
 	files = append(files, file)
-	candidates := config.matchingCandidates(&Context{}, files)
+	candidates := config.matchingCandidates(&Context{}, files, nil)
 	if len(candidates) != 0 {
 		t.Errorf("found unexpected candidates! %v", candidates)
 	}
@@ -66,3 +67,184 @@ func TestInvalidConfigIsNotValid(t *testing.T) {
 		return
 	}
 }
+
+func TestSchemaPathOutsideSchemaDirIsNotValid(t *testing.T) {
+	filePath, _ := filepath.Abs("../fixtures/invalid/kubevalidator/schemaPath.yaml")
+	fileContents, _ := ioutil.ReadFile(filePath)
+	config := &KubeValidatorConfig{}
+	err := yaml.Unmarshal(fileContents, config)
+	if err != nil {
+		t.Errorf("Unmarshaling kubevalidator.yaml failed with %v", err)
+		return
+	}
+	if config.Valid() {
+		t.Errorf("Config expected to be invalid: %+v", config)
+		return
+	}
+}
+
+func TestSchemaLocation(t *testing.T) {
+	tests := []struct {
+		schema    *KubeValidatorConfigSchema
+		schemaDir string
+		want      string
+	}{
+		{&KubeValidatorConfigSchema{}, "", "https://kubernetesjsonschema.dev"},
+		{&KubeValidatorConfigSchema{SchemaFork: "garethr"}, "/schemas", "https://raw.githubusercontent.com/garethr/kubernetes-json-schema/master"},
+		{&KubeValidatorConfigSchema{}, "/schemas", "file:///schemas"},
+		{&KubeValidatorConfigSchema{SchemaPath: "openshift"}, "/schemas", "file:///schemas/openshift"},
+	}
+	for _, test := range tests {
+		if got := test.schema.SchemaLocation(test.schemaDir); got != test.want {
+			t.Errorf("expected %s, got %s", test.want, got)
+		}
+	}
+}
+
+func TestSkipKindsAndOnlyKindsAreNotValidTogether(t *testing.T) {
+	config := &KubeValidatorConfig{
+		Spec: &KubeValidatorConfigSpec{
+			Manifests: []*KubeValidatorConfigManifest{
+				{
+					Glob: "*.yaml",
+					Schemas: []*KubeValidatorConfigSchema{
+						{
+							SkipKinds: []string{"Secret"},
+							OnlyKinds: []string{"Deployment"},
+						},
+					},
+				},
+			},
+		},
+	}
+	if config.Valid() {
+		t.Errorf("Config expected to be invalid: %+v", config)
+	}
+}
+
+func TestInvalidSeverityIsNotValid(t *testing.T) {
+	tests := []*KubeValidatorConfigSpec{
+		{Severity: &KubeValidatorConfigSeverity{Types: map[string]string{"required": "fatal"}}},
+		{Severity: &KubeValidatorConfigSeverity{Kinds: map[string]string{"Secret": "never"}}},
+		{FailOn: "error"},
+	}
+	for _, spec := range tests {
+		config := &KubeValidatorConfig{Spec: spec}
+		if config.Valid() {
+			t.Errorf("Config expected to be invalid: %+v", spec)
+		}
+	}
+}
+
+func TestSeverityLevel(t *testing.T) {
+	severity := &KubeValidatorConfigSeverity{
+		Types: map[string]string{"required": "warning"},
+		Rules: map[string]string{"no-latest": "notice"},
+		Kinds: map[string]string{"CronTab": "notice", "Deployment": "warning"},
+	}
+	tests := []struct {
+		errorType string
+		rule      string
+		kind      string
+		want      string
+	}{
+		{"required", "", "Service", "warning"},
+		{"required", "", "CronTab", "warning"},
+		{"invalid_type", "", "CronTab", "notice"},
+		{"invalid_type", "", "Service", "failure"},
+		{"", "no-latest", "Deployment", "notice"},
+		{"", "replicas", "Deployment", "warning"},
+		{"", "", "", "failure"},
+	}
+	for _, test := range tests {
+		if level := severity.level(test.errorType, test.rule, test.kind, "failure"); level != test.want {
+			t.Errorf("%+v: expected %s, got %s", test, test.want, level)
+		}
+	}
+
+	var unconfigured *KubeValidatorConfigSeverity
+	if level := unconfigured.level("required", "", "", "warning"); level != "warning" {
+		t.Errorf("expected the default level, got %s", level)
+	}
+}
+
+func TestScopeMatchesCandidatesInTree(t *testing.T) {
+	config := &KubeValidatorConfig{
+		Spec: &KubeValidatorConfigSpec{
+			Manifests: []*KubeValidatorConfigManifest{
+				{Glob: "changed/*.yaml"},
+				{Glob: "all/*.yaml", Scope: "all"},
+			},
+		},
+	}
+	changed := []*github.CommitFile{
+		{Filename: github.String("changed/a.yaml"), Patch: github.String("@@ -0,0 +1 @@")},
+		{Filename: github.String("all/a.yaml"), Patch: github.String("@@ -0,0 +1 @@")},
+	}
+	tree := []*github.CommitFile{
+		{Filename: github.String("changed/a.yaml")},
+		{Filename: github.String("changed/b.yaml")},
+		{Filename: github.String("all/a.yaml")},
+		{Filename: github.String("all/b.yaml")},
+	}
+	names := func(candidates []*Candidate) []string {
+		var names []string
+		for _, candidate := range candidates {
+			names = append(names, candidate.file.GetFilename())
+		}
+		return names
+	}
+
+	if !config.needsTree(changed) {
+		t.Error("expected a manifest with a scope of all to need the tree")
+	}
+	candidates := config.matchingCandidates(&Context{}, changed, tree)
+	if diff := deep.Equal(names(candidates), []string{"changed/a.yaml", "all/a.yaml", "all/b.yaml"}); diff != nil {
+		t.Error(diff)
+	}
+	if candidates[1].file.GetPatch() == "" {
+		t.Error("expected changed files to keep their patches")
+	}
+
+	// Every file is validated when the configuration changes
+	config.Spec.Manifests[1].Scope = "changed"
+	if config.needsTree(changed) {
+		t.Error("expected manifests with a scope of changed not to need the tree")
+	}
+	changed = append(changed, &github.CommitFile{Filename: github.String(configPath)})
+	candidates = config.matchingCandidates(&Context{}, changed, tree)
+	if diff := deep.Equal(names(candidates), []string{"changed/a.yaml", "all/a.yaml", "changed/b.yaml", "all/b.yaml"}); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestInvalidScopeIsNotValid(t *testing.T) {
+	config := &KubeValidatorConfig{
+		Spec: &KubeValidatorConfigSpec{Scope: "everything"},
+	}
+	if config.Valid() {
+		t.Error("expected an unknown scope to be invalid")
+	}
+	config.Spec.Scope = "all"
+	config.Spec.Manifests = []*KubeValidatorConfigManifest{{Glob: "*.yaml", Scope: "some"}}
+	if config.Valid() {
+		t.Error("expected an unknown manifest scope to be invalid")
+	}
+	config.Spec.Manifests[0].Scope = "changed"
+	if !config.Valid() {
+		t.Error("expected known scopes to be valid")
+	}
+}
+
+func TestInvalidReportOnIsNotValid(t *testing.T) {
+	config := &KubeValidatorConfig{
+		Spec: &KubeValidatorConfigSpec{ReportOn: "changedFiles"},
+	}
+	if config.Valid() {
+		t.Error("expected an unknown reportOn to be invalid")
+	}
+	config.Spec.ReportOn = "changedLines"
+	if !config.Valid() || !config.reportsChangedLinesOnly() {
+		t.Error("expected changedLines to be valid")
+	}
+}
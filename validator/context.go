@@ -2,6 +2,7 @@ package validator
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"reflect"
 	"time"
@@ -12,11 +13,37 @@ import (
 
 // Context contains an event payload an a configured client
 type Context struct {
-	Event     interface{}
-	Github    *github.Client
-	Ctx       *context.Context
-	AppID     *int
-	AppGitHub *github.Client
+	Event       interface{}
+	Github      *github.Client
+	Ctx         *context.Context
+	AppID       *int
+	AppGitHub   *github.Client
+	SchemaDir   string
+	SchemaCache *SchemaCache
+	BlobCache   *BlobCache
+
+	checkRunID  int64
+	crds        *crdRegistry
+	tree        []*github.CommitFile
+	treeSizes   map[string]int
+	severity    *KubeValidatorConfigSeverity
+	docs        map[string]string
+	docsVersion string
+	compiled    *compiledSchemas
+}
+
+// schemaLoader returns the schemaLoader used to validate candidates
+func (c *Context) schemaLoader() schemaLoader {
+	return &defaultSchemaLoader{cache: c.SchemaCache}
+}
+
+// compiledSchemas returns the schemas compiled while validating the check
+// suite's candidates, so that each is only compiled once
+func (c *Context) compiledSchemas() *compiledSchemas {
+	if c.compiled == nil {
+		c.compiled = newCompiledSchemas()
+	}
+	return c.compiled
 }
 
 // Process handles webhook events kinda like Probot does
@@ -50,7 +77,7 @@ func (c *Context) Process() bool {
 }
 
 // ProcessCheckSuite validates the Kubernetes YAML that has changed on checks
-// associated with PRs.
+// associated with PRs, or on pushes to branches without them.
 func (c *Context) ProcessCheckSuite(e *github.CheckSuiteEvent) {
 	if *e.Action == "created" || *e.Action == "requested" || *e.Action == "rerequested" {
 		createCheckRunErr := c.createInitialCheckRun(e)
@@ -61,6 +88,7 @@ func (c *Context) ProcessCheckSuite(e *github.CheckSuiteEvent) {
 		}
 
 		checkRunStart := time.Now()
+		defer c.failCheckRunOnPanic(&checkRunStart, e)
 		var annotations []*github.CheckRunAnnotation
 		var candidates Candidates
 
@@ -75,25 +103,67 @@ func (c *Context) ProcessCheckSuite(e *github.CheckSuiteEvent) {
 			return
 		}
 
+		c.severity = config.severity()
+		c.docs = config.docs()
+		c.docsVersion = config.docsVersion()
+
 		// Determine which files to validate
+		c.reportProgress(e, "Finding files to validate...")
 		changedFileList, fileListError := c.changedFileList(e)
 		if fileListError != nil {
-			// TODO fail the checkrun instead
 			log.Println(fileListError)
+			c.createErrorCheckRun(&checkRunStart, e, "Couldn't list changed files", fileListError)
 			return
 		}
 
-		candidates = config.matchingCandidates(c, changedFileList)
+		var tree []*github.CommitFile
+		if config.needsTree(changedFileList) {
+			tree, err = c.treeFileList(e)
+			if err != nil {
+				annotations = append(annotations, configErrorAnnotation(e, "Error listing files", err))
+			}
+		}
+		candidates = config.matchingCandidates(c, changedFileList, tree)
+		renderedCandidates, renderAnnotations := c.renderHelmCharts(e, config, changedFileList)
+		candidates = append(candidates, renderedCandidates...)
+		annotations = append(annotations, renderAnnotations...)
+		builtCandidates, buildAnnotations := c.buildKustomizations(e, config, changedFileList)
+		candidates = append(candidates, builtCandidates...)
+		annotations = append(annotations, buildAnnotations...)
+		filesString := "files"
+		if len(candidates) == 1 {
+			filesString = "file"
+		}
+		c.reportProgress(e, fmt.Sprintf("Validating %d %s...", len(candidates), filesString))
 		annotations = append(annotations, candidates.LoadBytes()...)
+		annotations = append(annotations, c.loadCustomResourceDefinitions(e, config, candidates)...)
 		annotations = append(annotations, candidates.Validate()...)
+		c.reportProgress(e, "Checking rules and references between resources...")
+		annotations = append(annotations, candidates.EvaluateRules(config.rules())...)
+		index, indexAnnotations := c.indexResources(e, config, candidates)
+		annotations = append(annotations, indexAnnotations...)
+		annotations = append(annotations, index.danglingReferences(config.referencedKinds())...)
+		annotations = append(annotations, index.duplicateResources()...)
+
+		var unreported Annotations
+		if config.reportsChangedLinesOnly() {
+			annotations, unreported = Annotations(annotations).onChangedLines(changedFileList)
+		}
 
 		// Annotate the PR
-		finalCheckRunErr := c.createFinalCheckRun(&checkRunStart, e, candidates, annotations)
+		finalCheckRunErr := c.createFinalCheckRun(&checkRunStart, e, candidates, annotations, unreported, changedFileList, config.failOn())
 		if finalCheckRunErr != nil {
 			// TODO return a 500 to signal that retry is preferred
-			log.Println(errors.Wrap(finalCheckRunErr, "Couldn't create check run"))
+			log.Println(errors.Wrap(finalCheckRunErr, "Couldn't complete check run"))
+			c.createErrorCheckRun(&checkRunStart, e, "Couldn't report results", finalCheckRunErr)
 			return
 		}
+
+		// Suggest fixes for the errors that can be fixed mechanically
+		reviewErr := c.createReviews(e, candidates)
+		if reviewErr != nil {
+			log.Println(reviewErr)
+		}
 	}
 	return
 }
@@ -2,9 +2,13 @@ package validator
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-github/github"
 )
@@ -145,3 +149,392 @@ func TestReRequestedCheckRunReRequestsTheCheckSuite(t *testing.T) {
 	}
 	return
 }
+
+func TestFinalCheckRunPaginatesAnnotations(t *testing.T) {
+	e := &github.CheckSuiteEvent{
+		CheckSuite: &github.CheckSuite{
+			HeadSHA: github.String("abc"),
+		},
+		Repo: &github.Repository{
+			Owner: &github.User{
+				Login: github.String("o"),
+			},
+			Name: github.String("r"),
+		},
+	}
+	client, mux, _, teardown := setup()
+	defer teardown()
+	ctx := context.Background()
+	c := &Context{
+		Ctx:    &ctx,
+		Event:  e,
+		Github: client,
+	}
+
+	var annotations []*github.CheckRunAnnotation
+	for i := 0; i < maxAnnotations+10; i++ {
+		annotations = append(annotations, &github.CheckRunAnnotation{
+			Path:            github.String("a.yaml"),
+			StartLine:       github.Int(i + 1),
+			EndLine:         github.Int(i + 1),
+			AnnotationLevel: github.String("failure"),
+			Title:           github.String("Invalid"),
+			Message:         github.String("Invalid"),
+		})
+	}
+	candidates := Candidates{NewCandidate(c, &github.CommitFile{Filename: github.String("a.yaml")}, nil)}
+
+	created := 0
+	mux.HandleFunc("/repos/o/r/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "POST")
+		opt := &github.CreateCheckRunOptions{}
+		json.NewDecoder(r.Body).Decode(opt)
+		if opt.GetStatus() != "in_progress" || len(opt.Output.Annotations) != 0 {
+			t.Errorf("expected the check run to be created in progress without annotations, got %s", github.Stringify(opt))
+		}
+		created++
+		fmt.Fprint(w, `{"id": 1}`)
+	})
+	var updates []*github.UpdateCheckRunOptions
+	mux.HandleFunc("/repos/o/r/check-runs/1", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "PATCH")
+		opt := &github.UpdateCheckRunOptions{}
+		json.NewDecoder(r.Body).Decode(opt)
+		if opt.Name != checkRunName {
+			t.Errorf("expected the name %s, got %s", checkRunName, opt.Name)
+		}
+		if len(opt.Output.Annotations) != annotationsPerRequest {
+			t.Errorf("expected %d annotations, got %d", annotationsPerRequest, len(opt.Output.Annotations))
+		}
+		if title := opt.Output.GetTitle(); title != "1 file checked, 1010 errors" {
+			t.Errorf("expected the title to count every annotation, got %s", title)
+		}
+		if !strings.Contains(opt.Output.GetSummary(), "Only 1000 of the 1010 annotations are shown") {
+			t.Errorf("expected the summary to explain the overflow, got %s", opt.Output.GetSummary())
+		}
+		if !strings.Contains(opt.Output.GetText(), "`a.yaml:1010`") {
+			t.Errorf("expected the text to list the overflow, got %s", opt.Output.GetText())
+		}
+		updates = append(updates, opt)
+		fmt.Fprint(w, `{"id": 1}`)
+	})
+
+	startedAt := time.Now()
+	if err := c.createFinalCheckRun(&startedAt, e, candidates, annotations, nil, nil, "failure"); err != nil {
+		t.Fatal(err)
+	}
+	if created != 1 {
+		t.Errorf("expected a check run to be created, got %d", created)
+	}
+	if len(updates) != maxAnnotations/annotationsPerRequest {
+		t.Fatalf("expected %d updates, got %d", maxAnnotations/annotationsPerRequest, len(updates))
+	}
+	// Only the last update completes the check run
+	for i, update := range updates {
+		last := i == len(updates)-1
+		if last && (update.GetStatus() != "completed" || update.GetConclusion() != "failure" || update.CompletedAt == nil) {
+			t.Errorf("expected the last update to complete the check run, got %s", github.Stringify(update))
+		}
+		if !last && (update.GetStatus() != "in_progress" || update.Conclusion != nil || update.CompletedAt != nil) {
+			t.Errorf("expected update %d to leave the check run in progress, got %s", i, github.Stringify(update))
+		}
+	}
+}
+
+func TestCheckRunIsUpdatedInPlace(t *testing.T) {
+	e := &github.CheckSuiteEvent{
+		CheckSuite: &github.CheckSuite{
+			HeadSHA: github.String("abc"),
+		},
+		Repo: &github.Repository{
+			Owner: &github.User{
+				Login: github.String("o"),
+			},
+			Name: github.String("r"),
+		},
+	}
+	client, mux, _, teardown := setup()
+	defer teardown()
+	ctx := context.Background()
+	c := &Context{
+		Ctx:    &ctx,
+		Event:  e,
+		Github: client,
+	}
+
+	creates := 0
+	mux.HandleFunc("/repos/o/r/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "POST")
+		creates++
+		fmt.Fprint(w, `{"id": 7}`)
+	})
+	var statuses []string
+	mux.HandleFunc("/repos/o/r/check-runs/7", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "PATCH")
+		opt := &github.UpdateCheckRunOptions{}
+		json.NewDecoder(r.Body).Decode(opt)
+		statuses = append(statuses, fmt.Sprintf("%s:%s", opt.GetStatus(), opt.GetConclusion()))
+		fmt.Fprint(w, `{"id": 7}`)
+	})
+
+	startedAt := time.Now()
+	if err := c.createInitialCheckRun(e); err != nil {
+		t.Fatal(err)
+	}
+	c.reportProgress(e, "Validating 1 file...")
+	if err := c.createConfigMissingCheckRun(&startedAt, e); err != nil {
+		t.Fatal(err)
+	}
+	if creates != 1 {
+		t.Errorf("expected a single check run to be created, got %d", creates)
+	}
+	if fmt.Sprint(statuses) != "[in_progress: completed:neutral]" {
+		t.Errorf("expected the check run to progress and then complete, got %v", statuses)
+	}
+}
+
+func TestCheckRunFailsOnPanic(t *testing.T) {
+	e := &github.CheckSuiteEvent{
+		CheckSuite: &github.CheckSuite{
+			HeadSHA: github.String("abc"),
+		},
+		Repo: &github.Repository{
+			Owner: &github.User{
+				Login: github.String("o"),
+			},
+			Name: github.String("r"),
+		},
+	}
+	client, mux, _, teardown := setup()
+	defer teardown()
+	ctx := context.Background()
+	c := &Context{
+		Ctx:        &ctx,
+		Event:      e,
+		Github:     client,
+		checkRunID: 7,
+	}
+
+	conclusion := ""
+	mux.HandleFunc("/repos/o/r/check-runs/7", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "PATCH")
+		opt := &github.UpdateCheckRunOptions{}
+		json.NewDecoder(r.Body).Decode(opt)
+		conclusion = opt.GetConclusion()
+		fmt.Fprint(w, `{"id": 7}`)
+	})
+
+	startedAt := time.Now()
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Errorf("expected the panic to be re-raised, got %v", r)
+			}
+		}()
+		defer c.failCheckRunOnPanic(&startedAt, e)
+		panic("boom")
+	}()
+	if conclusion != "failure" {
+		t.Errorf("expected the check run to fail, got %q", conclusion)
+	}
+}
+
+func TestCheckRunFailsWhenChangedFilesCantBeListed(t *testing.T) {
+	e := &github.CheckSuiteEvent{
+		Action: github.String("requested"),
+		CheckSuite: &github.CheckSuite{
+			HeadSHA: github.String("abc"),
+			PullRequests: []*github.PullRequest{
+				{Number: github.Int(1)},
+			},
+		},
+		Repo: &github.Repository{
+			Owner: &github.User{
+				Login: github.String("o"),
+			},
+			Name: github.String("r"),
+		},
+	}
+	client, mux, _, teardown := setup()
+	defer teardown()
+	ctx := context.Background()
+	c := &Context{
+		Ctx:    &ctx,
+		Event:  e,
+		Github: client,
+	}
+
+	mux.HandleFunc("/repos/o/r/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "POST")
+		fmt.Fprint(w, `{"id": 7}`)
+	})
+	var statuses []string
+	mux.HandleFunc("/repos/o/r/check-runs/7", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "PATCH")
+		opt := &github.UpdateCheckRunOptions{}
+		json.NewDecoder(r.Body).Decode(opt)
+		statuses = append(statuses, fmt.Sprintf("%s:%s", opt.GetStatus(), opt.GetConclusion()))
+		fmt.Fprint(w, `{"id": 7}`)
+	})
+	mux.HandleFunc("/repos/o/r/contents/.github/kubevalidator.yaml", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		fmt.Fprint(w, `{"type": "file", "encoding": "base64", "content": "`+base64.StdEncoding.EncodeToString([]byte("apiversion: v1alpha\nkind: KubeValidatorConfig\nspec:\n  manifests:\n  - glob: fixtures/*.yaml\n"))+`"}`)
+	})
+	mux.HandleFunc("/repos/o/r/pulls/1/files", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	c.ProcessCheckSuite(e)
+	if len(statuses) == 0 || statuses[len(statuses)-1] != "completed:failure" {
+		t.Errorf("expected the check run to fail, got %v", statuses)
+	}
+}
+
+func TestChangedFileListForPushes(t *testing.T) {
+	client, mux, _, teardown := setup()
+	defer teardown()
+	ctx := context.Background()
+	c := &Context{
+		Ctx:    &ctx,
+		Github: client,
+	}
+	repo := &github.Repository{
+		Owner: &github.User{
+			Login: github.String("o"),
+		},
+		Name: github.String("r"),
+	}
+
+	mux.HandleFunc("/repos/o/r/compare/b...a", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		fmt.Fprint(w, `{"files": [{"filename": "a.yaml", "status": "modified"}, {"filename": "b.yaml", "status": "removed"}]}`)
+	})
+	mux.HandleFunc("/repos/o/r/commits/a", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		fmt.Fprint(w, `{"files": [{"filename": "c.yaml", "status": "added"}]}`)
+	})
+
+	tests := []struct {
+		checkSuite *github.CheckSuite
+		want       string
+	}{
+		{&github.CheckSuite{BeforeSHA: github.String("b"), AfterSHA: github.String("a"), HeadSHA: github.String("a")}, "[a.yaml]"},
+		{&github.CheckSuite{BeforeSHA: github.String("0000000000000000000000000000000000000000"), AfterSHA: github.String("a"), HeadSHA: github.String("a")}, "[c.yaml]"},
+		{&github.CheckSuite{HeadSHA: github.String("a")}, "[c.yaml]"},
+	}
+	for _, test := range tests {
+		files, err := c.changedFileList(&github.CheckSuiteEvent{CheckSuite: test.checkSuite, Repo: repo})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, file := range files {
+			names = append(names, file.GetFilename())
+		}
+		if fmt.Sprint(names) != test.want {
+			t.Errorf("expected %s, got %v", test.want, names)
+		}
+	}
+}
+
+func TestChangedFileListForLargePushes(t *testing.T) {
+	client, mux, _, teardown := setup()
+	defer teardown()
+	ctx := context.Background()
+	c := &Context{
+		Ctx:    &ctx,
+		Github: client,
+	}
+	e := &github.CheckSuiteEvent{
+		CheckSuite: &github.CheckSuite{
+			BeforeSHA: github.String("b"),
+			AfterSHA:  github.String("a"),
+			HeadSHA:   github.String("a"),
+		},
+		Repo: &github.Repository{
+			Owner: &github.User{
+				Login: github.String("o"),
+			},
+			Name: github.String("r"),
+		},
+	}
+
+	mux.HandleFunc("/repos/o/r/compare/b...a", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		files := make([]string, maxComparedFiles)
+		for i := range files {
+			files[i] = fmt.Sprintf(`{"filename": "%d.yaml", "status": "modified"}`, i)
+		}
+		fmt.Fprintf(w, `{"files": [%s]}`, strings.Join(files, ","))
+	})
+	mux.HandleFunc("/repos/o/r/git/trees/a", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		fmt.Fprint(w, `{"tree": [{"path": "a.yaml", "type": "blob"}, {"path": "dir", "type": "tree"}, {"path": "dir/b.yaml", "type": "blob"}]}`)
+	})
+
+	files, err := c.changedFileList(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, file := range files {
+		names = append(names, file.GetFilename())
+	}
+	if fmt.Sprint(names) != "[a.yaml dir/b.yaml]" {
+		t.Errorf("expected every file in the repository to be listed, got %v", names)
+	}
+}
+
+func TestTruncatedTreesAreListedADirectoryAtATime(t *testing.T) {
+	client, mux, _, teardown := setup()
+	defer teardown()
+	ctx := context.Background()
+	c := &Context{
+		Ctx:    &ctx,
+		Github: client,
+	}
+	e := &github.CheckSuiteEvent{
+		CheckSuite: &github.CheckSuite{
+			HeadSHA: github.String("a"),
+		},
+		Repo: &github.Repository{
+			Owner: &github.User{
+				Login: github.String("o"),
+			},
+			Name: github.String("r"),
+		},
+	}
+
+	mux.HandleFunc("/repos/o/r/git/trees/a", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		if r.URL.Query().Get("recursive") != "" {
+			fmt.Fprint(w, `{"truncated": true, "tree": [{"path": "a.yaml", "type": "blob"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"tree": [{"path": "a.yaml", "type": "blob"}, {"path": "dir", "type": "tree", "sha": "d"}]}`)
+	})
+	mux.HandleFunc("/repos/o/r/git/trees/d", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		fmt.Fprint(w, `{"tree": [{"path": "b.yaml", "type": "blob", "sha": "b"}, {"path": "sub", "type": "tree", "sha": "s"}]}`)
+	})
+	mux.HandleFunc("/repos/o/r/git/trees/s", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		fmt.Fprint(w, `{"tree": [{"path": "c.yaml", "type": "blob"}]}`)
+	})
+
+	files, err := c.treeFileList(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, file := range files {
+		names = append(names, file.GetFilename())
+	}
+	if fmt.Sprint(names) != "[a.yaml dir/b.yaml dir/sub/c.yaml]" {
+		t.Errorf("expected every file in the repository to be listed, got %v", names)
+	}
+	if files[1].GetSHA() != "b" || files[1].GetBlobURL() != "https://github.com/o/r/blob/a/dir/b.yaml" {
+		t.Errorf("expected files in subtrees to keep their SHAs and link to their paths, got %s", github.Stringify(files[1]))
+	}
+}
@@ -0,0 +1,202 @@
+package validator
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/go-github/github"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// crdRegistry holds the openAPIV3Schemas of CustomResourceDefinitions found in
+// a repository, keyed by the apiVersion and kind of the resources they define
+type crdRegistry struct {
+	schemas map[string]map[string]interface{}
+}
+
+func newCRDRegistry() *crdRegistry {
+	return &crdRegistry{
+		schemas: make(map[string]map[string]interface{}),
+	}
+}
+
+func crdKey(apiVersion string, kind string) string {
+	return fmt.Sprintf("%s/%s", apiVersion, kind)
+}
+
+// Add registers the schemas of each served version of the
+// CustomResourceDefinitions in b, returning the number of schemas registered.
+// Documents that can't be parsed are ignored as validation will report them.
+func (r *crdRegistry) Add(b []byte) int {
+	added := 0
+	for _, document := range splitDocuments(b) {
+		var spec interface{}
+		if err := yaml.Unmarshal(document, &spec); err != nil {
+			continue
+		}
+		body, ok := convertToStringKeys(spec).(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, item := range expandList(body) {
+			added += r.addDefinition(item.body)
+		}
+	}
+	return added
+}
+
+// addDefinition registers the schemas of a CustomResourceDefinition
+func (r *crdRegistry) addDefinition(body map[string]interface{}) int {
+	if body["kind"] != "CustomResourceDefinition" {
+		return 0
+	}
+	added := 0
+	crdSpec, _ := body["spec"].(map[string]interface{})
+	group, _ := crdSpec["group"].(string)
+	names, _ := crdSpec["names"].(map[string]interface{})
+	kind, _ := names["kind"].(string)
+	if group == "" || kind == "" {
+		return 0
+	}
+
+	// apiextensions.k8s.io/v1beta1 allows a single schema to be shared by
+	// all versions
+	var sharedSchema map[string]interface{}
+	if validation, ok := crdSpec["validation"].(map[string]interface{}); ok {
+		sharedSchema, _ = validation["openAPIV3Schema"].(map[string]interface{})
+	}
+
+	versions, _ := crdSpec["versions"].([]interface{})
+	if len(versions) == 0 {
+		if version, ok := crdSpec["version"].(string); ok && sharedSchema != nil {
+			r.schemas[crdKey(fmt.Sprintf("%s/%s", group, version), kind)] = sharedSchema
+			added++
+		}
+		return added
+	}
+	for _, v := range versions {
+		version, _ := v.(map[string]interface{})
+		name, _ := version["name"].(string)
+		if served, ok := version["served"].(bool); name == "" || (ok && !served) {
+			continue
+		}
+		schema := sharedSchema
+		if versionSchema, ok := version["schema"].(map[string]interface{}); ok {
+			if openAPIV3Schema, ok := versionSchema["openAPIV3Schema"].(map[string]interface{}); ok {
+				schema = openAPIV3Schema
+			}
+		}
+		if schema == nil {
+			continue
+		}
+		r.schemas[crdKey(fmt.Sprintf("%s/%s", group, name), kind)] = schema
+		added++
+	}
+	return added
+}
+
+// schemaFor returns a JSON schema for custom resources of apiVersion and kind.
+// In strict mode, unknown fields that the API server would prune are
+// prohibited.
+func (r *crdRegistry) schemaFor(apiVersion string, kind string, strict bool) (map[string]interface{}, bool) {
+	if r == nil {
+		return nil, false
+	}
+	schema, ok := r.schemas[crdKey(apiVersion, kind)]
+	if !ok {
+		return nil, false
+	}
+
+	// Copy the schema so that it can be modified
+	var copied map[string]interface{}
+	b, err := json.Marshal(schema)
+	if err != nil {
+		return nil, false
+	}
+	if err := json.Unmarshal(b, &copied); err != nil {
+		return nil, false
+	}
+
+	// Fields common to all resources are often left out of CRD schemas
+	if properties, ok := copied["properties"].(map[string]interface{}); ok {
+		for _, field := range []string{"apiVersion", "kind"} {
+			if _, ok := properties[field]; !ok {
+				properties[field] = map[string]interface{}{"type": "string"}
+			}
+		}
+		if _, ok := properties["metadata"]; !ok {
+			properties["metadata"] = map[string]interface{}{"type": "object"}
+		}
+	}
+
+	if strict {
+		prohibitUnknownFields(copied)
+	}
+	return copied, true
+}
+
+// prohibitUnknownFields disallows additional properties on every object in
+// schema that declares its properties and doesn't preserve unknown fields
+func prohibitUnknownFields(schema interface{}) {
+	switch s := schema.(type) {
+	case map[string]interface{}:
+		properties, hasProperties := s["properties"].(map[string]interface{})
+		_, hasAdditionalProperties := s["additionalProperties"]
+		preserve, _ := s["x-kubernetes-preserve-unknown-fields"].(bool)
+		if hasProperties && !hasAdditionalProperties && !preserve {
+			s["additionalProperties"] = false
+		}
+		for _, property := range properties {
+			prohibitUnknownFields(property)
+		}
+		for _, key := range []string{"items", "additionalProperties", "allOf", "anyOf", "oneOf"} {
+			prohibitUnknownFields(s[key])
+		}
+	case []interface{}:
+		for _, item := range s {
+			prohibitUnknownFields(item)
+		}
+	}
+}
+
+// loadCustomResourceDefinitions registers the CustomResourceDefinitions found
+// in candidates and in the files matching the configured CRD globs so that
+// custom resources can be validated against them
+func (c *Context) loadCustomResourceDefinitions(e *github.CheckSuiteEvent, config *KubeValidatorConfig, candidates Candidates) Annotations {
+	var annotations Annotations
+	crds := newCRDRegistry()
+	c.crds = crds
+
+	for _, candidate := range candidates {
+		if candidate.bytes != nil {
+			crds.Add(*candidate.bytes)
+		}
+	}
+
+	if config.Spec == nil || len(config.Spec.CRDs) == 0 {
+		return annotations
+	}
+
+	files, err := c.treeFileList(e)
+	if err != nil {
+		return append(annotations, configErrorAnnotation(e, "Error loading CustomResourceDefinitions", err))
+	}
+
+	for _, file := range config.crdFiles(files) {
+		b, err := c.bytesForFilename(e, file.GetFilename())
+		if err != nil {
+			annotations = append(annotations, &github.CheckRunAnnotation{
+				Path:            file.Filename,
+				BlobHRef:        file.BlobURL,
+				StartLine:       github.Int(1),
+				EndLine:         github.Int(1),
+				AnnotationLevel: github.String("failure"),
+				Title:           github.String(fmt.Sprintf("Error loading %s", file.GetFilename())),
+				Message:         github.String(fmt.Sprintf("%+v", err)),
+			})
+			continue
+		}
+		crds.Add(*b)
+	}
+	return annotations
+}
@@ -0,0 +1,129 @@
+package validator
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+func TestCRDRegistryRegistersServedVersions(t *testing.T) {
+	crds := newCRDRegistry()
+	for _, fixture := range []string{"../fixtures/crds/crontab.yaml", "../fixtures/crds/certificate-v1beta1.yaml"} {
+		fileContents, _ := ioutil.ReadFile(fixture)
+		crds.Add(fileContents)
+	}
+
+	tests := []struct {
+		apiVersion string
+		kind       string
+		want       bool
+	}{
+		{"stable.example.com/v1", "CronTab", true},
+		{"stable.example.com/v1alpha1", "CronTab", false},
+		{"certmanager.k8s.io/v1alpha1", "Certificate", true},
+		{"apps/v1", "Deployment", false},
+	}
+	for _, test := range tests {
+		if _, ok := crds.schemaFor(test.apiVersion, test.kind, true); ok != test.want {
+			t.Errorf("expected schema for %s %s to be found: %v", test.apiVersion, test.kind, test.want)
+		}
+	}
+}
+
+func TestAnnotationsForInvalidCustomResource(t *testing.T) {
+	crds := newCRDRegistry()
+	crdContents, _ := ioutil.ReadFile("../fixtures/crds/crontab.yaml")
+	crds.Add(crdContents)
+
+	candidate := NewCandidate(
+		&Context{
+			Event: &github.CheckSuiteEvent{},
+			crds:  crds,
+		}, &github.CommitFile{
+			Filename: github.String("crontab.yaml"),
+		}, []*KubeValidatorConfigSchema{{Version: "1.13.0"}})
+
+	fileContents, _ := ioutil.ReadFile("../fixtures/custom-resources/crontab.yaml")
+	candidate.setBytes(&fileContents)
+	annotations := candidate.Validate()
+
+	want := []string{
+		"spec.replicas: Invalid type. Expected: integer, given: string",
+		"extra: Additional property extra is not allowed",
+	}
+	if len(annotations) != len(want) {
+		t.Errorf("a total of %d annotations were returned, wanted %d: %s", len(annotations), len(want), github.Stringify(annotations))
+		return
+	}
+	for i, annotation := range annotations {
+		if annotation.GetMessage() != want[i] {
+			t.Errorf("expected %q, got %q", want[i], annotation.GetMessage())
+		}
+		if annotation.GetTitle() != "Error validating CronTab against 1.13.0 schema" {
+			t.Errorf("unexpected title %q", annotation.GetTitle())
+		}
+	}
+}
+
+func TestLoadingCRDsFromGlobs(t *testing.T) {
+	client, mux, _, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/repos/o/r/git/trees/abc", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		testFormValues(t, r, values{"recursive": "1"})
+		fmt.Fprint(w, `{
+			"sha": "abc",
+			"tree": [
+				{"path": "crds", "type": "tree"},
+				{"path": "crds/crontab.yaml", "type": "blob"},
+				{"path": "README.md", "type": "blob"}
+			]
+		}`)
+	})
+	fileContents, _ := ioutil.ReadFile(filepath.Join("..", "fixtures", "crds", "crontab.yaml"))
+	mux.HandleFunc("/repos/o/r/contents/crds/crontab.yaml", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		fmt.Fprintf(w, `{
+			"type": "file",
+			"encoding": "base64",
+			"content": "%s"
+		}`, base64.StdEncoding.EncodeToString(fileContents))
+	})
+
+	ctx := context.Background()
+	c := &Context{
+		Ctx:    &ctx,
+		Github: client,
+	}
+	e := &github.CheckSuiteEvent{
+		CheckSuite: &github.CheckSuite{
+			HeadSHA: github.String("abc"),
+		},
+		Repo: &github.Repository{
+			Name: github.String("r"),
+			Owner: &github.User{
+				Login: github.String("o"),
+			},
+		},
+	}
+	config := &KubeValidatorConfig{
+		Spec: &KubeValidatorConfigSpec{
+			CRDs: []string{"crds/*.yaml"},
+		},
+	}
+
+	annotations := c.loadCustomResourceDefinitions(e, config, nil)
+	if len(annotations) != 0 {
+		t.Errorf("unexpected annotations: %s", github.Stringify(annotations))
+	}
+	if _, ok := c.crds.schemaFor("stable.example.com/v1", "CronTab", true); !ok {
+		t.Errorf("expected CronTab CRD to be loaded")
+	}
+}
@@ -0,0 +1,217 @@
+package validator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// apiDeprecation describes when a kind was deprecated and removed from an
+// apiVersion, and which apiVersion replaced it
+type apiDeprecation struct {
+	APIVersion   string
+	Kind         string
+	DeprecatedIn string
+	RemovedIn    string
+	Replacement  string
+	IntroducedIn string
+}
+
+// apiDeprecations lists the apiVersions removed from Kubernetes. See
+// https://kubernetes.io/docs/reference/using-api/deprecation-guide/
+var apiDeprecations = []apiDeprecation{
+	{"extensions/v1beta1", "Deployment", "1.9", "1.16", "apps/v1", "1.9"},
+	{"extensions/v1beta1", "DaemonSet", "1.9", "1.16", "apps/v1", "1.9"},
+	{"extensions/v1beta1", "ReplicaSet", "1.9", "1.16", "apps/v1", "1.9"},
+	{"extensions/v1beta1", "NetworkPolicy", "1.9", "1.16", "networking.k8s.io/v1", "1.8"},
+	{"extensions/v1beta1", "PodSecurityPolicy", "1.11", "1.16", "policy/v1beta1", "1.10"},
+	{"apps/v1beta1", "Deployment", "1.9", "1.16", "apps/v1", "1.9"},
+	{"apps/v1beta1", "StatefulSet", "1.9", "1.16", "apps/v1", "1.9"},
+	{"apps/v1beta2", "Deployment", "1.9", "1.16", "apps/v1", "1.9"},
+	{"apps/v1beta2", "StatefulSet", "1.9", "1.16", "apps/v1", "1.9"},
+	{"apps/v1beta2", "DaemonSet", "1.9", "1.16", "apps/v1", "1.9"},
+	{"apps/v1beta2", "ReplicaSet", "1.9", "1.16", "apps/v1", "1.9"},
+
+	{"extensions/v1beta1", "Ingress", "1.14", "1.22", "networking.k8s.io/v1", "1.19"},
+	{"networking.k8s.io/v1beta1", "Ingress", "1.19", "1.22", "networking.k8s.io/v1", "1.19"},
+	{"networking.k8s.io/v1beta1", "IngressClass", "1.19", "1.22", "networking.k8s.io/v1", "1.19"},
+	{"apiextensions.k8s.io/v1beta1", "CustomResourceDefinition", "1.16", "1.22", "apiextensions.k8s.io/v1", "1.16"},
+	{"admissionregistration.k8s.io/v1beta1", "MutatingWebhookConfiguration", "1.16", "1.22", "admissionregistration.k8s.io/v1", "1.16"},
+	{"admissionregistration.k8s.io/v1beta1", "ValidatingWebhookConfiguration", "1.16", "1.22", "admissionregistration.k8s.io/v1", "1.16"},
+	{"apiregistration.k8s.io/v1beta1", "APIService", "1.19", "1.22", "apiregistration.k8s.io/v1", "1.10"},
+	{"authentication.k8s.io/v1beta1", "TokenReview", "1.19", "1.22", "authentication.k8s.io/v1", "1.6"},
+	{"authorization.k8s.io/v1beta1", "LocalSubjectAccessReview", "1.19", "1.22", "authorization.k8s.io/v1", "1.6"},
+	{"authorization.k8s.io/v1beta1", "SelfSubjectAccessReview", "1.19", "1.22", "authorization.k8s.io/v1", "1.6"},
+	{"authorization.k8s.io/v1beta1", "SubjectAccessReview", "1.19", "1.22", "authorization.k8s.io/v1", "1.6"},
+	{"certificates.k8s.io/v1beta1", "CertificateSigningRequest", "1.19", "1.22", "certificates.k8s.io/v1", "1.19"},
+	{"coordination.k8s.io/v1beta1", "Lease", "1.19", "1.22", "coordination.k8s.io/v1", "1.14"},
+	{"rbac.authorization.k8s.io/v1beta1", "ClusterRole", "1.17", "1.22", "rbac.authorization.k8s.io/v1", "1.8"},
+	{"rbac.authorization.k8s.io/v1beta1", "ClusterRoleBinding", "1.17", "1.22", "rbac.authorization.k8s.io/v1", "1.8"},
+	{"rbac.authorization.k8s.io/v1beta1", "Role", "1.17", "1.22", "rbac.authorization.k8s.io/v1", "1.8"},
+	{"rbac.authorization.k8s.io/v1beta1", "RoleBinding", "1.17", "1.22", "rbac.authorization.k8s.io/v1", "1.8"},
+	{"scheduling.k8s.io/v1beta1", "PriorityClass", "1.14", "1.22", "scheduling.k8s.io/v1", "1.14"},
+	{"storage.k8s.io/v1beta1", "CSIDriver", "1.19", "1.22", "storage.k8s.io/v1", "1.18"},
+	{"storage.k8s.io/v1beta1", "CSINode", "1.17", "1.22", "storage.k8s.io/v1", "1.17"},
+	{"storage.k8s.io/v1beta1", "StorageClass", "1.19", "1.22", "storage.k8s.io/v1", "1.6"},
+	{"storage.k8s.io/v1beta1", "VolumeAttachment", "1.19", "1.22", "storage.k8s.io/v1", "1.13"},
+
+	{"batch/v1beta1", "CronJob", "1.21", "1.25", "batch/v1", "1.21"},
+	{"discovery.k8s.io/v1beta1", "EndpointSlice", "1.21", "1.25", "discovery.k8s.io/v1", "1.21"},
+	{"events.k8s.io/v1beta1", "Event", "1.19", "1.25", "events.k8s.io/v1", "1.19"},
+	{"autoscaling/v2beta1", "HorizontalPodAutoscaler", "1.22", "1.25", "autoscaling/v2", "1.23"},
+	{"policy/v1beta1", "PodDisruptionBudget", "1.21", "1.25", "policy/v1", "1.21"},
+	{"policy/v1beta1", "PodSecurityPolicy", "1.21", "1.25", "", ""},
+	{"node.k8s.io/v1beta1", "RuntimeClass", "1.20", "1.25", "node.k8s.io/v1", "1.20"},
+
+	{"autoscaling/v2beta2", "HorizontalPodAutoscaler", "1.23", "1.26", "autoscaling/v2", "1.23"},
+	{"flowcontrol.apiserver.k8s.io/v1beta1", "FlowSchema", "1.23", "1.26", "flowcontrol.apiserver.k8s.io/v1beta2", "1.23"},
+	{"flowcontrol.apiserver.k8s.io/v1beta1", "PriorityLevelConfiguration", "1.23", "1.26", "flowcontrol.apiserver.k8s.io/v1beta2", "1.23"},
+	{"storage.k8s.io/v1beta1", "CSIStorageCapacity", "1.24", "1.27", "storage.k8s.io/v1", "1.24"},
+	{"flowcontrol.apiserver.k8s.io/v1beta2", "FlowSchema", "1.26", "1.29", "flowcontrol.apiserver.k8s.io/v1", "1.29"},
+	{"flowcontrol.apiserver.k8s.io/v1beta2", "PriorityLevelConfiguration", "1.26", "1.29", "flowcontrol.apiserver.k8s.io/v1", "1.29"},
+	{"flowcontrol.apiserver.k8s.io/v1beta3", "FlowSchema", "1.29", "1.32", "flowcontrol.apiserver.k8s.io/v1", "1.29"},
+	{"flowcontrol.apiserver.k8s.io/v1beta3", "PriorityLevelConfiguration", "1.29", "1.32", "flowcontrol.apiserver.k8s.io/v1", "1.29"},
+}
+
+// identicalReplacements lists the deprecated apiVersions of kinds whose
+// replacements share their schema, so that moving to the replacement only
+// requires changing the apiVersion. Others, like Deployments which require a
+// selector in apps/v1, need more than that.
+var identicalReplacements = map[string]bool{
+	"extensions/v1beta1 NetworkPolicy":                                true,
+	"networking.k8s.io/v1beta1 IngressClass":                          true,
+	"apiregistration.k8s.io/v1beta1 APIService":                       true,
+	"coordination.k8s.io/v1beta1 Lease":                               true,
+	"rbac.authorization.k8s.io/v1beta1 ClusterRole":                   true,
+	"rbac.authorization.k8s.io/v1beta1 ClusterRoleBinding":            true,
+	"rbac.authorization.k8s.io/v1beta1 Role":                          true,
+	"rbac.authorization.k8s.io/v1beta1 RoleBinding":                   true,
+	"scheduling.k8s.io/v1beta1 PriorityClass":                         true,
+	"storage.k8s.io/v1beta1 CSINode":                                  true,
+	"storage.k8s.io/v1beta1 StorageClass":                             true,
+	"storage.k8s.io/v1beta1 VolumeAttachment":                         true,
+	"storage.k8s.io/v1beta1 CSIStorageCapacity":                       true,
+	"batch/v1beta1 CronJob":                                           true,
+	"node.k8s.io/v1beta1 RuntimeClass":                                true,
+	"flowcontrol.apiserver.k8s.io/v1beta1 FlowSchema":                 true,
+	"flowcontrol.apiserver.k8s.io/v1beta1 PriorityLevelConfiguration": true,
+	"flowcontrol.apiserver.k8s.io/v1beta3 FlowSchema":                 true,
+	"flowcontrol.apiserver.k8s.io/v1beta3 PriorityLevelConfiguration": true,
+}
+
+// findDeprecation returns the deprecation of kind in apiVersion, if any
+func findDeprecation(apiVersion string, kind string) *apiDeprecation {
+	for i := range apiDeprecations {
+		if apiDeprecations[i].APIVersion == apiVersion && apiDeprecations[i].Kind == kind {
+			return &apiDeprecations[i]
+		}
+	}
+	return nil
+}
+
+// levelAt returns the annotation level appropriate for a resource using a
+// deprecated apiVersion in the given version of Kubernetes, or an empty string
+// if the apiVersion hasn't been deprecated yet
+func (d *apiDeprecation) levelAt(version string) string {
+	if compareVersions(version, d.RemovedIn) >= 0 {
+		return "failure"
+	}
+	if compareVersions(version, d.DeprecatedIn) >= 0 {
+		return "warning"
+	}
+	return ""
+}
+
+// fixableAt determines whether or not a resource using the deprecated
+// apiVersion can be moved to its replacement by changing only its apiVersion
+// in the given version of Kubernetes
+func (d *apiDeprecation) fixableAt(version string) bool {
+	return d.Replacement != "" &&
+		compareVersions(version, d.IntroducedIn) >= 0 &&
+		identicalReplacements[fmt.Sprintf("%s %s", d.APIVersion, d.Kind)]
+}
+
+// message describes the deprecation and how to address it
+func (d *apiDeprecation) message(level string) string {
+	var message string
+	if level == "failure" {
+		message = fmt.Sprintf("%s %s is removed in %s", d.APIVersion, d.Kind, d.RemovedIn)
+	} else {
+		message = fmt.Sprintf("%s %s is deprecated in %s and removed in %s", d.APIVersion, d.Kind, d.DeprecatedIn, d.RemovedIn)
+	}
+	if d.Replacement == "" {
+		return fmt.Sprintf("%s with no replacement", message)
+	}
+	return fmt.Sprintf("%s; use %s, available since %s", message, d.Replacement, d.IntroducedIn)
+}
+
+// docsURL links to the documentation of the kind in its replacement
+// apiVersion, if there is one
+func (d *apiDeprecation) docsURL(docs *docsResolver) string {
+	if d.Replacement == "" {
+		return ""
+	}
+	return docs.URL(d.Replacement, d.Kind, nil)
+}
+
+// deprecationAnnotation returns an annotation if the resource described by
+// result uses an apiVersion that's deprecated or removed in the given schema's
+// version of Kubernetes. The annotation points at the apiVersion of the
+// resource in document, which starts on startLine.
+func (c *Candidate) deprecationAnnotation(result validationResult, schema *KubeValidatorConfigSchema, schemaName string, document []byte, startLine int) *github.CheckRunAnnotation {
+	if schema.Version == "" || schema.Version == "master" {
+		return nil
+	}
+	deprecation := findDeprecation(result.APIVersion, result.Kind)
+	if deprecation == nil {
+		return nil
+	}
+	level := deprecation.levelAt(schema.Version)
+	if level == "" {
+		return nil
+	}
+
+	var title string
+	if level == "failure" {
+		title = fmt.Sprintf("%s %s has been removed from the %s schema", result.APIVersion, result.Kind, schemaName)
+	} else {
+		title = fmt.Sprintf("%s %s is deprecated in the %s schema", result.APIVersion, result.Kind, schemaName)
+	}
+	apiVersionStartLine, apiVersionEndLine := detectLineNumbersForPath(&document, result.Path+"/apiVersion")
+	return &github.CheckRunAnnotation{
+		Path:            c.file.Filename,
+		BlobHRef:        c.file.BlobURL,
+		StartLine:       github.Int(apiVersionStartLine + startLine - 1),
+		EndLine:         github.Int(apiVersionEndLine + startLine - 1),
+		AnnotationLevel: github.String(c.level("deprecated_api", "", result.Kind, level)),
+		Title:           github.String(title),
+		Message:         github.String(withDocsLink(deprecation.message(level), deprecation.docsURL(c.docs(schema)))),
+	}
+}
+
+// compareVersions compares the major and minor components of two Kubernetes
+// versions like 1.13.0, returning -1, 0, or 1
+func compareVersions(a string, b string) int {
+	aParts := versionParts(a)
+	bParts := versionParts(b)
+	for i := 0; i < 2; i++ {
+		if aParts[i] < bParts[i] {
+			return -1
+		}
+		if aParts[i] > bParts[i] {
+			return 1
+		}
+	}
+	return 0
+}
+
+func versionParts(version string) [2]int {
+	var parts [2]int
+	components := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	for i := 0; i < len(parts) && i < len(components); i++ {
+		parts[i], _ = strconv.Atoi(components[i])
+	}
+	return parts
+}
@@ -0,0 +1,121 @@
+package validator
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a    string
+		b    string
+		want int
+	}{
+		{"1.13.0", "1.16", -1},
+		{"1.16.0", "1.16", 0},
+		{"v1.16.2", "1.16", 0},
+		{"1.22.1", "1.16", 1},
+		{"2.0.0", "1.32", 1},
+	}
+	for _, test := range tests {
+		if got := compareVersions(test.a, test.b); got != test.want {
+			t.Errorf("compareVersions(%s, %s): expected %d, got %d", test.a, test.b, test.want, got)
+		}
+	}
+}
+
+func TestDeprecationLevels(t *testing.T) {
+	deprecation := findDeprecation("extensions/v1beta1", "Deployment")
+	if deprecation == nil {
+		t.Fatal("expected extensions/v1beta1 Deployment to be deprecated")
+	}
+
+	tests := []struct {
+		version string
+		level   string
+		message string
+	}{
+		{"1.8.0", "", ""},
+		{"1.13.0", "warning", "extensions/v1beta1 Deployment is deprecated in 1.9 and removed in 1.16; use apps/v1, available since 1.9"},
+		{"1.16.0", "failure", "extensions/v1beta1 Deployment is removed in 1.16; use apps/v1, available since 1.9"},
+	}
+	for _, test := range tests {
+		level := deprecation.levelAt(test.version)
+		if level != test.level {
+			t.Errorf("%s: expected level %q, got %q", test.version, test.level, level)
+		}
+		if level != "" && deprecation.message(level) != test.message {
+			t.Errorf("%s: expected message %q, got %q", test.version, test.message, deprecation.message(level))
+		}
+	}
+
+	if findDeprecation("apps/v1", "Deployment") != nil {
+		t.Error("apps/v1 Deployment isn't deprecated")
+	}
+}
+
+func TestDeprecationsFixableAt(t *testing.T) {
+	tests := []struct {
+		deprecation *apiDeprecation
+		version     string
+		want        bool
+	}{
+		{findDeprecation("rbac.authorization.k8s.io/v1beta1", "Role"), "1.17.0", true},
+		{findDeprecation("extensions/v1beta1", "Deployment"), "1.16.0", false},
+		{findDeprecation("extensions/v1beta1", "Ingress"), "1.15.0", false},
+		{findDeprecation("apiextensions.k8s.io/v1beta1", "CustomResourceDefinition"), "1.22.0", false},
+		{findDeprecation("policy/v1beta1", "PodSecurityPolicy"), "1.25.0", false},
+		// Replacements can't be suggested before they're available
+		{&apiDeprecation{"rbac.authorization.k8s.io/v1beta1", "Role", "1.17", "1.22", "rbac.authorization.k8s.io/v1", "1.18"}, "1.17.0", false},
+	}
+	for _, test := range tests {
+		if got := test.deprecation.fixableAt(test.version); got != test.want {
+			t.Errorf("%s %s at %s: expected %t, got %t", test.deprecation.APIVersion, test.deprecation.Kind, test.version, test.want, got)
+		}
+	}
+}
+
+func TestAnnotationsForDeprecatedAPIVersions(t *testing.T) {
+	schemaDir, _ := filepath.Abs("../fixtures/schemas")
+	deployment, _ := ioutil.ReadFile("../fixtures/deprecated/deployment.yaml")
+	// The deprecated apiVersion is on line 7, in the second document
+	fileContents := append([]byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\n---\n# The deployment\n"), deployment...)
+
+	tests := []struct {
+		version string
+		level   string
+		title   string
+	}{
+		{"1.13.0", "warning", "extensions/v1beta1 Deployment is deprecated in the 1.13.0 schema"},
+		{"1.16.0", "failure", "extensions/v1beta1 Deployment has been removed from the 1.16.0 schema"},
+	}
+	for _, test := range tests {
+		candidate := NewCandidate(
+			&Context{
+				Event:     &github.CheckSuiteEvent{},
+				SchemaDir: schemaDir,
+			}, &github.CommitFile{
+				Filename: github.String("deployment.yaml"),
+			}, []*KubeValidatorConfigSchema{{Version: test.version, IgnoreMissingSchemas: true}})
+		candidate.setBytes(&fileContents)
+
+		var found bool
+		for _, annotation := range candidate.Validate() {
+			if annotation.GetTitle() == test.title {
+				found = true
+				if annotation.GetAnnotationLevel() != test.level {
+					t.Errorf("%s: expected level %s, got %s", test.version, test.level, annotation.GetAnnotationLevel())
+				}
+				if annotation.GetStartLine() != 7 || annotation.GetEndLine() != 7 {
+					t.Errorf("%s: expected the annotation on line 7, got %d-%d", test.version, annotation.GetStartLine(), annotation.GetEndLine())
+				}
+			}
+		}
+		if !found {
+			t.Errorf("%s: expected an annotation titled %q", test.version, test.title)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package validator
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	kubernetesReferenceURL = "https://kubernetes.io/docs/reference/generated/kubernetes-api"
+	openShiftReferenceURL  = "https://docs.openshift.com/container-platform"
+
+	// defaultReferenceVersion is the version of the Kubernetes API reference
+	// linked to from master schemas unless docsVersion is configured
+	defaultReferenceVersion = "1.32"
+	// latestOpenShiftReferenceVersion is the version of the OpenShift REST API
+	// reference linked to from schemas other than 3.x versions
+	latestOpenShiftReferenceVersion = "3.11"
+)
+
+// apiType is a type documented in the Kubernetes API reference, like
+// DeploymentSpec in apps/v1
+type apiType struct {
+	Name    string
+	Group   string
+	Version string
+}
+
+// anchor returns the anchor of the type in the Kubernetes API reference, like
+// deploymentspec-v1-apps
+func (t apiType) anchor() string {
+	group := t.Group
+	if group == "" {
+		group = "core"
+	}
+	return fmt.Sprintf("%s-%s-%s", strings.ToLower(t.Name), t.Version, strings.Replace(group, ".", "-", -1))
+}
+
+var (
+	objectMeta      = apiType{"ObjectMeta", "meta", "v1"}
+	labelSelector   = apiType{"LabelSelector", "meta", "v1"}
+	podTemplateSpec = apiType{"PodTemplateSpec", "", "v1"}
+	container       = apiType{"Container", "", "v1"}
+	probe           = apiType{"Probe", "", "v1"}
+)
+
+// fieldTypes maps the fields of types to the types of their values, which
+// are documented separately. Fields of Lists are mapped to the type of their
+// items. Spec and status are resolved from the kind of the resource.
+var fieldTypes = map[string]map[string]apiType{
+	"ObjectMeta": {
+		"ownerReferences": {"OwnerReference", "meta", "v1"},
+	},
+	"DeploymentSpec": {
+		"selector": labelSelector,
+		"template": podTemplateSpec,
+		"strategy": {"DeploymentStrategy", "apps", "v1"},
+	},
+	"ReplicaSetSpec": {
+		"selector": labelSelector,
+		"template": podTemplateSpec,
+	},
+	"DaemonSetSpec": {
+		"selector":       labelSelector,
+		"template":       podTemplateSpec,
+		"updateStrategy": {"DaemonSetUpdateStrategy", "apps", "v1"},
+	},
+	"StatefulSetSpec": {
+		"selector":             labelSelector,
+		"template":             podTemplateSpec,
+		"updateStrategy":       {"StatefulSetUpdateStrategy", "apps", "v1"},
+		"volumeClaimTemplates": {"PersistentVolumeClaim", "", "v1"},
+	},
+	"ReplicationControllerSpec": {
+		"template": podTemplateSpec,
+	},
+	"JobSpec": {
+		"selector": labelSelector,
+		"template": podTemplateSpec,
+	},
+	"CronJobSpec": {
+		"jobTemplate": {"JobTemplateSpec", "batch", "v1"},
+	},
+	"JobTemplateSpec": {
+		"metadata": objectMeta,
+		"spec":     {"JobSpec", "batch", "v1"},
+	},
+	"PodTemplateSpec": {
+		"metadata": objectMeta,
+		"spec":     {"PodSpec", "", "v1"},
+	},
+	"PodSpec": {
+		"containers":       container,
+		"initContainers":   container,
+		"volumes":          {"Volume", "", "v1"},
+		"securityContext":  {"PodSecurityContext", "", "v1"},
+		"affinity":         {"Affinity", "", "v1"},
+		"tolerations":      {"Toleration", "", "v1"},
+		"imagePullSecrets": {"LocalObjectReference", "", "v1"},
+	},
+	"Container": {
+		"ports":           {"ContainerPort", "", "v1"},
+		"env":             {"EnvVar", "", "v1"},
+		"envFrom":         {"EnvFromSource", "", "v1"},
+		"resources":       {"ResourceRequirements", "", "v1"},
+		"volumeMounts":    {"VolumeMount", "", "v1"},
+		"livenessProbe":   probe,
+		"readinessProbe":  probe,
+		"startupProbe":    probe,
+		"securityContext": {"SecurityContext", "", "v1"},
+		"lifecycle":       {"Lifecycle", "", "v1"},
+	},
+	"EnvVar": {
+		"valueFrom": {"EnvVarSource", "", "v1"},
+	},
+	"ServiceSpec": {
+		"ports": {"ServicePort", "", "v1"},
+	},
+	"IngressSpec": {
+		"rules": {"IngressRule", "networking.k8s.io", "v1"},
+		"tls":   {"IngressTLS", "networking.k8s.io", "v1"},
+	},
+}
+
+// docsResolver links resources and their fields to the reference
+// documentation of the relevant doc set
+type docsResolver struct {
+	// Version of Kubernetes or OpenShift being validated against
+	Version   string
+	OpenShift bool
+	// Templates are URL templates keyed by API group, which take precedence
+	// over the built-in doc sets. See KubeValidatorConfigSpec.Docs.
+	Templates map[string]string
+	// ReferenceVersion is the version of the Kubernetes API reference linked
+	// to from master schemas. See KubeValidatorConfigSpec.DocsVersion.
+	ReferenceVersion string
+}
+
+// newDocsResolver returns a docsResolver for a schema
+func newDocsResolver(schema *KubeValidatorConfigSchema, templates map[string]string, referenceVersion string) *docsResolver {
+	if referenceVersion == "" {
+		referenceVersion = defaultReferenceVersion
+	}
+	return &docsResolver{
+		Version:          schema.Version,
+		OpenShift:        schema.ConfigType == "openshift",
+		Templates:        templates,
+		ReferenceVersion: referenceVersion,
+	}
+}
+
+// URL returns a link to the documentation of the field found at path in a
+// resource, or an empty string if it isn't documented. Custom resources are
+// only documented by templates.
+func (r *docsResolver) URL(apiVersion string, kind string, path []string) string {
+	if kind == "" || apiVersion == "" {
+		return ""
+	}
+	group, version := splitAPIVersion(apiVersion)
+	if template, ok := r.Templates[group]; ok {
+		return expandDocsTemplate(template, group, version, kind, path)
+	}
+	if !isBuiltInGroup(group) {
+		return ""
+	}
+	if r.OpenShift {
+		return r.openShiftURL(group, version, kind)
+	}
+	return r.kubernetesURL(group, version, kind, path)
+}
+
+// kubernetesURL links to the type containing the field found at path in the
+// Kubernetes API reference
+func (r *docsResolver) kubernetesURL(group string, version string, kind string, path []string) string {
+	referenceVersion := r.ReferenceVersion
+	if r.Version != "" && r.Version != "master" {
+		parts := versionParts(r.Version)
+		referenceVersion = fmt.Sprintf("%d.%d", parts[0], parts[1])
+	}
+	return fmt.Sprintf("%s/v%s/#%s", kubernetesReferenceURL, referenceVersion, resolveType(apiType{kind, group, version}, path).anchor())
+}
+
+// openShiftURL links to the page documenting a kind in the OpenShift REST API
+// reference, which doesn't have anchors for fields
+func (r *docsResolver) openShiftURL(group string, version string, kind string) string {
+	referenceVersion := latestOpenShiftReferenceVersion
+	if parts := versionParts(r.Version); parts[0] == 3 {
+		referenceVersion = fmt.Sprintf("%d.%d", parts[0], parts[1])
+	}
+	directory := "api"
+	if group != "" {
+		directory = "apis-" + group
+	}
+	return fmt.Sprintf("%s/%s/rest_api/%s/%s.%s.html", openShiftReferenceURL, referenceVersion, directory, version, kind)
+}
+
+// resolveType returns the deepest type documenting the field found at path
+// in a resource of the root type
+func resolveType(root apiType, path []string) apiType {
+	current := root
+	for _, segment := range path {
+		// The items of an array share the type of its field
+		if _, err := strconv.Atoi(segment); err == nil {
+			continue
+		}
+		if current == root {
+			switch segment {
+			case "metadata":
+				current = objectMeta
+				continue
+			case "spec", "status":
+				current = apiType{root.Name + strings.ToUpper(segment[:1]) + segment[1:], root.Group, root.Version}
+				continue
+			}
+		}
+		next, ok := fieldTypes[current.Name][segment]
+		if !ok {
+			break
+		}
+		current = next
+	}
+	return current
+}
+
+// splitAPIVersion splits an apiVersion like apps/v1 into its group and
+// version. The core group is empty.
+func splitAPIVersion(apiVersion string) (string, string) {
+	parts := strings.SplitN(apiVersion, "/", 2)
+	if len(parts) == 1 {
+		return "", parts[0]
+	}
+	return parts[0], parts[1]
+}
+
+// isBuiltInGroup determines whether or not an API group is part of Kubernetes
+// or OpenShift. The groups of CustomResourceDefinitions must contain a dot,
+// and can't end in k8s.io without approval.
+func isBuiltInGroup(group string) bool {
+	return !strings.Contains(group, ".") || strings.HasSuffix(group, ".k8s.io") || strings.HasSuffix(group, ".openshift.io")
+}
+
+// expandDocsTemplate replaces the {group}, {version}, {kind} and {field}
+// placeholders of a template with their escaped values, where field is the
+// dotted path to a field
+func expandDocsTemplate(template string, group string, version string, kind string, path []string) string {
+	return strings.NewReplacer(
+		"{group}", url.PathEscape(group),
+		"{version}", url.PathEscape(version),
+		"{kind}", url.PathEscape(kind),
+		"{field}", url.PathEscape(strings.Join(path, ".")),
+	).Replace(template)
+}
+
+// withDocsLink appends a link to message, if there is one
+func withDocsLink(message string, url string) string {
+	if url == "" {
+		return message
+	}
+	return fmt.Sprintf("%s; see %s for more details", message, url)
+}
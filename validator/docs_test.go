@@ -0,0 +1,70 @@
+package validator
+
+import "testing"
+
+func TestDocsURL(t *testing.T) {
+	kubernetes := newDocsResolver(&KubeValidatorConfigSchema{Version: "1.13.0"}, nil, "")
+	master := newDocsResolver(&KubeValidatorConfigSchema{}, nil, "")
+	configuredMaster := newDocsResolver(&KubeValidatorConfigSchema{}, nil, "1.34")
+	openShift := newDocsResolver(&KubeValidatorConfigSchema{Version: "3.6.0", ConfigType: "openshift"}, nil, "")
+	templated := newDocsResolver(&KubeValidatorConfigSchema{Version: "1.13.0"}, map[string]string{
+		"stable.example.com": "https://example.com/docs/{group}/{version}/{kind}#{field}",
+	}, "")
+
+	tests := []struct {
+		name       string
+		resolver   *docsResolver
+		apiVersion string
+		kind       string
+		path       []string
+		want       string
+	}{
+		{"root", kubernetes, "apps/v1", "Deployment", nil, "https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.13/#deployment-v1-apps"},
+		{"spec", kubernetes, "apps/v1", "Deployment", []string{"spec", "replicas"}, "https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.13/#deploymentspec-v1-apps"},
+		{"metadata", kubernetes, "v1", "Service", []string{"metadata", "labels"}, "https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.13/#objectmeta-v1-meta"},
+		{"container", kubernetes, "apps/v1", "Deployment", []string{"spec", "template", "spec", "containers", "0", "image"}, "https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.13/#container-v1-core"},
+		{"probe", kubernetes, "apps/v1", "StatefulSet", []string{"spec", "template", "spec", "containers", "1", "livenessProbe", "httpGet"}, "https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.13/#probe-v1-core"},
+		{"core", kubernetes, "v1", "Service", []string{"spec", "ports", "0", "port"}, "https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.13/#serviceport-v1-core"},
+		{"dotted group", kubernetes, "networking.k8s.io/v1", "Ingress", []string{"spec", "rules", "0"}, "https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.13/#ingressrule-v1-networking-k8s-io"},
+		{"unknown field", kubernetes, "batch/v1", "CronJob", []string{"spec", "jobTemplate", "spec", "unknown", "field"}, "https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.13/#jobspec-v1-batch"},
+		{"master", master, "apps/v1", "Deployment", []string{"spec"}, "https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.32/#deploymentspec-v1-apps"},
+		{"configured master", configuredMaster, "apps/v1", "Deployment", []string{"spec"}, "https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.34/#deploymentspec-v1-apps"},
+		{"openshift", openShift, "apps.openshift.io/v1", "DeploymentConfig", []string{"spec"}, "https://docs.openshift.com/container-platform/3.6/rest_api/apis-apps.openshift.io/v1.DeploymentConfig.html"},
+		{"openshift core", openShift, "v1", "Pod", nil, "https://docs.openshift.com/container-platform/3.6/rest_api/api/v1.Pod.html"},
+		{"custom resource", kubernetes, "cert-manager.io/v1", "Certificate", []string{"spec"}, ""},
+		{"template", templated, "stable.example.com/v1", "CronTab", []string{"spec", "cronSpec"}, "https://example.com/docs/stable.example.com/v1/CronTab#spec.cronSpec"},
+		{"escaped template", templated, "stable.example.com/v1", "CronTab", []string{"metadata", "annotations", "example.com/a b"}, "https://example.com/docs/stable.example.com/v1/CronTab#metadata.annotations.example.com%2Fa%20b"},
+		{"missing kind", kubernetes, "v1", "", nil, ""},
+	}
+	for _, test := range tests {
+		if url := test.resolver.URL(test.apiVersion, test.kind, test.path); url != test.want {
+			t.Errorf("%s: expected %q, got %q", test.name, test.want, url)
+		}
+	}
+}
+
+func TestInvalidDocsTemplatesAreNotValid(t *testing.T) {
+	config := &KubeValidatorConfig{
+		Spec: &KubeValidatorConfigSpec{
+			Docs: map[string]string{"stable.example.com": "javascript:alert(1)"},
+		},
+	}
+	if config.Valid() {
+		t.Errorf("Config expected to be invalid: %+v", config.Spec)
+	}
+}
+
+func TestInvalidDocsVersionsAreNotValid(t *testing.T) {
+	for _, version := range []string{"1.34", "2.0"} {
+		config := &KubeValidatorConfig{Spec: &KubeValidatorConfigSpec{DocsVersion: version}}
+		if !config.Valid() {
+			t.Errorf("Config expected to be valid: %+v", config.Spec)
+		}
+	}
+	for _, version := range []string{"v1.34", "1.34.0", "latest"} {
+		config := &KubeValidatorConfig{Spec: &KubeValidatorConfigSpec{DocsVersion: version}}
+		if config.Valid() {
+			t.Errorf("Config expected to be invalid: %+v", config.Spec)
+		}
+	}
+}
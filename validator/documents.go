@@ -0,0 +1,101 @@
+package validator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// listItem is a resource found in a document, which is either the document
+// itself or one of the items of a List
+type listItem struct {
+	// pointer is the JSON pointer of the item within its document, which is
+	// empty unless the document is a List
+	pointer string
+	body    map[string]interface{}
+	// err is set when the item of a List isn't an object, leaving body empty
+	err *parseError
+}
+
+// isListKind determines whether or not kind is a List like v1/List or
+// DeploymentList
+func isListKind(kind string) bool {
+	return strings.HasSuffix(kind, "List")
+}
+
+// expandList returns the items of a List, or the document itself if it isn't
+// a List
+func expandList(body map[string]interface{}) []listItem {
+	kind, _ := body["kind"].(string)
+	items, ok := body["items"].([]interface{})
+	if !isListKind(kind) || !ok {
+		return []listItem{{body: body}}
+	}
+	expanded := make([]listItem, 0, len(items))
+	for i, item := range items {
+		itemBody, ok := item.(map[string]interface{})
+		expanded = append(expanded, listItem{
+			pointer: fmt.Sprintf("/items/%d", i),
+			body:    itemBody,
+		})
+		if !ok {
+			expanded[i].err = &parseError{Message: fmt.Sprintf("Expected items[%d] of %s to be a resource, got %v", i, kind, item)}
+		}
+	}
+	return expanded
+}
+
+// isJSON determines whether or not b contains a single JSON document rather
+// than YAML, which may also start with a flow mapping or sequence
+func isJSON(b []byte) bool {
+	return json.Valid(bytes.TrimSpace(b))
+}
+
+// parseErrorLine matches the line yaml.v2 includes in most of its errors
+var parseErrorLine = regexp.MustCompile(`^yaml: line (\d+): `)
+
+// parseError describes a document which couldn't be decoded
+type parseError struct {
+	// Line and Column are the position of the error within its document, or
+	// zero when the parser doesn't provide them
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *parseError) Error() string {
+	if e.Line == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// newParseError extracts the position yaml.v2 reports from err, which
+// occurred while decoding document
+func newParseError(document []byte, err error) *parseError {
+	message := strings.TrimPrefix(err.Error(), "yaml: ")
+	match := parseErrorLine.FindStringSubmatch(err.Error())
+	if match == nil {
+		return &parseError{Message: message}
+	}
+	line, _ := strconv.Atoi(match[1])
+	e := &parseError{
+		Line:    line,
+		Message: strings.TrimPrefix(err.Error(), match[0]),
+	}
+
+	// yaml.v2 doesn't report columns, but the character which can't start a
+	// token is the first one on the line which YAML reserves
+	if strings.HasPrefix(e.Message, "found character that cannot start any token") {
+		lines := strings.Split(string(document), "\n")
+		if line <= len(lines) {
+			if i := strings.IndexAny(lines[line-1], "\t@`"); i >= 0 {
+				e.Column = i + 1
+			}
+		}
+	}
+	return e
+}
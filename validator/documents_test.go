@@ -0,0 +1,114 @@
+package validator
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/google/go-github/github"
+)
+
+func TestLocateJSONPointer(t *testing.T) {
+	b, err := ioutil.ReadFile("../fixtures/json/deployment.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		pointer   string
+		startLine int
+		endLine   int
+	}{
+		{"/spec/replicas", 8, 8},
+		{"/metadata", 4, 6},
+		{"/spec/template/spec/containers/0", 22, 26},
+		{"/spec/template/spec/containers/0/extra", 25, 25},
+		{"/spec/missing", 1, 1},
+	}
+	for _, test := range tests {
+		startLine, endLine := detectLineNumbersForPath(&b, test.pointer)
+		if startLine != test.startLine || endLine != test.endLine {
+			t.Errorf("%s: expected lines %d-%d, got %d-%d", test.pointer, test.startLine, test.endLine, startLine, endLine)
+		}
+	}
+}
+
+func TestExpandList(t *testing.T) {
+	deployment := map[string]interface{}{"kind": "Deployment"}
+	if diff := deep.Equal(expandList(deployment), []listItem{{body: deployment}}); diff != nil {
+		t.Error(diff)
+	}
+
+	service := map[string]interface{}{"kind": "Service"}
+	list := map[string]interface{}{
+		"kind":  "ServiceList",
+		"items": []interface{}{service, service},
+	}
+	want := []listItem{{pointer: "/items/0", body: service}, {pointer: "/items/1", body: service}}
+	if diff := deep.Equal(expandList(list), want); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestValidateJSONAndLists(t *testing.T) {
+	schemaDir, _ := filepath.Abs("../fixtures/schemas")
+	ctx := context.Background()
+	c := &Context{
+		Ctx:       &ctx,
+		Event:     &github.CheckSuiteEvent{},
+		SchemaDir: schemaDir,
+	}
+	schemas := []*KubeValidatorConfigSchema{{}}
+
+	tests := []struct {
+		filename string
+		want     []int
+		messages []string
+	}{
+		{
+			"fixtures/json/deployment.json",
+			[]int{25, 8},
+			[]string{
+				"extra: Additional property extra is not allowed; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.32/#container-v1-core for more details",
+				"spec.replicas: Invalid type. Expected: integer, given: string; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.32/#deploymentspec-v1-apps for more details",
+			},
+		},
+		{
+			"fixtures/lists/deployments.yaml",
+			[]int{25},
+			[]string{"spec.replicas: Invalid type. Expected: integer, given: string; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.32/#deploymentspec-v1-apps for more details"},
+		},
+		{
+			"fixtures/flow/deployments.yaml",
+			[]int{3},
+			[]string{"spec.replicas: Invalid type. Expected: integer, given: string; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.32/#deploymentspec-v1-apps for more details"},
+		},
+		{
+			"fixtures/lists/invalid-items.yaml",
+			[]int{20},
+			[]string{"Expected items[1] of List to be a resource, got web"},
+		},
+	}
+	for _, test := range tests {
+		b, err := ioutil.ReadFile(filepath.Join("..", test.filename))
+		if err != nil {
+			t.Fatal(err)
+		}
+		candidate := NewCandidate(c, &github.CommitFile{Filename: github.String(test.filename)}, schemas)
+		candidate.setBytes(&b)
+		annotations := candidate.Validate()
+		if len(annotations) != len(test.want) {
+			t.Errorf("%s: expected %d annotations, got %s", test.filename, len(test.want), github.Stringify(annotations))
+			continue
+		}
+		for i, annotation := range annotations {
+			if annotation.GetStartLine() != test.want[i] || annotation.GetMessage() != test.messages[i] {
+				t.Errorf("%s: expected %q on line %d, got %q on line %d", test.filename, test.messages[i], test.want[i], annotation.GetMessage(), annotation.GetStartLine())
+			}
+		}
+		if len(candidate.rows) != 2 && test.filename == "fixtures/lists/deployments.yaml" {
+			t.Errorf("expected a row in the compatibility matrix for each item of the list, got %d", len(candidate.rows))
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package validator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// group returns the API group of the resource, which is empty for the core
+// group
+func (r *indexedResource) group() string {
+	if i := strings.Index(r.APIVersion, "/"); i >= 0 {
+		return r.APIVersion[:i]
+	}
+	return ""
+}
+
+// identity identifies a resource within a cluster. Resources without a
+// namespace are assumed to be in the default namespace.
+func (r *indexedResource) identity() string {
+	return fmt.Sprintf("%s/%s/%s/%s", r.group(), r.Kind, r.namespace(), r.Name)
+}
+
+// location returns a link to the line the resource starts on
+func (r *indexedResource) location() string {
+	if r.file.GetBlobURL() == "" {
+		return fmt.Sprintf("%s line %d", r.file.GetFilename(), r.startLine)
+	}
+	return fmt.Sprintf("%s#L%d", r.file.GetBlobURL(), r.startLine)
+}
+
+// duplicateResources returns an annotation for each of the resources being
+// validated which is defined more than once
+func (i *resourceIndex) duplicateResources() Annotations {
+	var annotations Annotations
+	definitions := make(map[string][]*indexedResource)
+	for _, resource := range i.resources {
+		definitions[resource.identity()] = append(definitions[resource.identity()], resource)
+	}
+
+	for _, resource := range i.resources {
+		duplicates := definitions[resource.identity()]
+		if resource.candidate == nil || len(duplicates) < 2 {
+			continue
+		}
+
+		var locations []string
+		for _, duplicate := range duplicates {
+			if duplicate != resource {
+				locations = append(locations, duplicate.location())
+			}
+		}
+		namespace := fmt.Sprintf("namespace %s", resource.namespace())
+		if resource.namespace() == "default" {
+			namespace = "the default namespace"
+		}
+		startLine, endLine := resource.lineNumbers([]string{"metadata", "name"})
+		annotations = append(annotations, &github.CheckRunAnnotation{
+			Path:            resource.file.Filename,
+			BlobHRef:        resource.file.BlobURL,
+			StartLine:       github.Int(startLine),
+			EndLine:         github.Int(endLine),
+			AnnotationLevel: github.String(resource.candidate.level("duplicate_resource", "", resource.Kind, "failure")),
+			Title:           github.String(fmt.Sprintf("%s is defined more than once in %s", resource, namespace)),
+			Message:         github.String(fmt.Sprintf("%s is also defined at %s", resource, strings.Join(locations, ", "))),
+		})
+	}
+	sort.Sort(annotations)
+	return annotations
+}
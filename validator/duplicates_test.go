@@ -0,0 +1,102 @@
+package validator
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+func TestDuplicateResources(t *testing.T) {
+	base := &github.CommitFile{
+		Filename: github.String("fixtures/duplicates/base/web.yaml"),
+		BlobURL:  github.String("https://github.com/o/r/blob/abc/fixtures/duplicates/base/web.yaml"),
+	}
+	production := &github.CommitFile{
+		Filename: github.String("fixtures/duplicates/production/web.yaml"),
+		BlobURL:  github.String("https://github.com/o/r/blob/abc/fixtures/duplicates/production/web.yaml"),
+	}
+	baseContents, _ := ioutil.ReadFile("../fixtures/duplicates/base/web.yaml")
+	productionContents, _ := ioutil.ReadFile("../fixtures/duplicates/production/web.yaml")
+
+	index := newResourceIndex()
+	index.Add(base, baseContents, nil)
+	candidate := NewCandidate(&Context{}, production, nil)
+	candidate.setBytes(&productionContents)
+	index.Add(production, productionContents, candidate)
+
+	annotations := index.duplicateResources()
+	if len(annotations) != 1 {
+		t.Fatalf("expected 1 annotation, got %s", github.Stringify(annotations))
+	}
+	annotation := annotations[0]
+	if annotation.GetPath() != "fixtures/duplicates/production/web.yaml" {
+		t.Errorf("unexpected path %s", annotation.GetPath())
+	}
+	if annotation.GetStartLine() != 28 {
+		t.Errorf("expected the annotation to start on line 28, got %d", annotation.GetStartLine())
+	}
+	if annotation.GetTitle() != "Deployment web is defined more than once in namespace production" {
+		t.Errorf("unexpected title %q", annotation.GetTitle())
+	}
+	if annotation.GetMessage() != "Deployment web is also defined at https://github.com/o/r/blob/abc/fixtures/duplicates/base/web.yaml#L1" {
+		t.Errorf("unexpected message %q", annotation.GetMessage())
+	}
+}
+
+func TestDuplicateResourcesInChangedFiles(t *testing.T) {
+	index := newResourceIndex()
+	for _, filename := range []string{"fixtures/duplicates/base/web.yaml", "fixtures/duplicates/production/web.yaml"} {
+		file := &github.CommitFile{
+			Filename: github.String(filename),
+		}
+		fileContents, _ := ioutil.ReadFile("../" + filename)
+		candidate := NewCandidate(&Context{}, file, nil)
+		candidate.setBytes(&fileContents)
+		index.Add(file, fileContents, candidate)
+	}
+
+	annotations := index.duplicateResources()
+	want := []string{
+		"Deployment web is also defined at fixtures/duplicates/base/web.yaml line 1",
+		"Deployment web is also defined at fixtures/duplicates/production/web.yaml line 25",
+	}
+	if len(annotations) != len(want) {
+		t.Fatalf("a total of %d annotations were returned, wanted %d: %s", len(annotations), len(want), github.Stringify(annotations))
+	}
+	for _, w := range want {
+		found := false
+		for _, annotation := range annotations {
+			if annotation.GetMessage() == w {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected an annotation with message %q in %s", w, github.Stringify(annotations))
+		}
+	}
+}
+
+func TestDuplicateResourcesInTheDefaultNamespace(t *testing.T) {
+	index := newResourceIndex()
+	for i, namespace := range []string{"", "  namespace: default\n"} {
+		file := &github.CommitFile{
+			Filename: github.String(fmt.Sprintf("web-%d.yaml", i)),
+		}
+		contents := []byte("apiVersion: v1\nkind: Service\nmetadata:\n  name: web\n" + namespace)
+		candidate := NewCandidate(&Context{}, file, nil)
+		candidate.setBytes(&contents)
+		index.Add(file, contents, candidate)
+	}
+
+	annotations := index.duplicateResources()
+	if len(annotations) != 2 {
+		t.Fatalf("expected 2 annotations, got %s", github.Stringify(annotations))
+	}
+	for _, annotation := range annotations {
+		if annotation.GetTitle() != "Service web is defined more than once in the default namespace" {
+			t.Errorf("unexpected title %q", annotation.GetTitle())
+		}
+	}
+}
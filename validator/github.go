@@ -3,6 +3,7 @@ package validator
 import (
 	"fmt"
 	"log"
+	"path"
 	"strings"
 	"time"
 
@@ -16,10 +17,24 @@ const (
 	initialCheckRunSummary = "Validating..."
 	noMatchingFiles        = "No files to validate"
 	configPath             = ".github/kubevalidator.yaml"
+
+	// annotationsPerRequest is the most annotations the Checks API accepts in
+	// a single request
+	annotationsPerRequest = 50
+	// maxAnnotations is the most annotations written to a check run. The rest
+	// are listed in its text.
+	maxAnnotations = 1000
+	// maxTextLength is the most characters the Checks API accepts in the text
+	// of a check run, and in its summary
+	maxTextLength = 65535
+	// summaryNotesLength is reserved at the end of the summary of a check run
+	// for notes about unreported annotations
+	summaryNotesLength = 1024
 )
 
 // createInitialCheckRun contains the logic which sets the title and summary
-// of the check
+// of the check. Its ID is kept so that the same check run is updated as
+// validation progresses.
 func (c *Context) createInitialCheckRun(e *github.CheckSuiteEvent) error {
 	checkRunOpt := github.CreateCheckRunOptions{
 		Name:       checkRunName,
@@ -33,33 +48,93 @@ func (c *Context) createInitialCheckRun(e *github.CheckSuiteEvent) error {
 		},
 	}
 
-	_, _, err := c.Github.Checks.CreateCheckRun(*c.Ctx, e.Repo.GetOwner().GetLogin(), e.Repo.GetName(), checkRunOpt)
+	checkRun, _, err := c.Github.Checks.CreateCheckRun(*c.Ctx, e.Repo.GetOwner().GetLogin(), e.Repo.GetName(), checkRunOpt)
 	if err != nil {
 		log.Println(errors.Wrap(err, "Couldn't create check run"))
 		return err
 	}
+	c.checkRunID = checkRun.GetID()
 	return nil
 }
 
-func (c *Context) createConfigMissingCheckRun(startedAt *time.Time, e *github.CheckSuiteEvent) error {
-	checkRunOpt := github.CreateCheckRunOptions{
-		Name:        checkRunName,
-		HeadBranch:  e.CheckSuite.GetHeadBranch(),
-		HeadSHA:     e.CheckSuite.GetHeadSHA(),
-		Status:      github.String("completed"),
-		Conclusion:  github.String("neutral"),
-		StartedAt:   &github.Timestamp{Time: *startedAt},
-		CompletedAt: &github.Timestamp{Time: time.Now()},
+// reportProgress updates the summary of the check run while it's in progress
+func (c *Context) reportProgress(e *github.CheckSuiteEvent, summary string) {
+	if c.checkRunID == 0 {
+		return
+	}
+	_, _, err := c.Github.Checks.UpdateCheckRun(*c.Ctx, e.Repo.GetOwner().GetLogin(), e.Repo.GetName(), c.checkRunID, github.UpdateCheckRunOptions{
+		Name:   checkRunName,
+		Status: github.String("in_progress"),
 		Output: &github.CheckRunOutput{
-			Title:       github.String("No configuration"),
-			Summary:     github.String(fmt.Sprintf("kubevalidator needs a tiny bit of configuration to know where to find the Kubernetes YAML in your Repository.\n\n1. Check out the [documentation and examples](https://github.com/urcomputeringpal/kubevalidator#configuration).\n1. Add your configuration to [`.github/kubevalidator.yaml`](https://github.com/%s/%s/new/%s?filename=.github/kubevalidator.yaml)\n1. Profit???", e.Repo.GetOwner().GetLogin(), e.Repo.GetName(), e.CheckSuite.GetHeadBranch())),
-			Annotations: nil,
+			Title:   github.String(initialCheckRunSummary),
+			Summary: github.String(summary),
 		},
+	})
+	if err != nil {
+		log.Println(errors.Wrap(err, "Couldn't report progress"))
+	}
+}
+
+// concludeCheckRun completes the check run created by createInitialCheckRun,
+// or creates a completed one if it couldn't be created
+func (c *Context) concludeCheckRun(startedAt *time.Time, e *github.CheckSuiteEvent, conclusion string, output *github.CheckRunOutput) error {
+	completedAt := &github.Timestamp{Time: time.Now()}
+	if c.checkRunID == 0 {
+		checkRun, _, err := c.Github.Checks.CreateCheckRun(*c.Ctx, e.Repo.GetOwner().GetLogin(), e.Repo.GetName(), github.CreateCheckRunOptions{
+			Name:        checkRunName,
+			HeadBranch:  e.CheckSuite.GetHeadBranch(),
+			HeadSHA:     e.CheckSuite.GetHeadSHA(),
+			Status:      github.String("completed"),
+			Conclusion:  github.String(conclusion),
+			StartedAt:   &github.Timestamp{Time: *startedAt},
+			CompletedAt: completedAt,
+			Output:      output,
+		})
+		if err != nil {
+			return errors.Wrap(err, "Couldn't create check run")
+		}
+		c.checkRunID = checkRun.GetID()
+		return nil
+	}
+
+	_, _, err := c.Github.Checks.UpdateCheckRun(*c.Ctx, e.Repo.GetOwner().GetLogin(), e.Repo.GetName(), c.checkRunID, github.UpdateCheckRunOptions{
+		Name:        checkRunName,
+		Status:      github.String("completed"),
+		Conclusion:  github.String(conclusion),
+		CompletedAt: completedAt,
+		Output:      output,
+	})
+	if err != nil {
+		return errors.Wrap(err, "Couldn't complete check run")
 	}
+	return nil
+}
 
-	_, _, err := c.Github.Checks.CreateCheckRun(*c.Ctx, e.Repo.GetOwner().GetLogin(), e.Repo.GetName(), checkRunOpt)
+// failCheckRunOnPanic marks the check run as failed rather than leaving it in
+// progress when validation panics. It must be deferred, and re-panics.
+func (c *Context) failCheckRunOnPanic(startedAt *time.Time, e *github.CheckSuiteEvent) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	err := c.concludeCheckRun(startedAt, e, "failure", &github.CheckRunOutput{
+		Title:   github.String("Internal error"),
+		Summary: github.String("kubevalidator crashed while validating this commit. Re-run the check to try again, and please do [reach out](https://github.com/urcomputeringpal/kubevalidator/issues/new/choose) if it keeps happening!"),
+	})
 	if err != nil {
-		log.Println(errors.Wrap(err, "Couldn't create check run"))
+		log.Println(err)
+	}
+	panic(r)
+}
+
+func (c *Context) createConfigMissingCheckRun(startedAt *time.Time, e *github.CheckSuiteEvent) error {
+	err := c.concludeCheckRun(startedAt, e, "neutral", &github.CheckRunOutput{
+		Title:       github.String("No configuration"),
+		Summary:     github.String(fmt.Sprintf("kubevalidator needs a tiny bit of configuration to know where to find the Kubernetes YAML in your Repository.\n\n1. Check out the [documentation and examples](https://github.com/urcomputeringpal/kubevalidator#configuration).\n1. Add your configuration to [`.github/kubevalidator.yaml`](https://github.com/%s/%s/new/%s?filename=.github/kubevalidator.yaml)\n1. Profit???", e.Repo.GetOwner().GetLogin(), e.Repo.GetName(), e.CheckSuite.GetHeadBranch())),
+		Annotations: nil,
+	})
+	if err != nil {
+		log.Println(err)
 		return err
 	}
 	return nil
@@ -67,40 +142,50 @@ func (c *Context) createConfigMissingCheckRun(startedAt *time.Time, e *github.Ch
 
 func (c *Context) createConfigInvalidCheckRun(startedAt *time.Time, e *github.CheckSuiteEvent, annotations []*github.CheckRunAnnotation) error {
 	configURL := fmt.Sprintf("https://github.com/%s/%s/blob/%s/%s", e.Repo.GetOwner().GetLogin(), e.Repo.GetName(), e.CheckSuite.GetHeadBranch(), configPath)
-	checkRunOpt := github.CreateCheckRunOptions{
-		Name:        checkRunName,
-		HeadBranch:  e.CheckSuite.GetHeadBranch(),
-		HeadSHA:     e.CheckSuite.GetHeadSHA(),
-		Status:      github.String("completed"),
-		Conclusion:  github.String("failure"),
-		StartedAt:   &github.Timestamp{Time: *startedAt},
-		CompletedAt: &github.Timestamp{Time: time.Now()},
-		Output: &github.CheckRunOutput{
-			Title:       github.String("Configuration invalid"),
-			Summary:     github.String(fmt.Sprintf("Check out the [documentation and examples](https://github.com/urcomputeringpal/kubevalidator#configuration) and [update your configuration to match](%v). Please do [reach out](https://github.com/urcomputeringpal/kubevalidator/issues/new/choose) if you're having trouble or think you've have found a bug!", configURL)),
-			Annotations: annotations,
-		},
+	err := c.concludeCheckRun(startedAt, e, "failure", &github.CheckRunOutput{
+		Title:       github.String("Configuration invalid"),
+		Summary:     github.String(fmt.Sprintf("Check out the [documentation and examples](https://github.com/urcomputeringpal/kubevalidator#configuration) and [update your configuration to match](%v). Please do [reach out](https://github.com/urcomputeringpal/kubevalidator/issues/new/choose) if you're having trouble or think you've have found a bug!", configURL)),
+		Annotations: annotations,
+	})
+	if err != nil {
+		log.Println(err)
+		return err
 	}
+	return nil
+}
 
-	_, _, err := c.Github.Checks.CreateCheckRun(*c.Ctx, e.Repo.GetOwner().GetLogin(), e.Repo.GetName(), checkRunOpt)
+// createErrorCheckRun fails the check run when an error prevents validation
+// from being completed, so that it isn't left in progress
+func (c *Context) createErrorCheckRun(startedAt *time.Time, e *github.CheckSuiteEvent, title string, validationErr error) error {
+	err := c.concludeCheckRun(startedAt, e, "failure", &github.CheckRunOutput{
+		Title:   github.String(title),
+		Summary: github.String(fmt.Sprintf("kubevalidator couldn't finish validating this commit: %s\n\nRe-run the check to try again, and please do [reach out](https://github.com/urcomputeringpal/kubevalidator/issues/new/choose) if it keeps happening!", validationErr)),
+	})
 	if err != nil {
-		log.Println(errors.Wrap(err, "Couldn't create check run"))
+		log.Println(err)
 		return err
 	}
 	return nil
 }
 
-// createFinalCheckRun concludes the check run
-func (c *Context) createFinalCheckRun(startedAt *time.Time, e *github.CheckSuiteEvent, candidates Candidates, annotations []*github.CheckRunAnnotation) error {
+// createFinalCheckRun concludes the check run with the results of validation.
+// Unreported annotations are only counted in its summary, separating those in
+// the changed files from the rest.
+func (c *Context) createFinalCheckRun(startedAt *time.Time, e *github.CheckSuiteEvent, candidates Candidates, annotations []*github.CheckRunAnnotation, unreported Annotations, changedFiles []*github.CommitFile, failOn string) error {
 	var checkRunConclusion string
 	var checkRunText string
 	var checkRunSummary string
+	var checkRunOutputText *string
 	numFiles := len(candidates)
 	if numFiles == 0 {
 		checkRunConclusion = "neutral"
 		checkRunText = noMatchingFiles
 		configURL := fmt.Sprintf("https://github.com/%s/%s/blob/%s/%s", e.Repo.GetOwner().GetLogin(), e.Repo.GetName(), e.CheckSuite.GetHeadBranch(), configPath)
-		checkRunSummary = fmt.Sprintf("None of the files changed on this Pull Request matched the configuration in [`%s`](%s). Please do [reach out](https://github.com/urcomputeringpal/kubevalidator/issues/new/choose) if you're having trouble or think you've have found a bug!", configPath, configURL)
+		changes := "on this Pull Request"
+		if len(e.CheckSuite.PullRequests) == 0 {
+			changes = "by this push"
+		}
+		checkRunSummary = fmt.Sprintf("None of the files changed %s matched the configuration in [`%s`](%s). Please do [reach out](https://github.com/urcomputeringpal/kubevalidator/issues/new/choose) if you're having trouble or think you've have found a bug!", changes, configPath, configURL)
 	} else {
 		// MVP pluralization
 		filesString := "files"
@@ -110,42 +195,82 @@ func (c *Context) createFinalCheckRun(startedAt *time.Time, e *github.CheckSuite
 			filesString = "file"
 		}
 
-		if len(annotations) == 1 {
+		numErrors := Annotations(annotations).countLevel("failure")
+		numWarnings := Annotations(annotations).countLevel("warning")
+		numNotices := Annotations(annotations).countLevel("notice")
+
+		if numErrors == 1 {
 			errorsString = "error"
 		}
 
-		if len(annotations) > 0 {
-			checkRunConclusion = "failure"
-		} else {
-			checkRunConclusion = "success"
+		checkRunConclusion = Annotations(annotations).conclusion(failOn)
+		checkRunText = fmt.Sprintf("%d %s checked, %d %s", numFiles, filesString, numErrors, errorsString)
+		if numWarnings == 1 {
+			checkRunText = fmt.Sprintf("%s, 1 warning", checkRunText)
+		} else if numWarnings > 1 {
+			checkRunText = fmt.Sprintf("%s, %d warnings", checkRunText, numWarnings)
+		}
+		if numNotices == 1 {
+			checkRunText = fmt.Sprintf("%s, 1 notice", checkRunText)
+		} else if numNotices > 1 {
+			checkRunText = fmt.Sprintf("%s, %d notices", checkRunText, numNotices)
 		}
-		checkRunText = fmt.Sprintf("%d %s checked, %d %s", numFiles, filesString, len(annotations), errorsString)
 
 		var list []string
 		for _, c := range candidates {
 			list = append(list, c.MarkdownListItem())
 		}
-		checkRunSummary = strings.Join(list, "\n")
+		checkRunSummary = truncateList(list, (maxTextLength-summaryNotesLength)/2)
+
+		if matrix := candidates.compatibilityMatrix(maxTextLength - summaryNotesLength - len(checkRunSummary)); matrix != "" {
+			checkRunSummary = fmt.Sprintf("%s\n\n### Compatibility\n\n%s", checkRunSummary, matrix)
+		}
+		if summary := unreported.unreportedSummary(changedFiles); summary != "" {
+			checkRunSummary = fmt.Sprintf("%s\n\n%s", checkRunSummary, summary)
+		}
 	}
 
-	checkRunOpt := github.CreateCheckRunOptions{
-		Name:        checkRunName,
-		HeadBranch:  e.CheckSuite.GetHeadBranch(),
-		HeadSHA:     e.CheckSuite.GetHeadSHA(),
-		Status:      github.String("completed"),
-		Conclusion:  &checkRunConclusion,
-		StartedAt:   &github.Timestamp{Time: *startedAt},
-		CompletedAt: &github.Timestamp{Time: time.Now()},
-		Output: &github.CheckRunOutput{
-			Title:       &checkRunText,
-			Summary:     &checkRunSummary,
-			Annotations: annotations,
-		},
+	if len(annotations) > maxAnnotations {
+		var overflow Annotations
+		annotations, overflow = Annotations(annotations).truncate(maxAnnotations)
+		checkRunSummary = fmt.Sprintf("%s\n\nOnly %d of the %d annotations are shown. The rest are listed below.", checkRunSummary, maxAnnotations, maxAnnotations+len(overflow))
+		checkRunOutputText = github.String(overflow.overflowReport())
+	}
+	batches := Annotations(annotations).batches(annotationsPerRequest)
+
+	// Every batch but the last is added to the annotations already written
+	// while the check run is still in progress. It's only completed along
+	// with the last batch.
+	if len(batches) > 1 && c.checkRunID == 0 {
+		if err := c.createInitialCheckRun(e); err != nil {
+			return err
+		}
+	}
+	for _, batch := range batches[:len(batches)-1] {
+		_, _, err := c.Github.Checks.UpdateCheckRun(*c.Ctx, e.Repo.GetOwner().GetLogin(), e.Repo.GetName(), c.checkRunID, github.UpdateCheckRunOptions{
+			Name:   checkRunName,
+			Status: github.String("in_progress"),
+			Output: &github.CheckRunOutput{
+				Title:       &checkRunText,
+				Summary:     &checkRunSummary,
+				Text:        checkRunOutputText,
+				Annotations: batch,
+			},
+		})
+		if err != nil {
+			log.Println(errors.Wrap(err, "Couldn't add annotations to check run"))
+			return err
+		}
 	}
 
-	_, _, err := c.Github.Checks.CreateCheckRun(*c.Ctx, e.Repo.GetOwner().GetLogin(), e.Repo.GetName(), checkRunOpt)
+	err := c.concludeCheckRun(startedAt, e, checkRunConclusion, &github.CheckRunOutput{
+		Title:       &checkRunText,
+		Summary:     &checkRunSummary,
+		Text:        checkRunOutputText,
+		Annotations: batches[len(batches)-1],
+	})
 	if err != nil {
-		log.Println(errors.Wrap(err, "Couldn't create check run"))
+		log.Println(err)
 		return err
 	}
 	return nil
@@ -203,24 +328,208 @@ func (c *Context) kubeValidatorConfigOrAnnotation(e *github.CheckSuiteEvent) (*K
 	return config, nil, nil
 }
 
+// changedFileList lists the files added or changed by the check suite's pull
+// requests. Check suites without pull requests, like those of pushes to the
+// default branch, list the files changed by the push instead.
 func (c *Context) changedFileList(e *github.CheckSuiteEvent) ([]*github.CommitFile, error) {
+	if len(e.CheckSuite.PullRequests) == 0 {
+		files, err := c.pushFileList(e)
+		if err != nil {
+			return nil, err
+		}
+		return addedOrChangedFiles(files), nil
+	}
+
 	var prFiles []*github.CommitFile
 	for _, pr := range e.CheckSuite.PullRequests {
-		files, _, prListErr := c.Github.PullRequests.ListFiles(*c.Ctx, e.Repo.GetOwner().GetLogin(), e.Repo.GetName(), pr.GetNumber(), &github.ListOptions{})
+		files, prListErr := c.pullRequestFiles(e, pr.GetNumber())
 		if prListErr != nil {
-			return nil, errors.Wrap(prListErr, "Couldn't list files")
+			return nil, prListErr
 		}
-		for _, file := range files {
-			switch status := file.GetStatus(); status {
-			// skip files that weren't added or changed
-			case "removed":
-				continue
-			default:
-				prFiles = append(prFiles, file)
-			}
+		prFiles = append(prFiles, addedOrChangedFiles(files)...)
+	}
+	return prFiles, nil
+}
 
+// pullRequestFiles lists every page of the files changed by a pull request
+func (c *Context) pullRequestFiles(e *github.CheckSuiteEvent, number int) ([]*github.CommitFile, error) {
+	var files []*github.CommitFile
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		page, resp, err := c.Github.PullRequests.ListFiles(*c.Ctx, e.Repo.GetOwner().GetLogin(), e.Repo.GetName(), number, opt)
+		if err != nil {
+			return nil, errors.Wrap(err, "Couldn't list files")
 		}
+		files = append(files, page...)
+		if resp.NextPage == 0 {
+			return files, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// maxComparedFiles is the most files GitHub lists when comparing commits or
+// getting a single commit
+const maxComparedFiles = 300
 
+// pushFileList lists the files changed by the push which created a check
+// suite by comparing the commits before and after it. Pushes which create a
+// branch have nothing to compare to, so the files changed by the head commit
+// are listed instead. When GitHub may have left changed files out of the list,
+// every file in the repository is listed instead so that none go unvalidated.
+func (c *Context) pushFileList(e *github.CheckSuiteEvent) ([]*github.CommitFile, error) {
+	owner := e.Repo.GetOwner().GetLogin()
+	repo := e.Repo.GetName()
+	head := e.CheckSuite.GetAfterSHA()
+	if head == "" {
+		head = e.CheckSuite.GetHeadSHA()
+	}
+
+	before := e.CheckSuite.GetBeforeSHA()
+	if strings.Trim(before, "0") == "" {
+		commit, _, err := c.Github.Repositories.GetCommit(*c.Ctx, owner, repo, head)
+		if err != nil {
+			return nil, errors.Wrap(err, "Couldn't get commit")
+		}
+		if len(commit.Files) >= maxComparedFiles {
+			log.Printf("commit %s of %s/%s may change more than %d files, listing every file instead", head, owner, repo, maxComparedFiles)
+			return c.treeFileList(e)
+		}
+		return commitFilePointers(commit.Files), nil
+	}
+
+	comparison, _, err := c.Github.Repositories.CompareCommits(*c.Ctx, owner, repo, before, head)
+	if err != nil {
+		return nil, errors.Wrap(err, "Couldn't compare commits")
+	}
+	if len(comparison.Files) >= maxComparedFiles {
+		log.Printf("%s...%s of %s/%s may change more than %d files, listing every file instead", before, head, owner, repo, maxComparedFiles)
+		return c.treeFileList(e)
+	}
+	return commitFilePointers(comparison.Files), nil
+}
+
+// addedOrChangedFiles skips files that weren't added or changed
+func addedOrChangedFiles(files []*github.CommitFile) []*github.CommitFile {
+	var changed []*github.CommitFile
+	for _, file := range files {
+		switch status := file.GetStatus(); status {
+		case "removed":
+			continue
+		default:
+			changed = append(changed, file)
+		}
+	}
+	return changed
+}
+
+// commitFilePointers converts the files of commits and comparisons to the
+// pointers listed for pull requests
+func commitFilePointers(files []github.CommitFile) []*github.CommitFile {
+	var pointers []*github.CommitFile
+	for i := range files {
+		pointers = append(pointers, &files[i])
+	}
+	return pointers
+}
+
+// truncateList joins the items of a Markdown list, leaving out and counting
+// those which don't fit in maxLength characters
+func truncateList(items []string, maxLength int) string {
+	var list []string
+	length := 0
+	for i, item := range items {
+		more := fmt.Sprintf("* ...and %d more files", len(items)-i)
+		if length+len(item)+len(more)+2 > maxLength {
+			list = append(list, more)
+			break
+		}
+		list = append(list, item)
+		length += len(item) + 1
+	}
+	return strings.Join(list, "\n")
+}
+
+// treeFileList lists every file in the repository at the head of the check
+// suite. The list is only loaded once per check suite.
+func (c *Context) treeFileList(e *github.CheckSuiteEvent) ([]*github.CommitFile, error) {
+	if c.tree != nil {
+		return c.tree, nil
+	}
+	owner := e.Repo.GetOwner().GetLogin()
+	repo := e.Repo.GetName()
+	headSHA := e.CheckSuite.GetHeadSHA()
+	tree, _, err := c.Github.Git.GetTree(*c.Ctx, owner, repo, headSHA, true)
+	if err != nil {
+		return nil, errors.Wrap(err, "Couldn't list files")
+	}
+	entries := tree.Entries
+	if tree.GetTruncated() {
+		// GitHub limits the size of recursive trees, so large repositories
+		// are listed a directory at a time instead
+		log.Printf("tree for %s/%s@%s was truncated, listing it a directory at a time", owner, repo, headSHA)
+		entries, err = c.walkTree(e, headSHA, "")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var files []*github.CommitFile
+	sizes := make(map[string]int)
+	for _, entry := range entries {
+		if entry.GetType() != "blob" {
+			continue
+		}
+		sizes[entry.GetPath()] = entry.GetSize()
+		files = append(files, &github.CommitFile{
+			SHA:      entry.SHA,
+			Filename: entry.Path,
+			BlobURL:  github.String(fmt.Sprintf("https://github.com/%s/%s/blob/%s/%s", owner, repo, headSHA, entry.GetPath())),
+		})
+	}
+	c.tree = files
+	c.treeSizes = sizes
+	return files, nil
+}
+
+// walkTree lists the entries of the tree with sha and of the trees beneath it
+// without asking GitHub to recurse, prefixing their paths with dir
+func (c *Context) walkTree(e *github.CheckSuiteEvent, sha string, dir string) ([]github.TreeEntry, error) {
+	tree, _, err := c.Github.Git.GetTree(*c.Ctx, e.Repo.GetOwner().GetLogin(), e.Repo.GetName(), sha, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "Couldn't list files")
+	}
+	if tree.GetTruncated() {
+		return nil, fmt.Errorf("Couldn't list files: %s has too many entries", path.Join(".", dir))
+	}
+
+	var entries []github.TreeEntry
+	for _, entry := range tree.Entries {
+		entry.Path = github.String(path.Join(dir, entry.GetPath()))
+		entries = append(entries, entry)
+		if entry.GetType() != "tree" {
+			continue
+		}
+		subtree, err := c.walkTree(e, entry.GetSHA(), entry.GetPath())
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, subtree...)
+	}
+	return entries, nil
+}
+
+// configErrorAnnotation annotates the config file with an error encountered
+// while loading the files it refers to
+func configErrorAnnotation(e *github.CheckSuiteEvent, title string, err error) *github.CheckRunAnnotation {
+	configBlobHRef := fmt.Sprintf("https://github.com/%s/%s/blob/%s/%s", e.Repo.GetOwner().GetLogin(), e.Repo.GetName(), e.CheckSuite.GetHeadSHA(), configPath)
+	return &github.CheckRunAnnotation{
+		Path:            github.String(configPath),
+		BlobHRef:        &configBlobHRef,
+		StartLine:       github.Int(1),
+		EndLine:         github.Int(1),
+		AnnotationLevel: github.String("failure"),
+		Title:           github.String(title),
+		Message:         github.String(fmt.Sprintf("%+v", err)),
 	}
-	return prFiles, nil
 }
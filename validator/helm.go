@@ -0,0 +1,563 @@
+package validator
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/google/go-github/github"
+	difflib "github.com/pmezard/go-difflib/difflib"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	defaultHelmReleaseName = "release-name"
+	defaultHelmKubeVersion = "1.20.0"
+)
+
+// helmChartFiles are the files of a chart which aren't exposed to its
+// templates through .Files
+var helmChartFiles = map[string]bool{
+	"Chart.yaml":         true,
+	"Chart.lock":         true,
+	"requirements.yaml":  true,
+	"requirements.lock":  true,
+	"values.yaml":        true,
+	"values.schema.json": true,
+}
+
+// helmChart is a Helm chart loaded from a repository. Subcharts aren't
+// rendered.
+type helmChart struct {
+	Path     string
+	Metadata map[string]interface{}
+	Values   map[string]interface{}
+
+	// Templates maps the filenames of the chart's templates to their source
+	Templates map[string]string
+	// Files maps the paths of the chart's other files relative to the chart to
+	// their contents
+	Files map[string][]byte
+	// Subcharts lists the names of the chart's dependencies and of the charts
+	// in its charts directory
+	Subcharts []string
+}
+
+// newHelmChart loads the chart at chartPath from files, which maps filenames
+// to their contents. The contents of subcharts aren't needed.
+func newHelmChart(chartPath string, files map[string][]byte) (*helmChart, error) {
+	chart := &helmChart{
+		Path:      chartPath,
+		Metadata:  make(map[string]interface{}),
+		Values:    make(map[string]interface{}),
+		Templates: make(map[string]string),
+		Files:     make(map[string][]byte),
+	}
+
+	chartYAML, ok := files[path.Join(chartPath, "Chart.yaml")]
+	if !ok {
+		return nil, fmt.Errorf("%s doesn't contain a Chart.yaml", chartPath)
+	}
+	metadata, err := parseValues(chartYAML)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't parse %s/Chart.yaml: %s", chartPath, err)
+	}
+	// Chart.yaml's fields are exposed to templates with capitalized names
+	for key, value := range metadata {
+		if key != "" {
+			chart.Metadata[strings.ToUpper(key[:1])+key[1:]] = value
+		}
+	}
+
+	if valuesYAML, ok := files[path.Join(chartPath, "values.yaml")]; ok {
+		chart.Values, err = parseValues(valuesYAML)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't parse %s/values.yaml: %s", chartPath, err)
+		}
+	}
+
+	subcharts := make(map[string]bool)
+	dependencies, _ := chart.Metadata["Dependencies"].([]interface{})
+	if requirementsYAML, ok := files[path.Join(chartPath, "requirements.yaml")]; ok {
+		if requirements, err := parseValues(requirementsYAML); err == nil {
+			more, _ := requirements["dependencies"].([]interface{})
+			dependencies = append(dependencies, more...)
+		}
+	}
+	for _, dependency := range dependencies {
+		if d, ok := dependency.(map[string]interface{}); ok {
+			if name, ok := d["name"].(string); ok {
+				subcharts[name] = true
+			}
+		}
+	}
+
+	templatesDir := path.Join(chartPath, "templates") + "/"
+	subchartsDir := path.Join(chartPath, "charts") + "/"
+	for filename, contents := range files {
+		switch {
+		case strings.HasPrefix(filename, templatesDir):
+			chart.Templates[filename] = string(contents)
+		case strings.HasPrefix(filename, subchartsDir):
+			name := strings.SplitN(strings.TrimPrefix(filename, subchartsDir), "/", 2)[0]
+			subcharts[strings.TrimSuffix(name, ".tgz")] = true
+		case strings.HasPrefix(filename, chartPath+"/"):
+			name := strings.TrimPrefix(filename, chartPath+"/")
+			if !helmChartFiles[name] {
+				chart.Files[name] = contents
+			}
+		}
+	}
+	for name := range subcharts {
+		chart.Subcharts = append(chart.Subcharts, name)
+	}
+	sort.Strings(chart.Subcharts)
+	return chart, nil
+}
+
+// parseValues parses a YAML values file
+func parseValues(b []byte) (map[string]interface{}, error) {
+	var values interface{}
+	if err := yaml.Unmarshal(b, &values); err != nil {
+		return nil, err
+	}
+	if values == nil {
+		return make(map[string]interface{}), nil
+	}
+	m, ok := convertToStringKeys(values).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a map, got %T", values)
+	}
+	return m, nil
+}
+
+// mergeValues returns a copy of base with the values in overrides merged into
+// it recursively
+func mergeValues(base map[string]interface{}, overrides map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(base))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range overrides {
+		baseMap, baseIsMap := merged[key].(map[string]interface{})
+		overrideMap, overrideIsMap := value.(map[string]interface{})
+		if baseIsMap && overrideIsMap {
+			merged[key] = mergeValues(baseMap, overrideMap)
+		} else {
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+// helmRelease describes the release a chart is rendered for
+type helmRelease struct {
+	Name        string
+	Namespace   string
+	KubeVersion string
+}
+
+// helmAPIVersions are the apiVersions supported by the version of Kubernetes a
+// chart is rendered for
+type helmAPIVersions struct {
+	kubeVersion string
+}
+
+// Has reports apiVersions as available unless they've been removed from the
+// version of Kubernetes the chart is rendered for
+func (a helmAPIVersions) Has(apiVersion string) bool {
+	for _, deprecation := range apiDeprecations {
+		if (deprecation.APIVersion == apiVersion || deprecation.APIVersion+"/"+deprecation.Kind == apiVersion) && deprecation.levelAt(a.kubeVersion) == "failure" {
+			return false
+		}
+	}
+	return true
+}
+
+// Render renders each of the chart's templates with values, returning the
+// output of each template which produced any
+func (chart *helmChart) Render(values map[string]interface{}, release helmRelease) (map[string]string, error) {
+	kubeVersion := release.KubeVersion
+	if kubeVersion == "" || kubeVersion == "master" {
+		kubeVersion = defaultHelmKubeVersion
+	}
+	versionParts := versionParts(kubeVersion)
+	top := map[string]interface{}{
+		"Values": mergeValues(chart.Values, values),
+		"Chart":  chart.Metadata,
+		"Release": map[string]interface{}{
+			"Name":      release.Name,
+			"Namespace": release.Namespace,
+			"Service":   "Helm",
+			"IsInstall": true,
+			"IsUpgrade": false,
+			"Revision":  1,
+		},
+		"Capabilities": map[string]interface{}{
+			"KubeVersion": map[string]interface{}{
+				"Version":    "v" + strings.TrimPrefix(kubeVersion, "v"),
+				"GitVersion": "v" + strings.TrimPrefix(kubeVersion, "v"),
+				"Major":      strconv.Itoa(versionParts[0]),
+				"Minor":      strconv.Itoa(versionParts[1]),
+			},
+			"APIVersions": helmAPIVersions{kubeVersion: kubeVersion},
+		},
+		"Files": helmFiles(chart.Files),
+	}
+
+	t := template.New(chart.Path).Option("missingkey=zero")
+	t.Funcs(helmFuncs(t))
+
+	var names []string
+	for name := range chart.Templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := t.New(name).Parse(chart.Templates[name]); err != nil {
+			return nil, err
+		}
+	}
+
+	rendered := make(map[string]string)
+	for _, name := range names {
+		base := path.Base(name)
+		if strings.HasPrefix(base, "_") || base == "NOTES.txt" {
+			continue
+		}
+		data := make(map[string]interface{}, len(top)+1)
+		for key, value := range top {
+			data[key] = value
+		}
+		data["Template"] = map[string]interface{}{
+			"Name":     name,
+			"BasePath": path.Join(chart.Path, "templates"),
+		}
+
+		var buffer bytes.Buffer
+		if err := t.ExecuteTemplate(&buffer, name, data); err != nil {
+			return nil, err
+		}
+		output := withoutMissingValues(buffer.String())
+		if strings.TrimSpace(output) == "" {
+			continue
+		}
+		rendered[name] = output
+	}
+	return rendered, nil
+}
+
+// renderedSource describes how a Candidate's bytes were rendered from its file
+type renderedSource struct {
+	// Description is appended to the titles of the Candidate's annotations
+	Description string
+	// lines maps each line of the rendered output to a line of the file it
+	// was rendered from
+	lines []int
+}
+
+// mapAnnotations points annotations at the lines of the file the output was
+// rendered from
+func (r *renderedSource) mapAnnotations(annotations Annotations) {
+	if r == nil {
+		return
+	}
+	for _, annotation := range annotations {
+		startLine := r.sourceLine(annotation.GetStartLine())
+		endLine := r.sourceLine(annotation.GetEndLine())
+		if endLine < startLine {
+			endLine = startLine
+		}
+		annotation.StartLine = github.Int(startLine)
+		annotation.EndLine = github.Int(endLine)
+		annotation.Title = github.String(fmt.Sprintf("%s (%s)", annotation.GetTitle(), r.Description))
+	}
+}
+
+func (r *renderedSource) sourceLine(line int) int {
+	if line < 1 || len(r.lines) == 0 {
+		return 1
+	}
+	if line > len(r.lines) {
+		return r.lines[len(r.lines)-1]
+	}
+	return r.lines[line-1]
+}
+
+// mapRenderedLines matches each line of output to the line of source it was
+// most likely rendered from. Lines which only differ by the values substituted
+// into them are matched when they're surrounded by identical lines, or when
+// they start with the same key.
+func mapRenderedLines(source string, output string) []int {
+	sourceLines := strings.Split(strings.TrimSuffix(source, "\n"), "\n")
+	outputLines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+	lines := make([]int, len(outputLines))
+
+	matcher := difflib.NewMatcher(sourceLines, outputLines)
+	sourceLine, outputLine := 0, 0
+	for _, block := range matcher.GetMatchingBlocks() {
+		sourceGap := block.A - sourceLine
+		outputGap := block.B - outputLine
+		for i := 0; i < outputGap; i++ {
+			keyIndex := indexOfKey(sourceLines[sourceLine:block.A], mappingKeyOf(outputLines[outputLine+i]))
+			switch {
+			case sourceGap == outputGap:
+				lines[outputLine+i] = sourceLine + i + 1
+			case keyIndex >= 0:
+				lines[outputLine+i] = sourceLine + keyIndex + 1
+			case sourceGap > 0:
+				lines[outputLine+i] = sourceLine + 1
+			default:
+				lines[outputLine+i] = sourceLine
+			}
+		}
+		for i := 0; i < block.Size; i++ {
+			lines[block.B+i] = block.A + i + 1
+		}
+		sourceLine = block.A + block.Size
+		outputLine = block.B + block.Size
+	}
+	for i := range lines {
+		if lines[i] < 1 {
+			lines[i] = 1
+		}
+	}
+	return lines
+}
+
+// mappingKeyOf returns the indented key of a line like "  name: value", or an
+// empty string if the line doesn't start with a literal key
+func mappingKeyOf(line string) string {
+	i := strings.Index(line, ":")
+	if i < 0 || strings.Contains(line[:i], "{{") || strings.TrimSpace(line[:i]) == "" {
+		return ""
+	}
+	return line[:i]
+}
+
+// indexOfKey returns the index of the first of lines starting with key
+func indexOfKey(lines []string, key string) int {
+	if key == "" {
+		return -1
+	}
+	for i, line := range lines {
+		if mappingKeyOf(line) == key {
+			return i
+		}
+	}
+	return -1
+}
+
+var templateErrorRe = regexp.MustCompile(`template: ([^:]+):(\d+)`)
+
+// unsupportedTemplateErrorRe matches errors rendering charts which use
+// functions or fields of Helm's built-in objects that aren't supported
+var unsupportedTemplateErrorRe = regexp.MustCompile(`function "[^"]+" not defined|can't evaluate field \w+ in type validator\.helm|<\.Files\.\w+>: \w+ is not a method`)
+
+// renderHelmCharts renders the configured charts which have changed, or which
+// validate every file, with each of their values files, returning a Candidate
+// for the output of each template
+func (c *Context) renderHelmCharts(e *github.CheckSuiteEvent, config *KubeValidatorConfig, changedFiles []*github.CommitFile) (Candidates, Annotations) {
+	var candidates Candidates
+	var annotations Annotations
+	if config.Spec == nil {
+		return candidates, annotations
+	}
+
+	changed := changedFileSet(changedFiles)
+	for _, manifest := range config.Spec.Manifests {
+		helm := manifest.Helm
+		if helm == nil || !(helm.changed(changedFiles) || config.validatesAll(manifest, changed)) {
+			continue
+		}
+		chartDir := path.Clean(helm.Chart)
+
+		tree, err := c.treeFileList(e)
+		if err != nil {
+			annotations = append(annotations, configErrorAnnotation(e, fmt.Sprintf("Error loading %s", helm.Chart), err))
+			continue
+		}
+		blobURLs := make(map[string]*string)
+		treeFiles := make(map[string]*github.CommitFile)
+		files := make(map[string][]byte)
+		var chartFiles []*github.CommitFile
+		for _, file := range tree {
+			blobURLs[file.GetFilename()] = file.BlobURL
+			treeFiles[file.GetFilename()] = file
+			if !strings.HasPrefix(file.GetFilename(), chartDir+"/") {
+				continue
+			}
+			// Subcharts aren't rendered, so their contents aren't needed
+			if strings.HasPrefix(file.GetFilename(), path.Join(chartDir, "charts")+"/") {
+				files[file.GetFilename()] = nil
+				continue
+			}
+			chartFiles = append(chartFiles, file)
+		}
+		contents, errs := c.loadFiles(e, chartFiles)
+		var loadErr error
+		for i, file := range chartFiles {
+			if errs[i] != nil {
+				loadErr = errs[i]
+				break
+			}
+			files[file.GetFilename()] = *contents[i]
+		}
+		if loadErr != nil {
+			annotations = append(annotations, configErrorAnnotation(e, fmt.Sprintf("Error loading %s", helm.Chart), loadErr))
+			continue
+		}
+
+		chart, err := newHelmChart(chartDir, files)
+		if err != nil {
+			annotations = append(annotations, configErrorAnnotation(e, fmt.Sprintf("Error loading %s", helm.Chart), err))
+			continue
+		}
+		if len(chart.Subcharts) > 0 {
+			chartYAML := path.Join(chartDir, "Chart.yaml")
+			annotations = append(annotations, &github.CheckRunAnnotation{
+				Path:            github.String(chartYAML),
+				BlobHRef:        blobURLs[chartYAML],
+				StartLine:       github.Int(1),
+				EndLine:         github.Int(1),
+				AnnotationLevel: github.String("notice"),
+				Title:           github.String(fmt.Sprintf("Subcharts of %s weren't rendered", helm.Chart)),
+				Message:         github.String(fmt.Sprintf("kubevalidator doesn't render subcharts, so only the templates of %s were validated. Its subcharts are %s.", helm.Chart, strings.Join(chart.Subcharts, ", "))),
+			})
+		}
+
+		valuesFiles := helm.Values
+		if len(valuesFiles) == 0 {
+			valuesFiles = []string{""}
+		}
+		for _, valuesFile := range valuesFiles {
+			values := make(map[string]interface{})
+			description := fmt.Sprintf("rendered with %s/values.yaml", chartDir)
+			if valuesFile != "" {
+				description = fmt.Sprintf("rendered with %s", valuesFile)
+				file, ok := treeFiles[valuesFile]
+				if !ok {
+					file = &github.CommitFile{Filename: github.String(valuesFile)}
+				}
+				b, err := c.bytesForFile(e, file)
+				if err == nil {
+					values, err = parseValues(*b)
+				}
+				if err != nil {
+					annotations = append(annotations, &github.CheckRunAnnotation{
+						Path:            github.String(valuesFile),
+						BlobHRef:        blobURLs[valuesFile],
+						StartLine:       github.Int(1),
+						EndLine:         github.Int(1),
+						AnnotationLevel: github.String("failure"),
+						Title:           github.String(fmt.Sprintf("Error loading %s", valuesFile)),
+						Message:         github.String(fmt.Sprintf("%+v", err)),
+					})
+					continue
+				}
+			}
+
+			rendered, err := chart.Render(values, helm.release(manifest.Schemas))
+			if err != nil {
+				annotations = append(annotations, renderErrorAnnotation(helm, blobURLs, description, err))
+				continue
+			}
+
+			var names []string
+			for name := range rendered {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				output := []byte(rendered[name])
+				candidate := NewCandidate(c, &github.CommitFile{
+					Filename: github.String(name),
+					BlobURL:  blobURLs[name],
+				}, manifest.Schemas)
+				candidate.setBytes(&output)
+				candidate.rendered = &renderedSource{
+					Description: description,
+					lines:       mapRenderedLines(chart.Templates[name], rendered[name]),
+				}
+				candidates = append(candidates, candidate)
+			}
+		}
+	}
+	return candidates, annotations
+}
+
+// renderErrorAnnotation annotates the template which failed to render, or
+// the chart if the template can't be determined. Charts which use features
+// of Helm that aren't supported are noted rather than failed.
+func renderErrorAnnotation(helm *KubeValidatorConfigHelm, blobURLs map[string]*string, description string, err error) *github.CheckRunAnnotation {
+	filename := path.Join(path.Clean(helm.Chart), "Chart.yaml")
+	line := 1
+	if match := templateErrorRe.FindStringSubmatch(err.Error()); match != nil {
+		if _, ok := blobURLs[match[1]]; ok {
+			filename = match[1]
+			line, _ = strconv.Atoi(match[2])
+		}
+	}
+	level := "failure"
+	title := fmt.Sprintf("Error rendering %s (%s)", helm.Chart, description)
+	message := err.Error()
+	if unsupportedTemplateErrorRe.MatchString(message) {
+		level = "notice"
+		title = fmt.Sprintf("Couldn't render %s (%s)", helm.Chart, description)
+		message = fmt.Sprintf("The chart uses a feature of Helm which kubevalidator doesn't support, so it wasn't validated: %s", message)
+	}
+	return &github.CheckRunAnnotation{
+		Path:            github.String(filename),
+		BlobHRef:        blobURLs[filename],
+		StartLine:       github.Int(line),
+		EndLine:         github.Int(line),
+		AnnotationLevel: github.String(level),
+		Title:           github.String(title),
+		Message:         github.String(message),
+	}
+}
+
+// changed determines whether or not any of the chart's files or values files
+// are among files
+func (helm *KubeValidatorConfigHelm) changed(files []*github.CommitFile) bool {
+	for _, file := range files {
+		if strings.HasPrefix(file.GetFilename(), path.Clean(helm.Chart)+"/") {
+			return true
+		}
+		for _, values := range helm.Values {
+			if file.GetFilename() == values {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// release describes the release the chart is rendered for
+func (helm *KubeValidatorConfigHelm) release(schemas []*KubeValidatorConfigSchema) helmRelease {
+	release := helmRelease{
+		Name:        helm.ReleaseName,
+		Namespace:   helm.Namespace,
+		KubeVersion: helm.KubeVersion,
+	}
+	if release.Name == "" {
+		release.Name = defaultHelmReleaseName
+	}
+	if release.Namespace == "" {
+		release.Namespace = "default"
+	}
+	if release.KubeVersion == "" {
+		for _, schema := range schemas {
+			if schema.Version != "" && schema.Version != "master" {
+				release.KubeVersion = schema.Version
+				break
+			}
+		}
+	}
+	return release
+}
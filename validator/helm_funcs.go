@@ -0,0 +1,222 @@
+package validator
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig/v3"
+	"github.com/bmatcuk/doublestar"
+	yaml "gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+const (
+	// maxIncludeDepth is how many times a template may be included within
+	// itself, as in Helm. Each include executes the template anew, so
+	// text/template's own limit on recursion doesn't apply.
+	maxIncludeDepth = 1000
+	// maxGeneratedLength bounds the strings and lists templates may generate
+	// from a count, as charts come from the repositories being validated
+	maxGeneratedLength = 1 << 20
+)
+
+// helmFuncs returns the functions available to chart templates: Sprig's, and
+// those Helm adds to them. toToml and fromToml aren't supported.
+func helmFuncs(t *template.Template) template.FuncMap {
+	funcs := sprig.TxtFuncMap()
+	// Helm removes these as they'd leak the environment into charts
+	delete(funcs, "env")
+	delete(funcs, "expandenv")
+	// Validation shouldn't depend on the network
+	funcs["getHostByName"] = func(name string) string { return "" }
+
+	untilStep := funcs["untilStep"].(func(int, int, int) []int)
+	limitedUntilStep := func(start int, stop int, step int) ([]int, error) {
+		if step != 0 && (float64(stop)-float64(start))/float64(step) > maxGeneratedLength {
+			return nil, fmt.Errorf("untilStep would generate more than %d numbers", maxGeneratedLength)
+		}
+		return untilStep(start, stop, step), nil
+	}
+	funcs["untilStep"] = limitedUntilStep
+	funcs["until"] = func(count int) ([]int, error) {
+		step := 1
+		if count < 0 {
+			step = -1
+		}
+		return limitedUntilStep(0, count, step)
+	}
+	funcs["repeat"] = func(count int, s string) (string, error) {
+		if count > 0 && len(s) > 0 && count > maxGeneratedLength/len(s) {
+			return "", fmt.Errorf("repeat would generate more than %d bytes", maxGeneratedLength)
+		}
+		return strings.Repeat(s, count), nil
+	}
+
+	funcs["toYaml"] = toYAML
+	funcs["toYamlPretty"] = func(value interface{}) string {
+		var buffer bytes.Buffer
+		encoder := yamlv3.NewEncoder(&buffer)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(value); err != nil {
+			return ""
+		}
+		return strings.TrimSuffix(buffer.String(), "\n")
+	}
+	funcs["fromYaml"] = func(s string) map[string]interface{} {
+		values, err := parseValues([]byte(s))
+		if err != nil {
+			return map[string]interface{}{"Error": err.Error()}
+		}
+		return values
+	}
+	funcs["fromYamlArray"] = func(s string) []interface{} {
+		var values []interface{}
+		if err := yaml.Unmarshal([]byte(s), &values); err != nil {
+			return []interface{}{err.Error()}
+		}
+		for i, value := range values {
+			values[i] = convertToStringKeys(value)
+		}
+		return values
+	}
+	funcs["toJson"] = func(value interface{}) string {
+		b, err := json.Marshal(convertToStringKeys(value))
+		if err != nil {
+			return ""
+		}
+		return string(b)
+	}
+	funcs["fromJson"] = func(s string) map[string]interface{} {
+		values := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(s), &values); err != nil {
+			values["Error"] = err.Error()
+		}
+		return values
+	}
+	funcs["fromJsonArray"] = func(s string) []interface{} {
+		var values []interface{}
+		if err := json.Unmarshal([]byte(s), &values); err != nil {
+			return []interface{}{err.Error()}
+		}
+		return values
+	}
+
+	included := make(map[string]int)
+	funcs["include"] = func(name string, data interface{}) (string, error) {
+		if included[name] >= maxIncludeDepth {
+			return "", fmt.Errorf("%s is included within itself more than %d times", name, maxIncludeDepth)
+		}
+		included[name]++
+		defer func() { included[name]-- }()
+		var buffer bytes.Buffer
+		err := t.ExecuteTemplate(&buffer, name, data)
+		return buffer.String(), err
+	}
+	funcs["tpl"] = func(text string, data interface{}) (string, error) {
+		tpl, err := t.Clone()
+		if err != nil {
+			return "", err
+		}
+		if _, err := tpl.New("tpl").Parse(text); err != nil {
+			return "", err
+		}
+		var buffer bytes.Buffer
+		if err := tpl.ExecuteTemplate(&buffer, "tpl", data); err != nil {
+			return "", err
+		}
+		return withoutMissingValues(buffer.String()), nil
+	}
+	funcs["required"] = func(message string, value interface{}) (interface{}, error) {
+		if s, ok := value.(string); value == nil || (ok && s == "") {
+			return value, errors.New(message)
+		}
+		return value, nil
+	}
+	// Validation doesn't have access to a cluster, so lookups find nothing as
+	// they do when Helm renders templates without one
+	funcs["lookup"] = func(apiVersion string, kind string, namespace string, name string) (map[string]interface{}, error) {
+		return map[string]interface{}{}, nil
+	}
+	return funcs
+}
+
+// toYAML marshals value as a YAML document without a trailing newline
+func toYAML(value interface{}) string {
+	b, err := yaml.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(string(b), "\n")
+}
+
+// withoutMissingValues removes the "<no value>" text/template prints for
+// missing values, even with missingkey=zero, as Helm does
+func withoutMissingValues(output string) string {
+	return strings.Replace(output, "<no value>", "", -1)
+}
+
+// helmFiles gives templates access to the chart's other files, mirroring
+// Helm's .Files
+type helmFiles map[string][]byte
+
+// Get returns the contents of a file in the chart
+func (f helmFiles) Get(name string) string {
+	return string(f[name])
+}
+
+// GetBytes returns the contents of a file in the chart as bytes
+func (f helmFiles) GetBytes(name string) []byte {
+	return f[name]
+}
+
+// Glob returns the files in the chart whose paths match pattern
+func (f helmFiles) Glob(pattern string) helmFiles {
+	matches := make(helmFiles)
+	for name, contents := range f {
+		if matched, _ := doublestar.Match(pattern, name); matched {
+			matches[name] = contents
+		}
+	}
+	return matches
+}
+
+// Lines returns the lines of a file in the chart
+func (f helmFiles) Lines(name string) []string {
+	contents, ok := f[name]
+	if !ok || len(contents) == 0 {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSuffix(string(contents), "\n"), "\n")
+}
+
+// AsConfig returns the files as the data of a ConfigMap, keyed by their base
+// names
+func (f helmFiles) AsConfig() string {
+	if len(f) == 0 {
+		return ""
+	}
+	data := make(map[string]string)
+	for name, contents := range f {
+		data[path.Base(name)] = string(contents)
+	}
+	return toYAML(data)
+}
+
+// AsSecrets returns the files as the base64 encoded data of a Secret, keyed
+// by their base names
+func (f helmFiles) AsSecrets() string {
+	if len(f) == 0 {
+		return ""
+	}
+	data := make(map[string]string)
+	for name, contents := range f {
+		data[path.Base(name)] = base64.StdEncoding.EncodeToString(contents)
+	}
+	return toYAML(data)
+}
@@ -0,0 +1,367 @@
+package validator
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/go-test/deep"
+	"github.com/google/go-github/github"
+)
+
+// readFixtureFiles reads every file under dir, keyed by its path relative to
+// the root of the repository
+func readFixtureFiles(t *testing.T, dir string) map[string][]byte {
+	files := make(map[string][]byte)
+	err := filepath.Walk(filepath.Join("..", dir), func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(strings.TrimPrefix(path, ".."+string(filepath.Separator)))] = b
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// serveFixtureFiles serves the tree and contents of the files under dir at
+// the head of a check suite
+func serveFixtureFiles(t *testing.T, mux *http.ServeMux, dir string) {
+	files := readFixtureFiles(t, dir)
+	var entries []map[string]string
+	for filename := range files {
+		entries = append(entries, map[string]string{"path": filename, "type": "blob"})
+	}
+	mux.HandleFunc("/repos/o/r/git/trees/abc", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		json.NewEncoder(w).Encode(map[string]interface{}{"sha": "abc", "tree": entries})
+	})
+	mux.HandleFunc("/repos/o/r/contents/", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		b, ok := files[strings.TrimPrefix(r.URL.Path, "/repos/o/r/contents/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{
+			"type": "file",
+			"encoding": "base64",
+			"content": "%s"
+		}`, base64.StdEncoding.EncodeToString(b))
+	})
+}
+
+func TestRenderHelmChart(t *testing.T) {
+	chart, err := newHelmChart("fixtures/charts/web", readFixtureFiles(t, "fixtures/charts/web"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rendered, err := chart.Render(nil, helmRelease{Name: "release-name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rendered) != 2 {
+		t.Errorf("expected the deployment and service to be rendered, got %v", rendered)
+	}
+
+	want := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: release-name-web
+  labels:
+    app: release-name-web
+    chart: web-0.1.0
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: release-name-web
+  template:
+    metadata:
+      labels:
+        app: release-name-web
+    spec:
+      containers:
+      - name: web
+        image: "nginx:1.15"
+`
+	if diff := deep.Equal(rendered["fixtures/charts/web/templates/deployment.yaml"], want); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestAnnotationsForRenderedHelmChart(t *testing.T) {
+	client, mux, _, teardown := setup()
+	defer teardown()
+	serveFixtureFiles(t, mux, "fixtures/charts")
+
+	schemaDir, _ := filepath.Abs("../fixtures/schemas")
+	ctx := context.Background()
+	c := &Context{
+		Ctx:       &ctx,
+		Github:    client,
+		Event:     &github.CheckSuiteEvent{},
+		SchemaDir: schemaDir,
+	}
+	e := &github.CheckSuiteEvent{
+		CheckSuite: &github.CheckSuite{
+			HeadSHA: github.String("abc"),
+		},
+		Repo: &github.Repository{
+			Name: github.String("r"),
+			Owner: &github.User{
+				Login: github.String("o"),
+			},
+		},
+	}
+	config := &KubeValidatorConfig{
+		Spec: &KubeValidatorConfigSpec{
+			Manifests: []*KubeValidatorConfigManifest{
+				{
+					Helm: &KubeValidatorConfigHelm{
+						Chart:  "fixtures/charts/web",
+						Values: []string{"fixtures/charts/web-production.yaml", "fixtures/charts/web-broken.yaml"},
+					},
+					Schemas: []*KubeValidatorConfigSchema{{OnlyKinds: []string{"Deployment"}}},
+				},
+			},
+		},
+	}
+	if !config.Valid() {
+		t.Fatalf("Config expected to be valid: %+v", config)
+	}
+
+	changed := []*github.CommitFile{{Filename: github.String("fixtures/charts/web-production.yaml")}}
+	candidates, annotations := c.renderHelmCharts(e, config, changed)
+
+	if len(annotations) != 1 {
+		t.Fatalf("expected a single annotation, got %s", github.Stringify(annotations))
+	}
+	renderError := annotations[0]
+	if renderError.GetPath() != "fixtures/charts/web/templates/deployment.yaml" || renderError.GetStartLine() != 19 {
+		t.Errorf("expected the render error to point at line 19 of the deployment template, got %s", github.Stringify(renderError))
+	}
+	if renderError.GetTitle() != "Error rendering fixtures/charts/web (rendered with fixtures/charts/web-broken.yaml)" {
+		t.Errorf("unexpected title %q", renderError.GetTitle())
+	}
+
+	if len(candidates) != 1 {
+		t.Fatalf("expected 1 candidate, got %d", len(candidates))
+	}
+	annotations = candidates.Validate()
+	want := []struct {
+		line    int
+		message string
+	}{
+		{25, "extra: Additional property extra is not allowed; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.32/#container-v1-core for more details"},
+		{8, "spec.replicas: Invalid type. Expected: integer, given: string; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.32/#deploymentspec-v1-apps for more details"},
+	}
+	if len(annotations) != len(want) {
+		t.Fatalf("a total of %d annotations were returned, wanted %d: %s", len(annotations), len(want), github.Stringify(annotations))
+	}
+	for i, annotation := range annotations {
+		if annotation.GetPath() != "fixtures/charts/web/templates/deployment.yaml" {
+			t.Errorf("unexpected path %s", annotation.GetPath())
+		}
+		if annotation.GetStartLine() != want[i].line || annotation.GetMessage() != want[i].message {
+			t.Errorf("expected %q on line %d, got %s", want[i].message, want[i].line, github.Stringify(annotation))
+		}
+		if annotation.GetTitle() != "Error validating Deployment against master schema (rendered with fixtures/charts/web-production.yaml)" {
+			t.Errorf("unexpected title %q", annotation.GetTitle())
+		}
+	}
+}
+
+func TestHelmChartsOnlyRenderWhenChanged(t *testing.T) {
+	helm := &KubeValidatorConfigHelm{
+		Chart:  "charts/web/",
+		Values: []string{"environments/production.yaml"},
+	}
+	tests := []struct {
+		filename string
+		want     bool
+	}{
+		{"charts/web/templates/deployment.yaml", true},
+		{"charts/web/values.yaml", true},
+		{"environments/production.yaml", true},
+		{"environments/staging.yaml", false},
+		{"charts/website/values.yaml", false},
+	}
+	for _, test := range tests {
+		if got := helm.changed([]*github.CommitFile{{Filename: github.String(test.filename)}}); got != test.want {
+			t.Errorf("%s: expected %v, got %v", test.filename, test.want, got)
+		}
+	}
+}
+
+func TestMapRenderedLines(t *testing.T) {
+	source := "a: 1\nb: {{ .Values.b }}\n{{- if .Values.c }}\nc: true\n{{- end }}\nd: 4\n"
+	output := "a: 1\nb: 2\nc: true\nd: 4\n"
+	if diff := deep.Equal(mapRenderedLines(source, output), []int{1, 2, 4, 6}); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestSemverCompare(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		want       bool
+	}{
+		{">=1.14-0", "v1.13.0", false},
+		{">=1.14-0", "v1.14.3", true},
+		{">= 1.9, < 1.16", "1.15.0", true},
+		{"<1.9 || >=1.16", "1.15.0", false},
+		{"~1.13.0", "1.13.4", true},
+		{"^1.13.0", "2.0.0", false},
+	}
+	semverCompare := helmFuncs(template.New(""))["semverCompare"].(func(string, string) (bool, error))
+	for _, test := range tests {
+		got, err := semverCompare(test.constraint, test.version)
+		if err != nil {
+			t.Error(err)
+		}
+		if got != test.want {
+			t.Errorf("%s against %s: expected %v, got %v", test.constraint, test.version, test.want, got)
+		}
+	}
+}
+
+func TestRenderHelmChartWithHelmFunctions(t *testing.T) {
+	files := map[string][]byte{
+		"chart/Chart.yaml":      []byte("name: chart\nversion: 0.1.0\ndependencies:\n- name: redis\n"),
+		"chart/values.yaml":     []byte("names: [b, a, b]\nmissing: {}\n"),
+		"chart/config/a.conf":   []byte("a=1\n"),
+		"chart/config/b.conf":   []byte("b=2\n"),
+		"chart/charts/postgres": nil,
+		"chart/templates/configmap.yaml": []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ "ReleaseName" | snakecase }}
+  labels:
+    first: {{ first (.Values.names | uniq | sortAlpha) }}
+    missing: "{{ .Values.missing.value }}"
+    template: {{ tpl "{{ .Chart.Name }}" . }}
+data:
+{{ (.Files.Glob "config/*").AsConfig | indent 2 }}
+`),
+	}
+	chart, err := newHelmChart("chart", files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(chart.Subcharts, []string{"postgres", "redis"}); diff != nil {
+		t.Error(diff)
+	}
+	if _, ok := chart.Files["Chart.yaml"]; ok {
+		t.Error("expected Chart.yaml not to be available to templates")
+	}
+
+	rendered, err := chart.Render(nil, helmRelease{Name: "release-name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: release_name
+  labels:
+    first: a
+    missing: ""
+    template: chart
+data:
+  a.conf: |
+    a=1
+  b.conf: |
+    b=2
+`
+	if diff := deep.Equal(rendered["chart/templates/configmap.yaml"], want); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestRecursiveHelmIncludesAreErrors(t *testing.T) {
+	chart, err := newHelmChart("chart", map[string][]byte{
+		"chart/Chart.yaml":          []byte("name: chart\nversion: 0.1.0\n"),
+		"chart/templates/loop.yaml": []byte(`{{ define "a" }}{{ include "a" . }}{{ end }}{{ include "a" . }}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = chart.Render(nil, helmRelease{Name: "release-name"})
+	if err == nil || !strings.Contains(err.Error(), "a is included within itself more than 1000 times") {
+		t.Errorf("expected the recursion to be an error, got %v", err)
+	}
+}
+
+func TestHelmFunctionsGeneratingLargeValuesAreErrors(t *testing.T) {
+	for _, text := range []string{
+		`{{ repeat 1000000000 "abc" }}`,
+		`{{ until 1000000000 }}`,
+		`{{ untilStep 0 -1000000000 -1 }}`,
+		`{{ untilStep -9223372036854775807 9223372036854775807 1 }}`,
+	} {
+		chart, err := newHelmChart("chart", map[string][]byte{
+			"chart/Chart.yaml":         []byte("name: chart\nversion: 0.1.0\n"),
+			"chart/templates/big.yaml": []byte(text),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := chart.Render(nil, helmRelease{Name: "release-name"}); err == nil || !strings.Contains(err.Error(), "would generate more than") {
+			t.Errorf("%s: expected an error, got %v", text, err)
+		}
+	}
+
+	chart, err := newHelmChart("chart", map[string][]byte{
+		"chart/Chart.yaml":           []byte("name: chart\nversion: 0.1.0\n"),
+		"chart/templates/small.yaml": []byte(`{{ repeat 2 "ab" }} {{ until 3 }} {{ untilStep 5 0 -2 }}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rendered, err := chart.Render(nil, helmRelease{Name: "release-name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rendered["chart/templates/small.yaml"]; got != "abab [0 1 2] [5 3 1]" {
+		t.Errorf("unexpected output %q", got)
+	}
+}
+
+func TestUnsupportedHelmFeaturesAreNoted(t *testing.T) {
+	helm := &KubeValidatorConfigHelm{Chart: "chart"}
+	blobURLs := map[string]*string{"chart/templates/configmap.yaml": github.String("https://github.com/o/r/blob/abc/chart/templates/configmap.yaml")}
+	for _, template := range []string{"data: {{ toToml .Values }}", "data: {{ .Files.Open \"a\" }}"} {
+		chart, err := newHelmChart("chart", map[string][]byte{
+			"chart/Chart.yaml":               []byte("name: chart\n"),
+			"chart/templates/configmap.yaml": []byte("kind: ConfigMap\n" + template + "\n"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = chart.Render(nil, helmRelease{Name: "release-name"})
+		if err == nil {
+			t.Fatalf("%s: expected an error", template)
+		}
+		annotation := renderErrorAnnotation(helm, blobURLs, "rendered with chart/values.yaml", err)
+		if annotation.GetAnnotationLevel() != "notice" || annotation.GetStartLine() != 2 || annotation.GetPath() != "chart/templates/configmap.yaml" {
+			t.Errorf("%s: expected a notice on line 2 of the template, got %s", template, github.Stringify(annotation))
+		}
+	}
+}
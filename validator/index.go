@@ -0,0 +1,171 @@
+package validator
+
+import (
+	"fmt"
+
+	"github.com/google/go-github/github"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// indexedResource is a single resource found in the repository
+type indexedResource struct {
+	APIVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+
+	body     map[string]interface{}
+	document []byte
+	// documentStartLine is the line of the file on which document starts
+	documentStartLine int
+	// pointer is the JSON pointer of the resource within document, which is
+	// set for the items of a List
+	pointer string
+	// startLine is the line of the file on which the resource starts
+	startLine int
+	file      *github.CommitFile
+
+	// candidate is set when the resource is in a file being validated
+	candidate *Candidate
+}
+
+// resourceIndex holds the resources defined in the files being validated and
+// in the other files matching the configured manifest globs
+type resourceIndex struct {
+	resources []*indexedResource
+}
+
+func newResourceIndex() *resourceIndex {
+	return &resourceIndex{}
+}
+
+// Add indexes the named resources in b. Documents that can't be parsed are
+// ignored as validation will report them.
+func (i *resourceIndex) Add(file *github.CommitFile, b []byte, candidate *Candidate) {
+	startLines := documentStartLines(b)
+	for n, document := range splitDocuments(b) {
+		var spec interface{}
+		if err := yaml.Unmarshal(document, &spec); err != nil {
+			continue
+		}
+		body, ok := convertToStringKeys(spec).(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, item := range expandList(body) {
+			resource := &indexedResource{
+				body:              item.body,
+				document:          document,
+				documentStartLine: startLines[n],
+				pointer:           item.pointer,
+				startLine:         startLines[n],
+				file:              file,
+				candidate:         candidate,
+			}
+			resource.APIVersion, _ = item.body["apiVersion"].(string)
+			resource.Kind, _ = item.body["kind"].(string)
+			if metadata, ok := item.body["metadata"].(map[string]interface{}); ok {
+				resource.Name, _ = metadata["name"].(string)
+				resource.Namespace, _ = metadata["namespace"].(string)
+			}
+			if resource.Kind == "" || resource.Name == "" {
+				continue
+			}
+			if item.pointer != "" {
+				resource.startLine, _ = resource.lineNumbers(nil)
+			}
+			i.resources = append(i.resources, resource)
+		}
+	}
+}
+
+// find returns the resources of kind named name in namespace. Resources
+// without a namespace are assumed to be in the default namespace, as they are
+// when looking for duplicates.
+func (i *resourceIndex) find(kind string, namespace string, name string) []*indexedResource {
+	var found []*indexedResource
+	for _, resource := range i.resources {
+		if resource.Kind == kind && resource.Name == name && resource.namespace() == namespace {
+			found = append(found, resource)
+		}
+	}
+	return found
+}
+
+// namespace returns the namespace of the resource, defaulting to default
+func (r *indexedResource) namespace() string {
+	if r.Namespace == "" {
+		return "default"
+	}
+	return r.Namespace
+}
+
+// String returns the kind and name of the resource
+func (r *indexedResource) String() string {
+	return fmt.Sprintf("%s %s", r.Kind, r.Name)
+}
+
+// lineNumbers returns the lines of the file containing the value found at
+// segments in the resource
+func (r *indexedResource) lineNumbers(segments []string) (int, int) {
+	pointer := r.pointer + pathMatch{segments: segments}.pointer()
+	if pointer == "" {
+		return r.documentStartLine, r.documentStartLine
+	}
+	startLine, endLine := detectLineNumbersForPath(&r.document, pointer)
+	return startLine + r.documentStartLine - 1, endLine + r.documentStartLine - 1
+}
+
+// indexResources indexes the resources in candidates and in the unchanged
+// files matching the configured manifest globs at the head of the check
+// suite. Unchanged files are loaded concurrently through the blob cache.
+func (c *Context) indexResources(e *github.CheckSuiteEvent, config *KubeValidatorConfig, candidates Candidates) (*resourceIndex, Annotations) {
+	var annotations Annotations
+	index := newResourceIndex()
+
+	candidateFiles := make(map[string]bool)
+	for _, candidate := range candidates {
+		// Charts rendered with several values files would define the same
+		// resources more than once
+		if candidate.rendered != nil {
+			continue
+		}
+		if candidate.bytes != nil && !candidateFiles[candidate.file.GetFilename()] {
+			index.Add(candidate.file, *candidate.bytes, candidate)
+		}
+		candidateFiles[candidate.file.GetFilename()] = true
+	}
+
+	if config.Spec == nil || len(config.Spec.Manifests) == 0 {
+		return index, annotations
+	}
+
+	files, err := c.treeFileList(e)
+	if err != nil {
+		return index, append(annotations, configErrorAnnotation(e, "Error loading unchanged manifests", err))
+	}
+
+	var unchangedFiles []*github.CommitFile
+	for _, file := range config.manifestFiles(files) {
+		if !candidateFiles[file.GetFilename()] {
+			unchangedFiles = append(unchangedFiles, file)
+		}
+	}
+	contents, errs := c.loadFiles(e, unchangedFiles)
+	for i, file := range unchangedFiles {
+		if err := errs[i]; err != nil {
+			annotations = append(annotations, &github.CheckRunAnnotation{
+				Path:            file.Filename,
+				BlobHRef:        file.BlobURL,
+				StartLine:       github.Int(1),
+				EndLine:         github.Int(1),
+				AnnotationLevel: github.String("failure"),
+				Title:           github.String(fmt.Sprintf("Error loading %s", file.GetFilename())),
+				Message:         github.String(fmt.Sprintf("%+v", err)),
+			})
+			continue
+		}
+		index.Add(file, *contents[i], nil)
+	}
+	return index, annotations
+}
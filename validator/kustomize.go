@@ -0,0 +1,360 @@
+package validator
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/google/go-github/github"
+	yaml "gopkg.in/yaml.v2"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+// maxKustomizationBytes bounds the size of the files a kustomization is built
+// from, as every file beneath the directories it refers to is loaded
+const maxKustomizationBytes = 16 << 20
+
+// kustomizationFilenames are the names kustomize looks for in a directory
+var kustomizationFilenames = []string{"kustomization.yaml", "kustomization.yml", "Kustomization"}
+
+// kustomizationReferences holds the fields of kustomization.yaml which may
+// refer to other kustomizations
+type kustomizationReferences struct {
+	Resources    []string `yaml:"resources,omitempty"`
+	Bases        []string `yaml:"bases,omitempty"`
+	Components   []string `yaml:"components,omitempty"`
+	Generators   []string `yaml:"generators,omitempty"`
+	Transformers []string `yaml:"transformers,omitempty"`
+	Validators   []string `yaml:"validators,omitempty"`
+}
+
+// kustomizeTree holds the files in a repository that kustomizations are built
+// from
+type kustomizeTree struct {
+	files map[string]*github.CommitFile
+	dirs  map[string]bool
+}
+
+// kustomizeResource is a resource produced by a kustomize build
+type kustomizeResource struct {
+	// origin is the file the resource was defined in, or the kustomization
+	// which generated it
+	origin string
+	body   string
+}
+
+func newKustomizeTree(files []*github.CommitFile) *kustomizeTree {
+	t := &kustomizeTree{
+		files: make(map[string]*github.CommitFile),
+		dirs:  map[string]bool{".": true},
+	}
+	for _, file := range files {
+		t.files[file.GetFilename()] = file
+		for dir := path.Dir(file.GetFilename()); dir != "." && !t.dirs[dir]; dir = path.Dir(dir) {
+			t.dirs[dir] = true
+		}
+	}
+	return t
+}
+
+// kustomizationFile returns the path of the kustomization in dir, if any
+func (t *kustomizeTree) kustomizationFile(dir string) (string, bool) {
+	for _, name := range kustomizationFilenames {
+		filename := path.Join(dir, name)
+		if _, ok := t.files[filename]; ok {
+			return filename, true
+		}
+	}
+	return "", false
+}
+
+// kustomizationDirs returns dir along with the directories of the
+// kustomizations it refers to, directly or through other kustomizations.
+// kustomize only reads files beneath the directory of each kustomization, so
+// these directories hold every file a build of dir depends on. References to
+// anything other than a file or directory in the repository are errors, as
+// remote bases aren't supported.
+func (t *kustomizeTree) kustomizationDirs(dir string, load func(string) ([]byte, error)) ([]string, error) {
+	var dirs []string
+	seen := make(map[string]bool)
+	queue := []string{path.Clean(dir)}
+	for len(queue) > 0 {
+		dir, queue = queue[0], queue[1:]
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		dirs = append(dirs, dir)
+
+		filename, ok := t.kustomizationFile(dir)
+		if !ok {
+			return nil, fmt.Errorf("%s doesn't contain a kustomization.yaml", dir)
+		}
+		contents, err := load(filename)
+		if err != nil {
+			return nil, err
+		}
+		var k kustomizationReferences
+		if err := yaml.Unmarshal(contents, &k); err != nil {
+			return nil, fmt.Errorf("Couldn't parse %s: %s", filename, err)
+		}
+
+		references := append(append(k.Bases, k.Resources...), k.Components...)
+		for _, plugins := range [][]string{k.Generators, k.Transformers, k.Validators} {
+			for _, plugin := range plugins {
+				// Plugins may be configured inline rather than in a file
+				if !strings.Contains(plugin, "\n") {
+					references = append(references, plugin)
+				}
+			}
+		}
+		for _, reference := range references {
+			referencePath := path.Join(dir, reference)
+			if _, ok := t.files[referencePath]; ok {
+				continue
+			}
+			if !t.dirs[referencePath] {
+				return nil, fmt.Errorf("%s refers to %s, which isn't a file or directory in the repository. Remote bases aren't supported.", filename, reference)
+			}
+			queue = append(queue, referencePath)
+		}
+	}
+	return dirs, nil
+}
+
+// filesIn returns the files beneath any of dirs
+func (t *kustomizeTree) filesIn(dirs []string) []*github.CommitFile {
+	var files []*github.CommitFile
+	for filename, file := range t.files {
+		if inAnyDir(filename, dirs) {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// inAnyDir determines whether or not filename is beneath any of dirs
+func inAnyDir(filename string, dirs []string) bool {
+	for _, dir := range dirs {
+		if dir == "." || strings.HasPrefix(filename, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// buildKustomization builds the kustomization in dir with kustomize from
+// files, returning the resources it produces in order along with the files
+// they were defined in
+func buildKustomization(dir string, filename string, files map[string][]byte) ([]*kustomizeResource, error) {
+	// Origin annotations record where each resource was defined. They're
+	// removed again after the build unless the kustomization asked for them.
+	kustomization, keepOrigins, err := withOriginAnnotations(files[filename])
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't parse %s: %s", filename, err)
+	}
+
+	fs := filesys.MakeFsInMemory()
+	for name, contents := range files {
+		if name == filename {
+			contents = kustomization
+		}
+		if err := fs.WriteFile(path.Join("/", name), contents); err != nil {
+			return nil, err
+		}
+	}
+	resMap, err := krusty.MakeKustomizer(krusty.MakeDefaultOptions()).Run(fs, path.Join("/", dir))
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []*kustomizeResource
+	for _, resource := range resMap.Resources() {
+		origin, err := resource.GetOrigin()
+		if err != nil {
+			return nil, err
+		}
+		originPath := filename
+		if origin != nil && origin.Path != "" {
+			originPath = path.Join(dir, origin.Path)
+		} else if origin != nil && origin.ConfiguredIn != "" {
+			originPath = path.Join(dir, origin.ConfiguredIn)
+		}
+		if !keepOrigins {
+			if err := resource.SetOrigin(nil); err != nil {
+				return nil, err
+			}
+		}
+		body, err := resource.RNode.String()
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, &kustomizeResource{origin: originPath, body: body})
+	}
+	return resources, nil
+}
+
+// withOriginAnnotations adds originAnnotations to the buildMetadata of a
+// kustomization, returning whether or not it was already present
+func withOriginAnnotations(kustomization []byte) ([]byte, bool, error) {
+	var k yaml.MapSlice
+	if err := yaml.Unmarshal(kustomization, &k); err != nil {
+		return nil, false, err
+	}
+	for i, item := range k {
+		if item.Key != "buildMetadata" {
+			continue
+		}
+		options, _ := item.Value.([]interface{})
+		for _, option := range options {
+			if option == types.OriginAnnotations {
+				return kustomization, true, nil
+			}
+		}
+		k[i].Value = append(options, types.OriginAnnotations)
+		b, err := yaml.Marshal(k)
+		return b, false, err
+	}
+	k = append(k, yaml.MapItem{Key: "buildMetadata", Value: []interface{}{types.OriginAnnotations}})
+	b, err := yaml.Marshal(k)
+	return b, false, err
+}
+
+// buildKustomizations builds the configured kustomizations which depend on any
+// of the changed files, or which validate every file, returning a Candidate
+// for the resources built from each file
+func (c *Context) buildKustomizations(e *github.CheckSuiteEvent, config *KubeValidatorConfig, changedFiles []*github.CommitFile) (Candidates, Annotations) {
+	var candidates Candidates
+	var annotations Annotations
+	if config.Spec == nil {
+		return candidates, annotations
+	}
+
+	var manifests []*KubeValidatorConfigManifest
+	for _, manifest := range config.Spec.Manifests {
+		if manifest.Kustomize != "" {
+			manifests = append(manifests, manifest)
+		}
+	}
+	if len(manifests) == 0 {
+		return candidates, annotations
+	}
+
+	treeFiles, err := c.treeFileList(e)
+	if err != nil {
+		for _, manifest := range manifests {
+			annotations = append(annotations, configErrorAnnotation(e, fmt.Sprintf("Error building %s", path.Clean(manifest.Kustomize)), err))
+		}
+		return candidates, annotations
+	}
+	tree := newKustomizeTree(treeFiles)
+	blobURLs := make(map[string]*string)
+	for _, file := range treeFiles {
+		blobURLs[file.GetFilename()] = file.BlobURL
+	}
+	load := func(filename string) ([]byte, error) {
+		b, err := c.bytesForFile(e, tree.files[filename])
+		if err != nil {
+			return nil, err
+		}
+		return *b, nil
+	}
+
+	changedFileNames := changedFileSet(changedFiles)
+	for _, manifest := range manifests {
+		dir := path.Clean(manifest.Kustomize)
+
+		// Find the files the build depends on before building it so that
+		// kustomizations which haven't changed aren't built
+		dirs, err := tree.kustomizationDirs(dir, load)
+		if err != nil {
+			annotations = append(annotations, configErrorAnnotation(e, fmt.Sprintf("Error building %s", dir), err))
+			continue
+		}
+		changed := false
+		for _, file := range changedFiles {
+			if inAnyDir(file.GetFilename(), dirs) {
+				changed = true
+				break
+			}
+		}
+		if !changed && !config.validatesAll(manifest, changedFileNames) {
+			continue
+		}
+
+		dependencies := tree.filesIn(dirs)
+		filename, _ := tree.kustomizationFile(dir)
+		size := 0
+		for _, file := range dependencies {
+			size += c.treeSizes[file.GetFilename()]
+		}
+		if size > maxKustomizationBytes {
+			annotations = append(annotations, &github.CheckRunAnnotation{
+				Path:            github.String(filename),
+				BlobHRef:        blobURLs[filename],
+				StartLine:       github.Int(1),
+				EndLine:         github.Int(1),
+				AnnotationLevel: github.String("notice"),
+				Title:           github.String(fmt.Sprintf("%s wasn't built", dir)),
+				Message:         github.String(fmt.Sprintf("Building %s would load %d bytes from the %d files beneath %s, more than the limit of %d bytes. Move the kustomization and the files it uses into their own directory to validate it.", dir, size, len(dependencies), strings.Join(dirs, ", "), maxKustomizationBytes)),
+			})
+			continue
+		}
+
+		contents, errs := c.loadFiles(e, dependencies)
+		files := make(map[string][]byte)
+		var loadErr error
+		for i, file := range dependencies {
+			if errs[i] != nil {
+				loadErr = errs[i]
+				break
+			}
+			files[file.GetFilename()] = *contents[i]
+		}
+		if loadErr != nil {
+			annotations = append(annotations, configErrorAnnotation(e, fmt.Sprintf("Error building %s", dir), loadErr))
+			continue
+		}
+
+		resources, err := buildKustomization(dir, filename, files)
+		if err != nil {
+			annotations = append(annotations, &github.CheckRunAnnotation{
+				Path:            github.String(filename),
+				BlobHRef:        blobURLs[filename],
+				StartLine:       github.Int(1),
+				EndLine:         github.Int(1),
+				AnnotationLevel: github.String("failure"),
+				Title:           github.String(fmt.Sprintf("Error building %s", dir)),
+				Message:         github.String(err.Error()),
+			})
+			continue
+		}
+
+		// Group the resources by the files they were defined in so that
+		// annotations can point at them
+		var origins []string
+		byOrigin := make(map[string][]string)
+		for _, resource := range resources {
+			if _, ok := byOrigin[resource.origin]; !ok {
+				origins = append(origins, resource.origin)
+			}
+			byOrigin[resource.origin] = append(byOrigin[resource.origin], resource.body)
+		}
+		for _, origin := range origins {
+			output := []byte(strings.Join(byOrigin[origin], "---\n"))
+			candidate := NewCandidate(c, &github.CommitFile{
+				Filename: github.String(origin),
+				BlobURL:  blobURLs[origin],
+			}, manifest.Schemas)
+			candidate.setBytes(&output)
+			candidate.rendered = &renderedSource{
+				Description: fmt.Sprintf("built with kustomize from %s", dir),
+				lines:       mapRenderedLines(string(files[origin]), string(output)),
+			}
+			candidates = append(candidates, candidate)
+		}
+	}
+	return candidates, annotations
+}
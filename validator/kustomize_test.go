@@ -0,0 +1,263 @@
+package validator
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/google/go-github/github"
+)
+
+func TestBuildKustomization(t *testing.T) {
+	files := readFixtureFiles(t, "fixtures/kustomize")
+	resources, err := buildKustomization("fixtures/kustomize/overlays/production", "fixtures/kustomize/overlays/production/kustomization.yaml", files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resources) != 3 {
+		t.Fatalf("expected a deployment, service and configmap, got %d resources", len(resources))
+	}
+
+	want := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: production-web
+  labels:
+    app: web
+  namespace: production
+spec:
+  replicas: three
+  selector:
+    matchLabels:
+      tier: frontend
+      app: web
+  template:
+    metadata:
+      labels:
+        tier: frontend
+        app: web
+    spec:
+      containers:
+      - name: web
+        image: nginx:1.16
+        envFrom:
+        - configMapRef:
+            name: production-web-hf678c7m2b
+        extra: true
+`
+	if diff := deep.Equal(resources[0].body, want); diff != nil {
+		t.Error(diff)
+	}
+
+	wantOrigins := []string{
+		"fixtures/kustomize/base/deployment.yaml",
+		"fixtures/kustomize/base/service.yaml",
+		"fixtures/kustomize/overlays/production/kustomization.yaml",
+	}
+	for i, resource := range resources {
+		if resource.origin != wantOrigins[i] {
+			t.Errorf("expected resource %d to be defined in %s, got %s", i, wantOrigins[i], resource.origin)
+		}
+		if strings.Contains(resource.body, "config.kubernetes.io/origin") {
+			t.Errorf("expected origin annotations to be removed, got %s", resource.body)
+		}
+	}
+}
+
+func TestKustomizationDirs(t *testing.T) {
+	files := readFixtureFiles(t, "fixtures/kustomize")
+	files["fixtures/kustomize/overlays/remote/kustomization.yaml"] = []byte("resources:\n- github.com/kubernetes-sigs/kustomize/examples/multibases?ref=v1.0.6\n")
+	var treeFiles []*github.CommitFile
+	for filename := range files {
+		treeFiles = append(treeFiles, &github.CommitFile{Filename: github.String(filename)})
+	}
+	tree := newKustomizeTree(treeFiles)
+	load := func(filename string) ([]byte, error) {
+		return files[filename], nil
+	}
+
+	dirs, err := tree.kustomizationDirs("fixtures/kustomize/overlays/production", load)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(dirs, []string{"fixtures/kustomize/overlays/production", "fixtures/kustomize/base"}); diff != nil {
+		t.Error(diff)
+	}
+
+	if _, err := tree.kustomizationDirs("fixtures/kustomize/overlays/remote", load); err == nil || !strings.Contains(err.Error(), "Remote bases aren't supported") {
+		t.Errorf("expected remote bases to be an error, got %v", err)
+	}
+}
+
+func TestUnknownKustomizationFieldsAreErrors(t *testing.T) {
+	files := readFixtureFiles(t, "fixtures/kustomize")
+	files["fixtures/kustomize/base/kustomization.yaml"] = append(files["fixtures/kustomize/base/kustomization.yaml"], []byte("replicaCount: 3\n")...)
+	_, err := buildKustomization("fixtures/kustomize/overlays/production", "fixtures/kustomize/overlays/production/kustomization.yaml", files)
+	if err == nil || !strings.Contains(err.Error(), `unknown field "replicaCount"`) {
+		t.Errorf("expected an error about the unknown field, got %v", err)
+	}
+}
+
+func TestAnnotationsForBuiltKustomization(t *testing.T) {
+	client, mux, _, teardown := setup()
+	defer teardown()
+	serveFixtureFiles(t, mux, "fixtures/kustomize")
+
+	schemaDir, _ := filepath.Abs("../fixtures/schemas")
+	ctx := context.Background()
+	c := &Context{
+		Ctx:       &ctx,
+		Github:    client,
+		Event:     &github.CheckSuiteEvent{},
+		SchemaDir: schemaDir,
+	}
+	e := &github.CheckSuiteEvent{
+		CheckSuite: &github.CheckSuite{
+			HeadSHA: github.String("abc"),
+		},
+		Repo: &github.Repository{
+			Name: github.String("r"),
+			Owner: &github.User{
+				Login: github.String("o"),
+			},
+		},
+	}
+	config := &KubeValidatorConfig{
+		Spec: &KubeValidatorConfigSpec{
+			Manifests: []*KubeValidatorConfigManifest{
+				{
+					Kustomize: "fixtures/kustomize/overlays/production",
+					Schemas:   []*KubeValidatorConfigSchema{{OnlyKinds: []string{"Deployment"}}},
+				},
+			},
+		},
+	}
+	if !config.Valid() {
+		t.Fatalf("Config expected to be valid: %+v", config)
+	}
+
+	unrelated := []*github.CommitFile{{Filename: github.String("fixtures/charts/web/values.yaml")}}
+	if candidates, annotations := c.buildKustomizations(e, config, unrelated); len(candidates) != 0 || len(annotations) != 0 {
+		t.Errorf("expected nothing to be built when no dependencies changed, got %d candidates", len(candidates))
+	}
+
+	changed := []*github.CommitFile{{Filename: github.String("fixtures/kustomize/base/deployment.yaml")}}
+	candidates, annotations := c.buildKustomizations(e, config, changed)
+	if len(annotations) != 0 {
+		t.Fatalf("unexpected annotations: %s", github.Stringify(annotations))
+	}
+	if len(candidates) != 3 {
+		t.Fatalf("expected a candidate for each origin, got %d", len(candidates))
+	}
+
+	annotations = candidates.Validate()
+	want := []struct {
+		path    string
+		line    int
+		message string
+	}{
+		{"fixtures/kustomize/overlays/production/kustomization.yaml", 1, "ConfigMap isn't listed in onlyKinds"},
+		{"fixtures/kustomize/base/service.yaml", 1, "Service isn't listed in onlyKinds"},
+		{"fixtures/kustomize/base/deployment.yaml", 20, "extra: Additional property extra is not allowed; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.32/#container-v1-core for more details"},
+		{"fixtures/kustomize/base/deployment.yaml", 6, "spec.replicas: Invalid type. Expected: integer, given: string; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.32/#deploymentspec-v1-apps for more details"},
+	}
+	if len(annotations) != len(want) {
+		t.Fatalf("a total of %d annotations were returned, wanted %d: %s", len(annotations), len(want), github.Stringify(annotations))
+	}
+	for i, annotation := range annotations {
+		if annotation.GetPath() != want[i].path || annotation.GetStartLine() != want[i].line || annotation.GetMessage() != want[i].message {
+			t.Errorf("expected %q on line %d of %s, got %s", want[i].message, want[i].line, want[i].path, github.Stringify(annotation))
+		}
+	}
+	if title := annotations[3].GetTitle(); title != "Error validating Deployment against master schema (built with kustomize from fixtures/kustomize/overlays/production)" {
+		t.Errorf("unexpected title %q", title)
+	}
+}
+
+func TestKustomizationBuildErrorsAreAnnotated(t *testing.T) {
+	client, mux, _, teardown := setup()
+	defer teardown()
+	serveFixtureFiles(t, mux, "fixtures/kustomize")
+
+	ctx := context.Background()
+	c := &Context{
+		Ctx:    &ctx,
+		Github: client,
+		Event:  &github.CheckSuiteEvent{},
+	}
+	e := &github.CheckSuiteEvent{
+		CheckSuite: &github.CheckSuite{
+			HeadSHA: github.String("abc"),
+		},
+		Repo: &github.Repository{
+			Name: github.String("r"),
+			Owner: &github.User{
+				Login: github.String("o"),
+			},
+		},
+	}
+	config := &KubeValidatorConfig{
+		Spec: &KubeValidatorConfigSpec{
+			Manifests: []*KubeValidatorConfigManifest{
+				{Kustomize: "fixtures/kustomize/overlays/helm"},
+			},
+		},
+	}
+
+	changed := []*github.CommitFile{{Filename: github.String("fixtures/kustomize/base/service.yaml")}}
+	candidates, annotations := c.buildKustomizations(e, config, changed)
+	if len(candidates) != 0 || len(annotations) != 1 {
+		t.Fatalf("expected a single annotation, got %d candidates and %s", len(candidates), github.Stringify(annotations))
+	}
+	annotation := annotations[0]
+	if annotation.GetPath() != "fixtures/kustomize/overlays/helm/kustomization.yaml" || annotation.GetAnnotationLevel() != "failure" || !strings.Contains(annotation.GetMessage(), "HelmChartInflationGenerator") {
+		t.Errorf("unexpected annotation %s", github.Stringify(annotation))
+	}
+}
+
+func TestLargeKustomizationsArentBuilt(t *testing.T) {
+	client, mux, _, teardown := setup()
+	defer teardown()
+	serveFixtureFiles(t, mux, "fixtures/kustomize")
+
+	ctx := context.Background()
+	c := &Context{
+		Ctx:    &ctx,
+		Github: client,
+		Event:  &github.CheckSuiteEvent{},
+	}
+	e := &github.CheckSuiteEvent{
+		CheckSuite: &github.CheckSuite{
+			HeadSHA: github.String("abc"),
+		},
+		Repo: &github.Repository{
+			Name: github.String("r"),
+			Owner: &github.User{
+				Login: github.String("o"),
+			},
+		},
+	}
+	config := &KubeValidatorConfig{
+		Spec: &KubeValidatorConfigSpec{
+			Manifests: []*KubeValidatorConfigManifest{
+				{Kustomize: "fixtures/kustomize/overlays/production"},
+			},
+		},
+	}
+	if _, err := c.treeFileList(e); err != nil {
+		t.Fatal(err)
+	}
+	c.treeSizes["fixtures/kustomize/base/deployment.yaml"] = maxKustomizationBytes + 1
+
+	changed := []*github.CommitFile{{Filename: github.String("fixtures/kustomize/base/service.yaml")}}
+	candidates, annotations := c.buildKustomizations(e, config, changed)
+	if len(candidates) != 0 || len(annotations) != 1 {
+		t.Fatalf("expected a single annotation, got %d candidates and %s", len(candidates), github.Stringify(annotations))
+	}
+	annotation := annotations[0]
+	if annotation.GetPath() != "fixtures/kustomize/overlays/production/kustomization.yaml" || annotation.GetAnnotationLevel() != "notice" || annotation.GetTitle() != "fixtures/kustomize/overlays/production wasn't built" {
+		t.Errorf("unexpected annotation %s", github.Stringify(annotation))
+	}
+}
@@ -0,0 +1,142 @@
+package validator
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+const (
+	outcomePass    = "✅"
+	outcomeWarning = "⚠️"
+	outcomeFail    = "❌"
+	outcomeSkipped = "➖"
+)
+
+// resourceRow records the outcome of validating a single resource against
+// each of a Candidate's schemas
+type resourceRow struct {
+	Kind     string
+	Name     string
+	outcomes map[string]string
+}
+
+// outcomeFor summarizes the result of validating a resource against a single
+// schema
+func outcomeFor(result validationResult, deprecation *github.CheckRunAnnotation) string {
+	outcome := outcomePass
+	if result.Skipped || result.MissingSchema != "" {
+		outcome = outcomeSkipped
+	} else if result.Err != nil || len(result.Errors) > 0 {
+		outcome = outcomeFail
+	}
+
+	if deprecation != nil {
+		switch deprecation.GetAnnotationLevel() {
+		case "failure":
+			outcome = outcomeFail
+		case "warning":
+			if outcome == outcomePass {
+				outcome = outcomeWarning
+			}
+		}
+	}
+	return outcome
+}
+
+// recordOutcome records the outcome of validating the document at index
+// against the named schema
+func (c *Candidate) recordOutcome(index int, result validationResult, schemaName string, outcome string) {
+	// Empty documents aren't resources
+	if result.Kind == "" && result.Err == nil {
+		return
+	}
+	for len(c.rows) <= index {
+		c.rows = append(c.rows, nil)
+	}
+	row := c.rows[index]
+	if row == nil {
+		row = &resourceRow{
+			outcomes: make(map[string]string),
+		}
+		c.rows[index] = row
+	}
+	if row.Kind == "" {
+		row.Kind = result.Kind
+	}
+	if row.Name == "" {
+		row.Name = result.Name
+	}
+	row.outcomes[schemaName] = outcome
+}
+
+// compatibilityMatrix returns a Markdown table with a row for each resource
+// and a column for each schema showing whether or not it passed validation.
+// Rows which don't fit in maxLength characters are left out and counted.
+func (c Candidates) compatibilityMatrix(maxLength int) string {
+	var schemaNames []string
+	seen := make(map[string]bool)
+	for _, candidate := range c {
+		for _, schema := range candidate.schemas {
+			name := schema.displayName()
+			if !seen[name] {
+				seen[name] = true
+				schemaNames = append(schemaNames, name)
+			}
+		}
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString("| File | Kind | Name |")
+	for _, name := range schemaNames {
+		buffer.WriteString(fmt.Sprintf(" %s |", escapeTableCell(name)))
+	}
+	buffer.WriteString("\n| --- | --- | --- |")
+	buffer.WriteString(strings.Repeat(" :---: |", len(schemaNames)))
+	buffer.WriteString("\n")
+
+	rows := 0
+	omitted := 0
+	for _, candidate := range c {
+		for _, row := range candidate.rows {
+			if row == nil {
+				continue
+			}
+			rows++
+			kind := row.Kind
+			if kind == "" {
+				kind = "?"
+			}
+			line := fmt.Sprintf("| [`./%s`](%s) | %s | %s |", candidate.file.GetFilename(), candidate.file.GetBlobURL(), escapeTableCell(kind), escapeTableCell(row.Name))
+			for _, name := range schemaNames {
+				outcome, ok := row.outcomes[name]
+				if !ok {
+					outcome = outcomeSkipped
+				}
+				line += fmt.Sprintf(" %s |", outcome)
+			}
+			if omitted > 0 || buffer.Len()+len(line)+len(omittedRowsNote) > maxLength {
+				omitted++
+				continue
+			}
+			buffer.WriteString(line + "\n")
+		}
+	}
+
+	if rows == 0 {
+		return ""
+	}
+	if omitted > 0 {
+		buffer.WriteString(fmt.Sprintf(omittedRowsNote, omitted))
+	}
+	return buffer.String()
+}
+
+// omittedRowsNote counts the rows left out of a compatibility matrix
+const omittedRowsNote = "\n%d more resources didn't fit in this summary.\n"
+
+func escapeTableCell(s string) string {
+	return strings.Replace(s, "|", "\\|", -1)
+}
@@ -0,0 +1,67 @@
+package validator
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+func TestCompatibilityMatrix(t *testing.T) {
+	schemaDir, _ := filepath.Abs("../fixtures/schemas")
+	context := &Context{
+		Event:     &github.CheckSuiteEvent{},
+		SchemaDir: schemaDir,
+	}
+	schemas := []*KubeValidatorConfigSchema{
+		{Name: "strict"},
+		{Name: "relaxed", Strict: github.Bool(false), IgnoreMissingSchemas: true},
+	}
+
+	var candidates Candidates
+	for _, fixture := range []string{"deployment.yaml", "multiple-kinds/unknown-kind.yaml"} {
+		candidate := NewCandidate(context, &github.CommitFile{
+			Filename: github.String(fixture),
+			BlobURL:  github.String("https://github.com/o/r/blob/abc/" + fixture),
+		}, schemas)
+		fileContents, _ := ioutil.ReadFile(filepath.Join("..", "fixtures", fixture))
+		candidate.setBytes(&fileContents)
+		candidates = append(candidates, candidate)
+	}
+	candidates.Validate()
+
+	want := "| File | Kind | Name | strict | relaxed |\n" +
+		"| --- | --- | --- | :---: | :---: |\n" +
+		"| [`./deployment.yaml`](https://github.com/o/r/blob/abc/deployment.yaml) | Deployment | kubevalidator | ✅ | ✅ |\n" +
+		"| [`./multiple-kinds/unknown-kind.yaml`](https://github.com/o/r/blob/abc/multiple-kinds/unknown-kind.yaml) | Deployment | kubevalidator | ❌ | ❌ |\n" +
+		"| [`./multiple-kinds/unknown-kind.yaml`](https://github.com/o/r/blob/abc/multiple-kinds/unknown-kind.yaml) | Widget | widget | ❌ | ➖ |\n"
+
+	if got := candidates.compatibilityMatrix(maxTextLength); got != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+
+	lines := strings.SplitAfter(want, "\n")
+	want = strings.Join(lines[:3], "") + "\n2 more resources didn't fit in this summary.\n"
+	if got := candidates.compatibilityMatrix(len(strings.Join(lines[:3], "")) + len(omittedRowsNote)); got != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestCompatibilityMatrixWithoutResources(t *testing.T) {
+	var candidates Candidates
+	if got := candidates.compatibilityMatrix(maxTextLength); got != "" {
+		t.Errorf("expected no matrix, got %s", got)
+	}
+}
+
+func TestTruncateList(t *testing.T) {
+	items := []string{"* one", "* two", "* three"}
+	if got, want := truncateList(items, maxTextLength), "* one\n* two\n* three"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if got, want := truncateList(items, 30), "* one\n* ...and 2 more files"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
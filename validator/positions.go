@@ -0,0 +1,327 @@
+package validator
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// yamlPosition is a line and column in a document, both starting at 1.
+// Columns are counted in bytes.
+type yamlPosition struct {
+	Line   int
+	Column int
+}
+
+// yamlRange is the span of a document between two positions, inclusive
+type yamlRange struct {
+	Start yamlPosition
+	End   yamlPosition
+}
+
+// yamlNode is a node of a YAML document along with where it was found.
+// yaml.v2 doesn't expose the positions of the nodes it decodes, so documents
+// are parsed a second time with yaml.v3, which records where each node
+// starts. Where each node ends is found by scanning the document from there.
+type yamlNode struct {
+	node  *yamlv3.Node
+	start yamlPosition
+	end   yamlPosition
+
+	// keys holds the keys of a mapping
+	keys []*yamlNode
+	// children holds the values of a mapping or the items of a sequence
+	children []*yamlNode
+}
+
+// yamlSource holds the lines of a document so that the ends of its nodes can
+// be found
+type yamlSource struct {
+	lines []string
+}
+
+// parseNodes parses a single document into a tree of nodes
+func parseNodes(b []byte) *yamlNode {
+	var document yamlv3.Node
+	if err := yamlv3.Unmarshal(b, &document); err != nil || len(document.Content) == 0 {
+		return nil
+	}
+	s := &yamlSource{}
+	for _, line := range strings.Split(string(b), "\n") {
+		s.lines = append(s.lines, strings.TrimRight(line, "\r"))
+	}
+	return s.build(document.Content[0], false)
+}
+
+// build converts node and its descendants, which are in a flow collection
+// when flow is set
+func (s *yamlSource) build(node *yamlv3.Node, flow bool) *yamlNode {
+	n := &yamlNode{node: node, start: s.position(node.Line, node.Column)}
+	flow = flow || node.Style&yamlv3.FlowStyle != 0
+	switch node.Kind {
+	case yamlv3.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			n.keys = append(n.keys, s.build(node.Content[i], flow))
+			n.children = append(n.children, s.build(node.Content[i+1], flow))
+		}
+	case yamlv3.SequenceNode:
+		for _, item := range node.Content {
+			n.children = append(n.children, s.build(item, flow))
+		}
+	}
+
+	switch {
+	case (node.Kind == yamlv3.MappingNode || node.Kind == yamlv3.SequenceNode) && node.Style&yamlv3.FlowStyle != 0:
+		n.end = s.flowEnd(n.start)
+	case node.Kind == yamlv3.MappingNode || node.Kind == yamlv3.SequenceNode:
+		n.end = n.start
+		if len(n.children) > 0 {
+			n.end = n.children[len(n.children)-1].end
+		}
+		// Keys without values end with their key
+		if len(n.keys) > 0 && lessThan(n.end, n.keys[len(n.keys)-1].end) {
+			n.end = n.keys[len(n.keys)-1].end
+		}
+	default:
+		n.end = s.scalarEnd(node, s.skipProperties(n.start), flow)
+	}
+	return n
+}
+
+// position converts a line and a column counted in characters, as yaml.v3
+// reports them, into a position
+func (s *yamlSource) position(line int, column int) yamlPosition {
+	if line < 1 || line > len(s.lines) {
+		return yamlPosition{line, column}
+	}
+	text := s.lines[line-1]
+	offset := 0
+	for i := 1; i < column && offset < len(text); i++ {
+		_, size := utf8.DecodeRuneInString(text[offset:])
+		offset += size
+	}
+	return yamlPosition{line, offset + 1}
+}
+
+// text returns the rest of the line starting at p
+func (s *yamlSource) text(p yamlPosition) string {
+	if p.Line < 1 || p.Line > len(s.lines) || p.Column > len(s.lines[p.Line-1]) {
+		return ""
+	}
+	return s.lines[p.Line-1][p.Column-1:]
+}
+
+// skipProperties returns the position after the anchor and tag of the node
+// starting at p
+func (s *yamlSource) skipProperties(p yamlPosition) yamlPosition {
+	text := s.text(p)
+	for strings.HasPrefix(text, "&") || strings.HasPrefix(text, "!") {
+		length := strings.IndexAny(text, " \t")
+		if length < 0 {
+			length = len(text)
+		}
+		for length < len(text) && (text[length] == ' ' || text[length] == '\t') {
+			length++
+		}
+		p.Column += length
+		text = text[length:]
+	}
+	return p
+}
+
+// scalarEnd returns where the scalar or alias starting at p ends
+func (s *yamlSource) scalarEnd(node *yamlv3.Node, p yamlPosition, flow bool) yamlPosition {
+	switch {
+	case node.Style&yamlv3.DoubleQuotedStyle != 0:
+		return s.quotedEnd(p, '"')
+	case node.Style&yamlv3.SingleQuotedStyle != 0:
+		return s.quotedEnd(p, '\'')
+	case node.Style&(yamlv3.LiteralStyle|yamlv3.FoldedStyle) != 0:
+		return s.blockEnd(p)
+	}
+
+	text := s.text(p)
+	length := len(text)
+	for i := 0; i < len(text); i++ {
+		if (text[i] == '#' && i > 0 && (text[i-1] == ' ' || text[i-1] == '\t')) ||
+			(text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ' || text[i+1] == '\t' || (flow && strings.IndexByte(",[]{}", text[i+1]) >= 0))) ||
+			(flow && strings.IndexByte(",[]{}", text[i]) >= 0) {
+			length = i
+			break
+		}
+	}
+	length = len(strings.TrimRight(text[:length], " \t"))
+	// Empty values end just before where they'd start
+	return yamlPosition{p.Line, p.Column + length - 1}
+}
+
+// quotedEnd returns the position of the quote closing the string starting at
+// p, which may span several lines
+func (s *yamlSource) quotedEnd(p yamlPosition, quote byte) yamlPosition {
+	column := p.Column
+	for line := p.Line; line <= len(s.lines); line++ {
+		text := s.lines[line-1]
+		for i := column; i < len(text); i++ {
+			switch {
+			case quote == '"' && text[i] == '\\':
+				i++
+			case text[i] == quote && quote == '\'' && i+1 < len(text) && text[i+1] == '\'':
+				i++
+			case text[i] == quote:
+				return yamlPosition{line, i + 1}
+			}
+		}
+		column = 0
+	}
+	return p
+}
+
+// blockEnd returns the end of the last line of the literal or folded block
+// scalar whose header starts at p. Its lines are indented further than the
+// line holding its header.
+func (s *yamlSource) blockEnd(p yamlPosition) yamlPosition {
+	header := s.text(p)
+	if i := strings.IndexAny(header, " \t"); i >= 0 {
+		header = header[:i]
+	}
+	end := yamlPosition{p.Line, p.Column + len(header) - 1}
+	headerIndent := indentation(s.lines[p.Line-1])
+	indent := -1
+	for line := p.Line + 1; line <= len(s.lines); line++ {
+		text := s.lines[line-1]
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		if indent < 0 {
+			indent = indentation(text)
+		}
+		if indent <= headerIndent || indentation(text) < indent {
+			break
+		}
+		end = yamlPosition{line, len(strings.TrimRight(text, " \t"))}
+	}
+	return end
+}
+
+// flowEnd returns the position of the bracket closing the flow collection
+// starting at p
+func (s *yamlSource) flowEnd(p yamlPosition) yamlPosition {
+	depth := 0
+	var quote byte
+	column := p.Column - 1
+	for line := p.Line; line <= len(s.lines); line++ {
+		text := s.lines[line-1]
+		for i := column; i < len(text); i++ {
+			c := text[i]
+			switch {
+			case quote == '"' && c == '\\':
+				i++
+			case quote != 0:
+				if c == quote {
+					if quote == '\'' && i+1 < len(text) && text[i+1] == '\'' {
+						i++
+					} else {
+						quote = 0
+					}
+				}
+			case c == '"' || c == '\'':
+				quote = c
+			case c == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t'):
+				i = len(text)
+			case c == '{' || c == '[':
+				depth++
+			case c == '}' || c == ']':
+				depth--
+				if depth == 0 {
+					return yamlPosition{line, i + 1}
+				}
+			}
+		}
+		column = 0
+	}
+	return p
+}
+
+func indentation(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+func lessThan(a yamlPosition, b yamlPosition) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+}
+
+// lookup returns the node found at segments along with its key, which is nil
+// for the items of sequences and the root of the document
+func (n *yamlNode) lookup(segments []string) (*yamlNode, *yamlNode, bool) {
+	var key *yamlNode
+	node := n
+	for _, segment := range segments {
+		if node == nil {
+			return nil, nil, false
+		}
+		switch node.node.Kind {
+		case yamlv3.MappingNode:
+			found := -1
+			// Later keys override earlier ones, as they do when decoding
+			for i, k := range node.keys {
+				if k.node.Kind == yamlv3.ScalarNode && k.node.Value == segment {
+					found = i
+				}
+			}
+			if found < 0 {
+				return nil, nil, false
+			}
+			key, node = node.keys[found], node.children[found]
+		case yamlv3.SequenceNode:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(node.children) {
+				return nil, nil, false
+			}
+			key, node = nil, node.children[i]
+		default:
+			return nil, nil, false
+		}
+	}
+	return key, node, node != nil
+}
+
+// entryRange returns the range covering a node and its key, if any
+func entryRange(key *yamlNode, node *yamlNode) yamlRange {
+	if key != nil {
+		end := node.end
+		if lessThan(end, key.end) {
+			end = key.end
+		}
+		return yamlRange{Start: key.start, End: end}
+	}
+	return yamlRange{Start: node.start, End: node.end}
+}
+
+// pointerSegments splits a JSON pointer like /spec/replicas into its segments
+func pointerSegments(pointer string) []string {
+	if pointer == "" {
+		return nil
+	}
+	unescaper := strings.NewReplacer("~1", "/", "~0", "~")
+	var segments []string
+	for _, segment := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		segments = append(segments, unescaper.Replace(segment))
+	}
+	return segments
+}
+
+// locatePointer returns the range of a document containing the value found at
+// a JSON pointer like /spec/replicas, including its key
+func locatePointer(b []byte, pointer string) (yamlRange, bool) {
+	root := parseNodes(b)
+	if root == nil {
+		return yamlRange{}, false
+	}
+	key, node, ok := root.lookup(pointerSegments(pointer))
+	if !ok {
+		return yamlRange{}, false
+	}
+	return entryRange(key, node), true
+}
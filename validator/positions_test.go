@@ -0,0 +1,129 @@
+package validator
+
+import (
+	"testing"
+)
+
+func TestLocatePointer(t *testing.T) {
+	document := []byte(`# A comment
+apiVersion: v1 # trailing comment
+kind: ConfigMap
+metadata:
+  name: "settings"
+  labels: &labels
+    app.kubernetes.io/name: web
+    'quoted key': value
+data:
+  script: |
+    #!/bin/sh
+    echo "hello"
+
+  flow: {a: 1, b: [x, "y, z"]}
+  list:
+  - one
+  - name: two
+    value: 2
+  -
+    - nested
+  multiline: "first
+    second"
+  empty:
+`)
+	tests := []struct {
+		pointer string
+		want    yamlRange
+	}{
+		{"", yamlRange{yamlPosition{2, 1}, yamlPosition{23, 8}}},
+		{"/apiVersion", yamlRange{yamlPosition{2, 1}, yamlPosition{2, 14}}},
+		{"/metadata/name", yamlRange{yamlPosition{5, 3}, yamlPosition{5, 18}}},
+		{"/metadata/labels", yamlRange{yamlPosition{6, 3}, yamlPosition{8, 23}}},
+		{"/metadata/labels/app.kubernetes.io~1name", yamlRange{yamlPosition{7, 5}, yamlPosition{7, 31}}},
+		{"/metadata/labels/quoted key", yamlRange{yamlPosition{8, 5}, yamlPosition{8, 23}}},
+		{"/data/script", yamlRange{yamlPosition{10, 3}, yamlPosition{12, 16}}},
+		{"/data/flow/a", yamlRange{yamlPosition{14, 10}, yamlPosition{14, 13}}},
+		{"/data/flow/b/1", yamlRange{yamlPosition{14, 23}, yamlPosition{14, 28}}},
+		{"/data/list/0", yamlRange{yamlPosition{16, 5}, yamlPosition{16, 7}}},
+		{"/data/list/1", yamlRange{yamlPosition{17, 5}, yamlPosition{18, 12}}},
+		{"/data/list/1/value", yamlRange{yamlPosition{18, 5}, yamlPosition{18, 12}}},
+		{"/data/list/2/0", yamlRange{yamlPosition{20, 7}, yamlPosition{20, 12}}},
+		{"/data/multiline", yamlRange{yamlPosition{21, 3}, yamlPosition{22, 11}}},
+		{"/data/empty", yamlRange{yamlPosition{23, 3}, yamlPosition{23, 8}}},
+	}
+	for _, test := range tests {
+		got, ok := locatePointer(document, test.pointer)
+		if !ok {
+			t.Errorf("%q: not found", test.pointer)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%q: expected %+v, got %+v", test.pointer, test.want, got)
+		}
+	}
+
+	for _, pointer := range []string{"/missing", "/data/list/3", "/kind/0"} {
+		if _, ok := locatePointer(document, pointer); ok {
+			t.Errorf("%q: expected not to be found", pointer)
+		}
+	}
+}
+
+func TestLocateSequenceAtParentIndentation(t *testing.T) {
+	document := []byte(`spec:
+  containers:
+  - name: web
+    ports:
+    - containerPort: 80
+  - name: sidecar
+  volumes: []
+`)
+	got, ok := locatePointer(document, "/spec/containers/1/name")
+	if !ok || got.Start != (yamlPosition{6, 5}) {
+		t.Errorf("expected the second container's name on line 6, got %+v", got)
+	}
+	got, ok = locatePointer(document, "/spec/containers/0/ports/0/containerPort")
+	if !ok || got.Start != (yamlPosition{5, 7}) {
+		t.Errorf("expected the port on line 5, got %+v", got)
+	}
+	got, ok = locatePointer(document, "/spec/volumes")
+	if !ok || got != (yamlRange{yamlPosition{7, 3}, yamlPosition{7, 13}}) {
+		t.Errorf("expected volumes on line 7, got %+v", got)
+	}
+}
+
+func TestLocatePointerWithComplexKeysAndProperties(t *testing.T) {
+	document := []byte(`metadata:
+  ? name
+  : web
+  annotations: &annotations
+    description: "café"
+    owner: !!str team-a
+  labels: *annotations
+data:
+  ? |
+    multi
+    line
+  : value
+  after: {key: [1, 2]}
+`)
+	tests := []struct {
+		pointer string
+		want    yamlRange
+	}{
+		{"/metadata/name", yamlRange{yamlPosition{2, 5}, yamlPosition{3, 7}}},
+		{"/metadata/annotations/description", yamlRange{yamlPosition{5, 5}, yamlPosition{5, 24}}},
+		{"/metadata/annotations/owner", yamlRange{yamlPosition{6, 5}, yamlPosition{6, 23}}},
+		{"/metadata/labels", yamlRange{yamlPosition{7, 3}, yamlPosition{7, 22}}},
+		{"/data/after", yamlRange{yamlPosition{13, 3}, yamlPosition{13, 22}}},
+		{"/data/after/key/1", yamlRange{yamlPosition{13, 20}, yamlPosition{13, 20}}},
+	}
+	for _, test := range tests {
+		got, ok := locatePointer(document, test.pointer)
+		if !ok {
+			t.Errorf("%q: not found", test.pointer)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%q: expected %+v, got %+v", test.pointer, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package validator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// referenceField is a field which refers to another resource by name. When
+// NameField is set, Path points at an object whose NameField holds the name.
+type referenceField struct {
+	Path      string
+	Kind      string
+	NameField string
+}
+
+// podSpecReferenceFields lists the fields of a pod spec which refer to other
+// resources
+var podSpecReferenceFields = []referenceField{
+	{"serviceAccountName", "ServiceAccount", ""},
+	{"volumes[*].configMap", "ConfigMap", "name"},
+	{"volumes[*].secret", "Secret", "secretName"},
+	{"volumes[*].persistentVolumeClaim", "PersistentVolumeClaim", "claimName"},
+	{"volumes[*].projected.sources[*].configMap", "ConfigMap", "name"},
+	{"volumes[*].projected.sources[*].secret", "Secret", "name"},
+	{"containers[*].envFrom[*].configMapRef", "ConfigMap", "name"},
+	{"containers[*].envFrom[*].secretRef", "Secret", "name"},
+	{"containers[*].env[*].valueFrom.configMapKeyRef", "ConfigMap", "name"},
+	{"containers[*].env[*].valueFrom.secretKeyRef", "Secret", "name"},
+	{"initContainers[*].envFrom[*].configMapRef", "ConfigMap", "name"},
+	{"initContainers[*].envFrom[*].secretRef", "Secret", "name"},
+	{"initContainers[*].env[*].valueFrom.configMapKeyRef", "ConfigMap", "name"},
+	{"initContainers[*].env[*].valueFrom.secretKeyRef", "Secret", "name"},
+}
+
+// referenceableKinds are the kinds of resource which can be referred to
+var referenceableKinds = map[string]bool{
+	"ConfigMap":             true,
+	"Secret":                true,
+	"ServiceAccount":        true,
+	"PersistentVolumeClaim": true,
+	"Service":               true,
+}
+
+// defaultReferencedKinds are the kinds of resource which references are
+// checked by default. Secrets are usually created outside of the repository.
+var defaultReferencedKinds = []string{"ConfigMap", "ServiceAccount", "PersistentVolumeClaim", "Service"}
+
+// ingressReferenceFields lists the fields of an Ingress which refer to
+// Services in the extensions/v1beta1 and networking.k8s.io/v1 formats
+var ingressReferenceFields = []referenceField{
+	{"spec.backend", "Service", "serviceName"},
+	{"spec.defaultBackend.service", "Service", "name"},
+	{"spec.rules[*].http.paths[*].backend", "Service", "serviceName"},
+	{"spec.rules[*].http.paths[*].backend.service", "Service", "name"},
+}
+
+// podTemplatePaths maps kinds to the path of their pod template
+var podTemplatePaths = map[string]string{
+	"Pod":                   "",
+	"Deployment":            "spec.template",
+	"StatefulSet":           "spec.template",
+	"DaemonSet":             "spec.template",
+	"ReplicaSet":            "spec.template",
+	"ReplicationController": "spec.template",
+	"Job":                   "spec.template",
+	"CronJob":               "spec.jobTemplate.spec.template",
+}
+
+// resourceReference is a reference from one resource to another by name
+type resourceReference struct {
+	Kind     string
+	Name     string
+	segments []string
+}
+
+// podTemplate returns a resource's pod template and the path to it
+func podTemplate(body map[string]interface{}) (map[string]interface{}, []string, bool) {
+	kind, _ := body["kind"].(string)
+	path, ok := podTemplatePaths[kind]
+	if !ok {
+		return nil, nil, false
+	}
+	if path == "" {
+		return body, nil, true
+	}
+	segments, _ := parseRulePath(path)
+	for _, match := range resolvePath(body, segments, nil) {
+		if template, ok := match.value.(map[string]interface{}); ok && match.found {
+			return template, match.segments, true
+		}
+	}
+	return nil, nil, false
+}
+
+// referencesFrom returns the references a resource makes to other resources
+func referencesFrom(body map[string]interface{}) []resourceReference {
+	var references []resourceReference
+	if template, segments, ok := podTemplate(body); ok {
+		if spec, ok := template["spec"].(map[string]interface{}); ok {
+			references = append(references, findReferences(spec, appendSegment(segments, "spec"), podSpecReferenceFields)...)
+		}
+	}
+	if kind, _ := body["kind"].(string); kind == "Ingress" {
+		references = append(references, findReferences(body, nil, ingressReferenceFields)...)
+	}
+	return references
+}
+
+func findReferences(value interface{}, prefix []string, fields []referenceField) []resourceReference {
+	var references []resourceReference
+	for _, field := range fields {
+		segments, err := parseRulePath(field.Path)
+		if err != nil {
+			continue
+		}
+		for _, match := range resolvePath(value, segments, prefix) {
+			if !match.found {
+				continue
+			}
+			if field.NameField == "" {
+				if name, ok := match.value.(string); ok && name != "" && name != "default" {
+					references = append(references, resourceReference{Kind: field.Kind, Name: name, segments: match.segments})
+				}
+				continue
+			}
+			object, ok := match.value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if optional, _ := object["optional"].(bool); optional {
+				continue
+			}
+			if name, ok := object[field.NameField].(string); ok && name != "" {
+				references = append(references, resourceReference{Kind: field.Kind, Name: name, segments: appendSegment(match.segments, field.NameField)})
+			}
+		}
+	}
+	return references
+}
+
+// selectsPods determines whether or not any of the pod templates in the index
+// in namespace have all of the labels in selector
+func (i *resourceIndex) selectsPods(namespace string, selector map[string]interface{}) bool {
+	for _, resource := range i.resources {
+		if resource.namespace() != namespace {
+			continue
+		}
+		template, _, ok := podTemplate(resource.body)
+		if !ok {
+			continue
+		}
+		metadata, _ := template["metadata"].(map[string]interface{})
+		labels, _ := metadata["labels"].(map[string]interface{})
+		selected := true
+		for key, value := range selector {
+			if label, ok := labels[key]; !ok || fmt.Sprintf("%v", label) != fmt.Sprintf("%v", value) {
+				selected = false
+				break
+			}
+		}
+		if selected {
+			return true
+		}
+	}
+	return false
+}
+
+// danglingReferences returns an annotation for each reference made by the
+// resources being validated to a resource of one of kinds that isn't defined
+// in the index
+func (i *resourceIndex) danglingReferences(kinds []string) Annotations {
+	var annotations Annotations
+	checked := make(map[string]bool)
+	for _, kind := range kinds {
+		checked[kind] = true
+	}
+	for _, resource := range i.resources {
+		if resource.candidate == nil {
+			continue
+		}
+
+		for _, reference := range referencesFrom(resource.body) {
+			if !checked[reference.Kind] || len(i.find(reference.Kind, resource.namespace(), reference.Name)) > 0 {
+				continue
+			}
+			startLine, endLine := resource.lineNumbers(reference.segments)
+			annotations = append(annotations, &github.CheckRunAnnotation{
+				Path:            resource.file.Filename,
+				BlobHRef:        resource.file.BlobURL,
+				StartLine:       github.Int(startLine),
+				EndLine:         github.Int(endLine),
+				AnnotationLevel: github.String(resource.candidate.level("dangling_reference", "", resource.Kind, "warning")),
+				Title:           github.String(fmt.Sprintf("%s refers to a %s that isn't defined", resource, reference.Kind)),
+				Message:         github.String(fmt.Sprintf("%s %s isn't defined in any of the files matching the manifest globs", reference.Kind, reference.Name)),
+			})
+		}
+
+		if resource.Kind != "Service" {
+			continue
+		}
+		spec, _ := resource.body["spec"].(map[string]interface{})
+		selector, _ := spec["selector"].(map[string]interface{})
+		if serviceType, _ := spec["type"].(string); serviceType == "ExternalName" || len(selector) == 0 {
+			continue
+		}
+		if i.selectsPods(resource.namespace(), selector) {
+			continue
+		}
+		var labels []string
+		for key, value := range selector {
+			labels = append(labels, fmt.Sprintf("%s=%v", key, value))
+		}
+		sort.Strings(labels)
+		startLine, endLine := resource.lineNumbers([]string{"spec", "selector"})
+		annotations = append(annotations, &github.CheckRunAnnotation{
+			Path:            resource.file.Filename,
+			BlobHRef:        resource.file.BlobURL,
+			StartLine:       github.Int(startLine),
+			EndLine:         github.Int(endLine),
+			AnnotationLevel: github.String(resource.candidate.level("unmatched_selector", "", resource.Kind, "warning")),
+			Title:           github.String(fmt.Sprintf("%s doesn't select any pods", resource)),
+			Message:         github.String(fmt.Sprintf("None of the pod templates in the files matching the manifest globs are labeled %s", strings.Join(labels, ","))),
+		})
+	}
+	sort.Sort(annotations)
+	return annotations
+}
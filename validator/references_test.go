@@ -0,0 +1,201 @@
+package validator
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+func TestDanglingReferences(t *testing.T) {
+	client, mux, _, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/repos/o/r/git/trees/abc", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		fmt.Fprint(w, `{
+			"sha": "abc",
+			"tree": [
+				{"path": "fixtures/references/app.yaml", "type": "blob", "sha": "a1"},
+				{"path": "fixtures/references/config.yaml", "type": "blob", "sha": "c1"},
+				{"path": "README.md", "type": "blob"}
+			]
+		}`)
+	})
+	configContents, _ := ioutil.ReadFile("../fixtures/references/config.yaml")
+	configLoads := 0
+	mux.HandleFunc("/repos/o/r/contents/fixtures/references/config.yaml", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		configLoads++
+		fmt.Fprintf(w, `{
+			"type": "file",
+			"encoding": "base64",
+			"content": "%s"
+		}`, base64.StdEncoding.EncodeToString(configContents))
+	})
+
+	ctx := context.Background()
+	c := &Context{
+		Ctx:       &ctx,
+		Github:    client,
+		Event:     &github.CheckSuiteEvent{},
+		BlobCache: NewBlobCache(0),
+	}
+	e := &github.CheckSuiteEvent{
+		CheckSuite: &github.CheckSuite{
+			HeadSHA: github.String("abc"),
+		},
+		Repo: &github.Repository{
+			Name: github.String("r"),
+			Owner: &github.User{
+				Login: github.String("o"),
+			},
+		},
+	}
+	config := &KubeValidatorConfig{
+		Spec: &KubeValidatorConfigSpec{
+			Manifests: []*KubeValidatorConfigManifest{{Glob: "fixtures/references/*.yaml"}},
+		},
+	}
+
+	candidate := NewCandidate(c, &github.CommitFile{
+		Filename: github.String("fixtures/references/app.yaml"),
+	}, nil)
+	fileContents, _ := ioutil.ReadFile("../fixtures/references/app.yaml")
+	candidate.setBytes(&fileContents)
+
+	index, annotations := c.indexResources(e, config, Candidates{candidate})
+	if len(annotations) != 0 {
+		t.Fatalf("unexpected annotations: %s", github.Stringify(annotations))
+	}
+	if len(index.resources) != 6 {
+		t.Errorf("expected 6 resources to be indexed, got %d", len(index.resources))
+	}
+
+	// Unchanged files are only loaded once
+	next := &Context{Ctx: &ctx, Github: client, Event: &github.CheckSuiteEvent{}, BlobCache: c.BlobCache}
+	if _, annotations := next.indexResources(e, config, Candidates{candidate}); len(annotations) != 0 {
+		t.Fatalf("unexpected annotations: %s", github.Stringify(annotations))
+	}
+	if configLoads != 1 {
+		t.Errorf("expected config.yaml to be loaded once, got %d", configLoads)
+	}
+
+	config.Spec.References = []string{"ConfigMap", "Secret", "ServiceAccount", "PersistentVolumeClaim", "Service"}
+	if !config.Valid() {
+		t.Fatalf("Config expected to be valid: %+v", config)
+	}
+	annotations = index.danglingReferences(config.referencedKinds())
+	want := []struct {
+		line    int
+		title   string
+		message string
+	}{
+		{22, "Deployment web refers to a Secret that isn't defined", "Secret credentials isn't defined in any of the files matching the manifest globs"},
+		{29, "Deployment web refers to a PersistentVolumeClaim that isn't defined", "PersistentVolumeClaim data isn't defined in any of the files matching the manifest globs"},
+		{46, "Service api doesn't select any pods", "None of the pod templates in the files matching the manifest globs are labeled app=api"},
+		{70, "Ingress web refers to a Service that isn't defined", "Service admin isn't defined in any of the files matching the manifest globs"},
+	}
+	if len(annotations) != len(want) {
+		t.Fatalf("a total of %d annotations were returned, wanted %d: %s", len(annotations), len(want), github.Stringify(annotations))
+	}
+	for i, annotation := range annotations {
+		if annotation.GetStartLine() != want[i].line || annotation.GetTitle() != want[i].title || annotation.GetMessage() != want[i].message {
+			t.Errorf("expected %d %q %q, got %s", want[i].line, want[i].title, want[i].message, github.Stringify(annotation))
+		}
+		if annotation.GetAnnotationLevel() != "warning" {
+			t.Errorf("expected a warning, got %s", annotation.GetAnnotationLevel())
+		}
+	}
+
+	// References to Secrets aren't checked by default
+	config.Spec.References = nil
+	if got := len(index.danglingReferences(config.referencedKinds())); got != len(want)-1 {
+		t.Errorf("expected %d annotations without Secrets, got %d", len(want)-1, got)
+	}
+}
+
+func TestInvalidReferencesAreNotValid(t *testing.T) {
+	config := &KubeValidatorConfig{
+		Spec: &KubeValidatorConfigSpec{
+			References: []string{"Deployment"},
+		},
+	}
+	if config.Valid() {
+		t.Errorf("Config expected to be invalid: %+v", config)
+	}
+}
+
+func TestReferencesFromCronJob(t *testing.T) {
+	body := map[string]interface{}{
+		"kind": "CronJob",
+		"spec": map[string]interface{}{
+			"jobTemplate": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"template": map[string]interface{}{
+						"spec": map[string]interface{}{
+							"serviceAccountName": "default",
+							"volumes": []interface{}{
+								map[string]interface{}{
+									"name":   "config",
+									"secret": map[string]interface{}{"secretName": "backup"},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	references := referencesFrom(body)
+	if len(references) != 1 {
+		t.Fatalf("expected 1 reference, got %+v", references)
+	}
+	reference := references[0]
+	if reference.Kind != "Secret" || reference.Name != "backup" {
+		t.Errorf("unexpected reference %+v", reference)
+	}
+	if got := (pathMatch{segments: reference.segments}).String(); got != "spec.jobTemplate.spec.template.spec.volumes[0].secret.secretName" {
+		t.Errorf("unexpected path %s", got)
+	}
+}
+
+func TestReferencesResolveInTheDefaultNamespace(t *testing.T) {
+	app := []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: production
+spec:
+  template:
+    spec:
+      serviceAccountName: web
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: worker
+spec:
+  template:
+    spec:
+      serviceAccountName: web
+`)
+	serviceAccount := []byte(`apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: web
+`)
+	c := &Context{}
+	index := newResourceIndex()
+	index.Add(&github.CommitFile{Filename: github.String("app.yaml")}, app, NewCandidate(c, &github.CommitFile{Filename: github.String("app.yaml")}, nil))
+	index.Add(&github.CommitFile{Filename: github.String("service-account.yaml")}, serviceAccount, nil)
+
+	annotations := index.danglingReferences([]string{"ServiceAccount"})
+	if len(annotations) != 1 || annotations[0].GetStartLine() != 9 {
+		t.Fatalf("expected only the reference from the production namespace to dangle, got %s", github.Stringify(annotations))
+	}
+}
@@ -0,0 +1,342 @@
+package validator
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// hunkHeader matches the header of a hunk of a unified diff, capturing the
+// line of the new file on which it starts and, if it isn't 1, its length
+var hunkHeader = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,(\d+))? @@`)
+
+// lineRange is an inclusive range of lines
+type lineRange struct {
+	Start int
+	End   int
+}
+
+// hunkRanges returns the ranges of lines of the new version of a file which
+// were added or changed by its patch. The unchanged lines around them in each
+// hunk and the lines it removes aren't included.
+func hunkRanges(patch string) []lineRange {
+	var ranges []lineRange
+	line := 0
+	for _, l := range strings.Split(patch, "\n") {
+		if match := hunkHeader.FindStringSubmatch(l); match != nil {
+			line, _ = strconv.Atoi(match[1])
+			continue
+		}
+		switch {
+		case line == 0 || strings.HasPrefix(l, "-") || strings.HasPrefix(l, "\\"):
+			continue
+		case strings.HasPrefix(l, "+"):
+			if len(ranges) > 0 && ranges[len(ranges)-1].End == line-1 {
+				ranges[len(ranges)-1].End = line
+			} else {
+				ranges = append(ranges, lineRange{Start: line, End: line})
+			}
+		}
+		line++
+	}
+	return ranges
+}
+
+// fix replaces the columns of a single line of a file to address an error
+// which can be fixed mechanically
+type fix struct {
+	Line        int
+	StartColumn int
+	EndColumn   int
+	Replacement string
+	Reason      string
+}
+
+// offset moves a fix found within a document to its line in the file
+func (f fix) offset(documentStartLine int) fix {
+	f.Line += documentStartLine - 1
+	return f
+}
+
+// addFix records a fix unless an identical one has been recorded already, as
+// the same error is often found by each of a Candidate's schemas
+func (c *Candidate) addFix(f fix) {
+	for _, existing := range c.fixes {
+		if existing == f {
+			return
+		}
+	}
+	c.fixes = append(c.fixes, f)
+}
+
+// fixFor returns a fix for an error found in the resource at the JSON pointer
+// prefix of a document, if it can be fixed mechanically
+func fixFor(document []byte, prefix string, e gojsonschema.ResultError, suggestions []string) (fix, bool) {
+	root := parseNodes(document)
+	if root == nil {
+		return fix{}, false
+	}
+	_, node, ok := root.lookup(append(pointerSegments(prefix), contextSegments(e)...))
+	if !ok {
+		return fix{}, false
+	}
+
+	switch e.Type() {
+	case "additional_property_not_allowed":
+		// Only unambiguous typos are fixed
+		property, _ := e.Details()["property"].(string)
+		if len(suggestions) != 1 {
+			return fix{}, false
+		}
+		key, _, ok := node.lookup([]string{property})
+		if !ok || key == nil {
+			return fix{}, false
+		}
+		return rangeFix(key, suggestions[0], fmt.Sprintf("%s isn't a valid field; did you mean %s?", property, suggestions[0]))
+	case "invalid_type":
+		// Integers are often quoted by mistake
+		value, ok := e.Value().(string)
+		if !ok || e.Details()["expected"] != "integer" {
+			return fix{}, false
+		}
+		i, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fix{}, false
+		}
+		return rangeFix(node, strconv.Itoa(i), fmt.Sprintf("%s should be an integer rather than a string", e.Field()))
+	}
+	return fix{}, false
+}
+
+// apiVersionFix returns a fix replacing the apiVersion of the resource at the
+// JSON pointer prefix of a document with the one replacing it, as long as the
+// replacement is available in version and nothing else needs to change
+func apiVersionFix(document []byte, prefix string, deprecation *apiDeprecation, version string) (fix, bool) {
+	if !deprecation.fixableAt(version) {
+		return fix{}, false
+	}
+	root := parseNodes(document)
+	if root == nil {
+		return fix{}, false
+	}
+	_, node, ok := root.lookup(append(pointerSegments(prefix), "apiVersion"))
+	if !ok {
+		return fix{}, false
+	}
+	return rangeFix(node, deprecation.Replacement, deprecation.message(deprecation.levelAt(version)))
+}
+
+// rangeFix returns a fix replacing a node found on a single line
+func rangeFix(node *yamlNode, replacement string, reason string) (fix, bool) {
+	if node.start.Line != node.end.Line {
+		return fix{}, false
+	}
+	return fix{
+		Line:        node.start.Line,
+		StartColumn: node.start.Column,
+		EndColumn:   node.end.Column,
+		Replacement: replacement,
+		Reason:      reason,
+	}, true
+}
+
+// applyFixes applies the fixes of a single line to its text, preserving the
+// quotes around any replaced strings
+func applyFixes(text string, fixes []fix) (string, bool) {
+	sort.Slice(fixes, func(i, j int) bool {
+		return fixes[i].StartColumn > fixes[j].StartColumn
+	})
+	previousStart := len(text) + 1
+	for _, f := range fixes {
+		// Overlapping fixes can't be applied together
+		if f.StartColumn < 1 || f.EndColumn > len(text) || f.EndColumn >= previousStart {
+			return "", false
+		}
+		original := text[f.StartColumn-1 : f.EndColumn]
+		replacement := f.Replacement
+		if _, err := strconv.Atoi(replacement); err != nil && len(original) > 1 && (original[0] == '"' || original[0] == '\'') {
+			replacement = string(original[0]) + replacement + string(original[0])
+		}
+		text = text[:f.StartColumn-1] + replacement + text[f.EndColumn:]
+		previousStart = f.StartColumn
+	}
+	return text, true
+}
+
+// diffPositions maps the lines of the new version of a file to their position
+// in its patch, which is how review comments refer to them. Removed lines
+// can't be commented on.
+func diffPositions(patch string) map[int]int {
+	positions := make(map[int]int)
+	position := 0
+	line := 0
+	lines := strings.Split(patch, "\n")
+	for i, l := range lines {
+		if l == "" && i == len(lines)-1 {
+			break
+		}
+		if match := hunkHeader.FindStringSubmatch(l); match != nil {
+			line, _ = strconv.Atoi(match[1])
+			// The first hunk's header precedes position 1, but the headers
+			// of the others have positions of their own
+			if i > 0 {
+				position++
+			}
+			continue
+		}
+		position++
+		if strings.HasPrefix(l, "-") || strings.HasPrefix(l, "\\") {
+			continue
+		}
+		positions[line] = position
+		line++
+	}
+	return positions
+}
+
+// reviewComments suggests the Candidate's fixes on the lines of a pull
+// request's patch of its file
+func (c *Candidate) reviewComments(patch string) []*github.DraftReviewComment {
+	if c.rendered != nil || c.bytes == nil || len(c.fixes) == 0 {
+		return nil
+	}
+	positions := diffPositions(patch)
+
+	byLine := make(map[int][]fix)
+	var lines []int
+	for _, f := range c.fixes {
+		if _, ok := byLine[f.Line]; !ok {
+			lines = append(lines, f.Line)
+		}
+		byLine[f.Line] = append(byLine[f.Line], f)
+	}
+	sort.Ints(lines)
+
+	text := strings.Split(string(*c.bytes), "\n")
+	var comments []*github.DraftReviewComment
+	for _, line := range lines {
+		position, ok := positions[line]
+		if !ok || line > len(text) {
+			continue
+		}
+		original := strings.TrimSuffix(text[line-1], "\r")
+		fixed, ok := applyFixes(original, byLine[line])
+		if !ok {
+			continue
+		}
+		var reasons []string
+		for i := len(byLine[line]) - 1; i >= 0; i-- {
+			reasons = append(reasons, byLine[line][i].Reason)
+		}
+		comments = append(comments, &github.DraftReviewComment{
+			Path:     c.file.Filename,
+			Position: github.Int(position),
+			Body:     github.String(fmt.Sprintf("%s\n\n```suggestion\n%s\n```", strings.Join(reasons, "\n"), fixed)),
+		})
+	}
+	return comments
+}
+
+// createReviews suggests fixes for the errors which can be fixed mechanically
+// in a review of each of the check suite's pull requests. Positions are found
+// in each pull request's own patches, as they differ between pull requests.
+// Suggestions which have already been made aren't repeated.
+func (c *Context) createReviews(e *github.CheckSuiteEvent, candidates Candidates) error {
+	var fixable Candidates
+	for _, candidate := range candidates {
+		if candidate.rendered == nil && len(candidate.fixes) > 0 {
+			fixable = append(fixable, candidate)
+		}
+	}
+	if len(fixable) == 0 {
+		return nil
+	}
+
+	owner := e.Repo.GetOwner().GetLogin()
+	repo := e.Repo.GetName()
+	for _, pr := range e.CheckSuite.PullRequests {
+		files, err := c.pullRequestFiles(e, pr.GetNumber())
+		if err != nil {
+			return err
+		}
+		patches := make(map[string]string)
+		for _, file := range files {
+			patches[file.GetFilename()] = file.GetPatch()
+		}
+		var comments []*github.DraftReviewComment
+		for _, candidate := range fixable {
+			if patch, ok := patches[candidate.file.GetFilename()]; ok {
+				comments = append(comments, candidate.reviewComments(patch)...)
+			}
+		}
+		if len(comments) == 0 {
+			continue
+		}
+
+		existing, err := c.pullRequestComments(e, pr.GetNumber())
+		if err != nil {
+			return err
+		}
+		var newComments []*github.DraftReviewComment
+		for _, comment := range comments {
+			if !reviewCommentExists(existing, comment) {
+				newComments = append(newComments, comment)
+			}
+		}
+		if len(newComments) == 0 {
+			continue
+		}
+
+		fixesString := "fixes"
+		if len(newComments) == 1 {
+			fixesString = "fix"
+		}
+		_, _, err = c.Github.PullRequests.CreateReview(*c.Ctx, owner, repo, pr.GetNumber(), &github.PullRequestReviewRequest{
+			CommitID: e.CheckSuite.HeadSHA,
+			Body:     github.String(fmt.Sprintf("kubevalidator found %d %s it can make for you.", len(newComments), fixesString)),
+			Event:    github.String("COMMENT"),
+			Comments: newComments,
+		})
+		if err != nil {
+			return errors.Wrap(err, "Couldn't create review")
+		}
+	}
+	return nil
+}
+
+// pullRequestComments lists every page of the review comments made on a pull
+// request
+func (c *Context) pullRequestComments(e *github.CheckSuiteEvent, number int) ([]*github.PullRequestComment, error) {
+	var comments []*github.PullRequestComment
+	opt := &github.PullRequestListCommentsOptions{
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		page, resp, err := c.Github.PullRequests.ListComments(*c.Ctx, e.Repo.GetOwner().GetLogin(), e.Repo.GetName(), number, opt)
+		if err != nil {
+			return nil, errors.Wrap(err, "Couldn't list review comments")
+		}
+		comments = append(comments, page...)
+		if resp.NextPage == 0 {
+			return comments, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// reviewCommentExists determines whether or not an identical comment has
+// already been made on the same line
+func reviewCommentExists(existing []*github.PullRequestComment, comment *github.DraftReviewComment) bool {
+	for _, e := range existing {
+		if e.GetPath() == comment.GetPath() && e.GetPosition() == comment.GetPosition() && e.GetBody() == comment.GetBody() {
+			return true
+		}
+	}
+	return false
+}
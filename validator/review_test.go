@@ -0,0 +1,228 @@
+package validator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/google/go-github/github"
+)
+
+func TestDiffPositions(t *testing.T) {
+	patch, err := ioutil.ReadFile("../fixtures/review/deployment.patch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]int{
+		3: 1, 4: 2, 5: 3, 6: 5, 7: 6, 8: 7, 9: 8,
+		15: 10, 16: 11, 17: 12, 18: 13,
+	}
+	if diff := deep.Equal(diffPositions(string(patch)), want); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestApplyFixes(t *testing.T) {
+	tests := []struct {
+		text  string
+		fixes []fix
+		want  string
+		ok    bool
+	}{
+		{`  replicas: "3"`, []fix{{StartColumn: 13, EndColumn: 15, Replacement: "3"}}, `  replicas: 3`, true},
+		{`  "replcas": 3`, []fix{{StartColumn: 3, EndColumn: 11, Replacement: "replicas"}}, `  "replicas": 3`, true},
+		{`{"replcas": "3"}`, []fix{
+			{StartColumn: 2, EndColumn: 10, Replacement: "replicas"},
+			{StartColumn: 13, EndColumn: 15, Replacement: "3"},
+		}, `{"replicas": 3}`, true},
+		{`  replicas: 3`, []fix{{StartColumn: 3, EndColumn: 20, Replacement: "x"}}, "", false},
+		{`  replicas: 3`, []fix{
+			{StartColumn: 3, EndColumn: 10, Replacement: "x"},
+			{StartColumn: 5, EndColumn: 6, Replacement: "y"},
+		}, "", false},
+	}
+	for _, test := range tests {
+		got, ok := applyFixes(test.text, test.fixes)
+		if got != test.want || ok != test.ok {
+			t.Errorf("%s: expected %q %v, got %q %v", test.text, test.want, test.ok, got, ok)
+		}
+	}
+}
+
+func TestReviewComments(t *testing.T) {
+	schemaDir, _ := filepath.Abs("../fixtures/schemas")
+	tests := []struct {
+		file   string
+		schema *KubeValidatorConfigSchema
+		want   []*github.DraftReviewComment
+	}{
+		{
+			"deployment",
+			nil,
+			[]*github.DraftReviewComment{
+				{
+					Path:     github.String("deployment.yaml"),
+					Position: github.Int(5),
+					Body:     github.String("spec.replicas should be an integer rather than a string\n\n```suggestion\n  replicas: 3\n```"),
+				},
+				{
+					Path:     github.String("deployment.yaml"),
+					Position: github.Int(13),
+					Body:     github.String("imagepullpolicy isn't a valid field; did you mean imagePullPolicy?\n\n```suggestion\n        imagePullPolicy: Always\n```"),
+				},
+			},
+		},
+		{
+			"deprecated-rbac",
+			&KubeValidatorConfigSchema{Version: "1.22.0", IgnoreMissingSchemas: true},
+			[]*github.DraftReviewComment{
+				{
+					Path:     github.String("deprecated-rbac.yaml"),
+					Position: github.Int(1),
+					Body:     github.String("rbac.authorization.k8s.io/v1beta1 ClusterRole is removed in 1.22; use rbac.authorization.k8s.io/v1, available since 1.8\n\n```suggestion\napiVersion: rbac.authorization.k8s.io/v1\n```"),
+				},
+			},
+		},
+		// apps/v1 Deployments require a selector, so changing the
+		// apiVersion alone wouldn't fix them
+		{
+			"deprecated",
+			&KubeValidatorConfigSchema{Version: "1.16.0", IgnoreMissingSchemas: true},
+			nil,
+		},
+	}
+
+	for _, test := range tests {
+		patch, _ := ioutil.ReadFile(filepath.Join("../fixtures/review", test.file+".patch"))
+		var schemas []*KubeValidatorConfigSchema
+		if test.schema != nil {
+			schemas = append(schemas, test.schema)
+		}
+		candidate := NewCandidate(
+			&Context{
+				Event:     &github.CheckSuiteEvent{},
+				SchemaDir: schemaDir,
+			}, &github.CommitFile{
+				Filename: github.String(test.file + ".yaml"),
+			}, schemas)
+
+		fileContents, _ := ioutil.ReadFile(filepath.Join("../fixtures/review", test.file+".yaml"))
+		candidate.setBytes(&fileContents)
+		candidate.Validate()
+
+		if diff := deep.Equal(candidate.reviewComments(string(patch)), test.want); diff != nil {
+			t.Errorf("%s: %v", test.file, diff)
+		}
+	}
+}
+
+func TestCreateReviews(t *testing.T) {
+	client, mux, _, teardown := setup()
+	defer teardown()
+	ctx := context.Background()
+	e := &github.CheckSuiteEvent{
+		CheckSuite: &github.CheckSuite{
+			HeadSHA:      github.String("abc"),
+			PullRequests: []*github.PullRequest{{Number: github.Int(1)}, {Number: github.Int(2)}},
+		},
+		Repo: &github.Repository{
+			Owner: &github.User{Login: github.String("o")},
+			Name:  github.String("r"),
+		},
+	}
+	c := &Context{
+		Ctx:    &ctx,
+		Event:  e,
+		Github: client,
+	}
+
+	fileContents := []byte("apiVersion: apps/v1\n")
+	candidate := NewCandidate(c, &github.CommitFile{Filename: github.String("a.yaml")}, nil)
+	candidate.setBytes(&fileContents)
+	candidate.fixes = []fix{
+		{Line: 1, StartColumn: 13, EndColumn: 19, Replacement: "apps/v2", Reason: "first"},
+	}
+	other := NewCandidate(c, &github.CommitFile{Filename: github.String("b.yaml")}, nil)
+	other.setBytes(&fileContents)
+	other.fixes = []fix{
+		{Line: 1, StartColumn: 13, EndColumn: 19, Replacement: "apps/v2", Reason: "second"},
+	}
+
+	// The second pull request changes b.yaml differently, so its first line
+	// is at a different position in that pull request's patch
+	mux.HandleFunc("/repos/o/r/pulls/1/files", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		fmt.Fprint(w, `[{"filename": "a.yaml", "patch": "@@ -0,0 +1 @@\n+apiVersion: apps/v1"}, {"filename": "b.yaml", "patch": "@@ -0,0 +1 @@\n+apiVersion: apps/v1"}]`)
+	})
+	mux.HandleFunc("/repos/o/r/pulls/2/files", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		fmt.Fprint(w, `[{"filename": "b.yaml", "patch": "@@ -1 +1 @@\n-apiVersion: apps/v0\n+apiVersion: apps/v1"}]`)
+	})
+	mux.HandleFunc("/repos/o/r/pulls/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		if r.URL.Query().Get("page") != "2" {
+			w.Header().Set("Link", `<https://api.github.com/repos/o/r/pulls/1/comments?page=2>; rel="next"`)
+			fmt.Fprint(w, `[]`)
+			return
+		}
+		fmt.Fprint(w, `[{"path": "a.yaml", "position": 1, "body": "first\n\n`+"```suggestion\\napiVersion: apps/v2\\n```"+`"}]`)
+	})
+	mux.HandleFunc("/repos/o/r/pulls/2/comments", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		fmt.Fprint(w, `[]`)
+	})
+
+	reviews := make(map[string]*github.PullRequestReviewRequest)
+	for _, number := range []string{"1", "2"} {
+		number := number
+		mux.HandleFunc("/repos/o/r/pulls/"+number+"/reviews", func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+			review := &github.PullRequestReviewRequest{}
+			json.NewDecoder(r.Body).Decode(review)
+			reviews[number] = review
+			fmt.Fprint(w, `{}`)
+		})
+	}
+
+	if err := c.createReviews(e, Candidates{candidate, other}); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]*github.PullRequestReviewRequest{
+		"1": {
+			CommitID: github.String("abc"),
+			Body:     github.String("kubevalidator found 1 fix it can make for you."),
+			Event:    github.String("COMMENT"),
+			Comments: []*github.DraftReviewComment{{
+				Path:     github.String("b.yaml"),
+				Position: github.Int(1),
+				Body:     github.String("second\n\n```suggestion\napiVersion: apps/v2\n```"),
+			}},
+		},
+		"2": {
+			CommitID: github.String("abc"),
+			Body:     github.String("kubevalidator found 1 fix it can make for you."),
+			Event:    github.String("COMMENT"),
+			Comments: []*github.DraftReviewComment{{
+				Path:     github.String("b.yaml"),
+				Position: github.Int(2),
+				Body:     github.String("second\n\n```suggestion\napiVersion: apps/v2\n```"),
+			}},
+		},
+	}
+	if diff := deep.Equal(reviews, want); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestHunkRanges(t *testing.T) {
+	patch := "@@ -1,3 +1,5 @@\n a\n+b\n+c\n d\n e\n@@ -10,2 +12,3 @@\n-f\n+g\n h\n+i\n\\ No newline at end of file\n@@ -20,2 +23,0 @@\n-j\n-k"
+	want := []lineRange{{Start: 2, End: 3}, {Start: 12, End: 12}, {Start: 14, End: 14}}
+	if diff := deep.Equal(hunkRanges(patch), want); diff != nil {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,438 @@
+package validator
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/github"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ruleOperators maps each operator to a description of what it requires
+var ruleOperators = map[string]string{
+	"exists":      "must be set",
+	"not-exists":  "must not be set",
+	"equals":      "must equal %v",
+	"not-equals":  "must not equal %v",
+	"matches":     "must match %v",
+	"not-matches": "must not match %v",
+	"in":          "must be one of %v",
+	"not-in":      "must not be one of %v",
+	"gt":          "must be greater than %v",
+	"gte":         "must be greater than or equal to %v",
+	"lt":          "must be less than %v",
+	"lte":         "must be less than or equal to %v",
+}
+
+// pathSegment is a single step of a rule's path
+type pathSegment struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// pathMatch is a value found by following a rule's path through a resource.
+// When the path can't be followed, found is false and segments points at the
+// deepest value that was found.
+type pathMatch struct {
+	segments []string
+	value    interface{}
+	found    bool
+}
+
+var pathSegmentRe = regexp.MustCompile(`^(?:\.?([^.\[\]]+)|\[(\*|\d+)\]|\['([^']*)'\]|\["([^"]*)"\])`)
+
+// parseRulePath parses paths like spec.template.spec.containers[*].image or
+// metadata.annotations['example.com/owner']
+func parseRulePath(path string) ([]pathSegment, error) {
+	var segments []pathSegment
+	remaining := strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if remaining == "" {
+		return nil, fmt.Errorf("path is empty")
+	}
+	for remaining != "" {
+		match := pathSegmentRe.FindStringSubmatch(remaining)
+		if match == nil {
+			return nil, fmt.Errorf("couldn't parse %s at %s", path, remaining)
+		}
+		remaining = remaining[len(match[0]):]
+		switch {
+		case match[1] == "*" || match[2] == "*":
+			segments = append(segments, pathSegment{wildcard: true})
+		case match[1] != "":
+			segments = append(segments, pathSegment{key: match[1]})
+		case match[2] != "":
+			index, _ := strconv.Atoi(match[2])
+			segments = append(segments, pathSegment{index: index, isIndex: true})
+		case match[3] != "":
+			segments = append(segments, pathSegment{key: match[3]})
+		default:
+			segments = append(segments, pathSegment{key: match[4]})
+		}
+	}
+	return segments, nil
+}
+
+// resolvePath follows segments through value, returning a match for each of
+// the values found. Wildcards expand to every item of a list or map.
+func resolvePath(value interface{}, segments []pathSegment, concrete []string) []pathMatch {
+	if len(segments) == 0 {
+		return []pathMatch{{segments: concrete, value: value, found: true}}
+	}
+	missing := []pathMatch{{segments: concrete}}
+	segment := segments[0]
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if segment.wildcard {
+			var keys []string
+			for key := range v {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			var matches []pathMatch
+			for _, key := range keys {
+				matches = append(matches, resolvePath(v[key], segments[1:], appendSegment(concrete, key))...)
+			}
+			return matches
+		}
+		child, ok := v[segment.key]
+		if segment.isIndex || !ok {
+			return missing
+		}
+		return resolvePath(child, segments[1:], appendSegment(concrete, segment.key))
+	case []interface{}:
+		if segment.wildcard {
+			var matches []pathMatch
+			for i, item := range v {
+				matches = append(matches, resolvePath(item, segments[1:], appendSegment(concrete, strconv.Itoa(i)))...)
+			}
+			return matches
+		}
+		if !segment.isIndex || segment.index >= len(v) {
+			return missing
+		}
+		return resolvePath(v[segment.index], segments[1:], appendSegment(concrete, strconv.Itoa(segment.index)))
+	}
+	return missing
+}
+
+func appendSegment(segments []string, segment string) []string {
+	appended := make([]string, len(segments), len(segments)+1)
+	copy(appended, segments)
+	return append(appended, segment)
+}
+
+// pointer returns the JSON pointer to a match
+func (m pathMatch) pointer() string {
+	var buffer strings.Builder
+	escaper := strings.NewReplacer("~", "~0", "/", "~1")
+	for _, segment := range m.segments {
+		buffer.WriteString("/")
+		buffer.WriteString(escaper.Replace(segment))
+	}
+	return buffer.String()
+}
+
+// String returns the path to a match
+func (m pathMatch) String() string {
+	var buffer strings.Builder
+	for _, segment := range m.segments {
+		if _, err := strconv.Atoi(segment); err == nil {
+			buffer.WriteString(fmt.Sprintf("[%s]", segment))
+		} else if strings.ContainsAny(segment, ".[]") {
+			buffer.WriteString(fmt.Sprintf("['%s']", segment))
+		} else {
+			if buffer.Len() > 0 {
+				buffer.WriteString(".")
+			}
+			buffer.WriteString(segment)
+		}
+	}
+	return buffer.String()
+}
+
+// valid returns a boolean indicating whether or not the rule is well formed
+func (rule *KubeValidatorConfigRule) valid() bool {
+	if _, err := parseRulePath(rule.Path); err != nil {
+		return false
+	}
+	if _, ok := ruleOperators[rule.Operator]; !ok {
+		return false
+	}
+	switch rule.Severity {
+	case "", "notice", "warning", "failure":
+	default:
+		return false
+	}
+	switch rule.Operator {
+	case "matches", "not-matches":
+		pattern, ok := rule.Value.(string)
+		if !ok {
+			return false
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return false
+		}
+	case "in", "not-in":
+		if len(rule.Values) == 0 {
+			return false
+		}
+	case "gt", "gte", "lt", "lte":
+		if _, ok := toFloat(rule.Value); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// displayName returns the name used to refer to a rule in check runs
+func (rule *KubeValidatorConfigRule) displayName() string {
+	if rule.Name != "" {
+		return rule.Name
+	}
+	return fmt.Sprintf("%s %s", rule.Path, rule.Operator)
+}
+
+// severity returns the level of the annotations created for violations
+func (rule *KubeValidatorConfigRule) severity() string {
+	if rule.Severity == "" {
+		return "failure"
+	}
+	return rule.Severity
+}
+
+// message returns the configured message or describes what the rule requires
+func (rule *KubeValidatorConfigRule) message(match pathMatch) string {
+	if rule.Message != "" {
+		return rule.Message
+	}
+	description := ruleOperators[rule.Operator]
+	if strings.Contains(description, "%v") {
+		if rule.Operator == "in" || rule.Operator == "not-in" {
+			description = fmt.Sprintf(description, rule.Values)
+		} else {
+			description = fmt.Sprintf(description, rule.Value)
+		}
+	}
+	path := rule.Path
+	if match.found {
+		path = match.String()
+	}
+	return fmt.Sprintf("%s %s", path, description)
+}
+
+// selects determines whether or not the rule applies to a resource
+func (rule *KubeValidatorConfigRule) selects(body map[string]interface{}) bool {
+	if len(rule.Kinds) > 0 {
+		kind, _ := body["kind"].(string)
+		selected := false
+		for _, k := range rule.Kinds {
+			if k == kind {
+				selected = true
+				break
+			}
+		}
+		if !selected {
+			return false
+		}
+	}
+	if len(rule.Selector) > 0 {
+		metadata, _ := body["metadata"].(map[string]interface{})
+		labels, _ := metadata["labels"].(map[string]interface{})
+		for key, value := range rule.Selector {
+			if label, ok := labels[key]; !ok || fmt.Sprintf("%v", label) != value {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// satisfiedBy determines whether or not a value found at the rule's path
+// satisfies it. Negative operators are satisfied by missing values.
+func (rule *KubeValidatorConfigRule) satisfiedBy(match pathMatch) bool {
+	switch rule.Operator {
+	case "exists":
+		return match.found
+	case "not-exists":
+		return !match.found
+	case "not-equals", "not-matches", "not-in":
+		if !match.found {
+			return true
+		}
+	default:
+		if !match.found {
+			return false
+		}
+	}
+
+	switch rule.Operator {
+	case "equals":
+		return valuesEqual(match.value, rule.Value)
+	case "not-equals":
+		return !valuesEqual(match.value, rule.Value)
+	case "matches", "not-matches":
+		pattern, _ := rule.Value.(string)
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return false
+		}
+		return re.MatchString(fmt.Sprintf("%v", match.value)) == (rule.Operator == "matches")
+	case "in", "not-in":
+		in := false
+		for _, value := range rule.Values {
+			if valuesEqual(match.value, value) {
+				in = true
+				break
+			}
+		}
+		return in == (rule.Operator == "in")
+	}
+
+	actual, ok := toFloat(match.value)
+	expected, _ := toFloat(rule.Value)
+	if !ok {
+		return false
+	}
+	switch rule.Operator {
+	case "gt":
+		return actual > expected
+	case "gte":
+		return actual >= expected
+	case "lt":
+		return actual < expected
+	case "lte":
+		return actual <= expected
+	}
+	return false
+}
+
+// valuesEqual compares values from YAML, treating numbers of different types
+// as equal when they have the same value
+func valuesEqual(a interface{}, b interface{}) bool {
+	aFloat, aOK := toFloat(a)
+	bFloat, bOK := toFloat(b)
+	if aOK && bOK {
+		return aFloat == bFloat
+	}
+	return fmt.Sprintf("%v", a) == fmt.Sprintf("%v", b)
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// EvaluateRules returns an annotation for each value in the candidate's
+// resources that doesn't satisfy one of rules
+func (c *Candidate) EvaluateRules(rules []*KubeValidatorConfigRule) Annotations {
+	var annotations Annotations
+	if c.bytes == nil || len(rules) == 0 {
+		return annotations
+	}
+
+	startLines := documentStartLines(*c.bytes)
+	for i, raw := range splitDocuments(*c.bytes) {
+		var spec interface{}
+		// Documents that can't be parsed are reported by validation
+		if err := yaml.Unmarshal(raw, &spec); err != nil {
+			continue
+		}
+		document, ok := convertToStringKeys(spec).(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, item := range expandList(document) {
+			annotations = append(annotations, c.evaluateRulesForResource(rules, raw, startLines[i], item)...)
+		}
+	}
+	c.rendered.mapAnnotations(annotations)
+	return annotations
+}
+
+// docsURL links to the documentation of the field found at path in a
+// resource, using the Candidate's first schema to choose the doc set
+func (c *Candidate) docsURL(body map[string]interface{}, path []string) string {
+	if len(c.schemas) == 0 {
+		return ""
+	}
+	apiVersion, _ := body["apiVersion"].(string)
+	kind, _ := body["kind"].(string)
+	return c.docs(c.schemas[0]).URL(apiVersion, kind, path)
+}
+
+// evaluateRulesForResource evaluates rules against a single resource found in
+// raw, a document starting on startLine
+func (c *Candidate) evaluateRulesForResource(rules []*KubeValidatorConfigRule, raw []byte, startLine int, item listItem) Annotations {
+	var annotations Annotations
+	body := item.body
+	kind, _ := body["kind"].(string)
+	resource := kind
+	if metadata, ok := body["metadata"].(map[string]interface{}); ok {
+		if name, ok := metadata["name"].(string); ok && name != "" {
+			resource = fmt.Sprintf("%s %s", resource, name)
+		}
+	}
+
+	for _, rule := range rules {
+		segments, err := parseRulePath(rule.Path)
+		if err != nil || !rule.selects(body) {
+			continue
+		}
+		// A rule's own severity takes precedence over that of the kind
+		levelKind := kind
+		if rule.Severity != "" {
+			levelKind = ""
+		}
+		for _, match := range resolvePath(body, segments, nil) {
+			if rule.satisfiedBy(match) {
+				continue
+			}
+
+			matchStartLine, matchEndLine := startLine, startLine
+			if pointer := item.pointer + match.pointer(); pointer != "" {
+				matchStartLine, matchEndLine = detectLineNumbersForPath(&raw, pointer)
+				matchStartLine += startLine - 1
+				matchEndLine += startLine - 1
+			}
+
+			var details strings.Builder
+			details.WriteString(fmt.Sprintf("* rule: %s\n", rule.displayName()))
+			if match.found {
+				details.WriteString(fmt.Sprintf("* path: %s\n", match))
+				details.WriteString(fmt.Sprintf("* value: %v\n", match.value))
+			} else {
+				details.WriteString(fmt.Sprintf("* path: %s\n", rule.Path))
+			}
+
+			annotations = append(annotations, &github.CheckRunAnnotation{
+				Path:            c.file.Filename,
+				BlobHRef:        c.file.BlobURL,
+				StartLine:       github.Int(matchStartLine),
+				EndLine:         github.Int(matchEndLine),
+				AnnotationLevel: github.String(c.level("", rule.Name, levelKind, rule.severity())),
+				Title:           github.String(fmt.Sprintf("%s doesn't satisfy rule %s", resource, rule.displayName())),
+				Message:         github.String(withDocsLink(rule.message(match), c.docsURL(body, pointerSegments(match.pointer())))),
+				RawDetails:      github.String(details.String()),
+			})
+		}
+	}
+	return annotations
+}
@@ -0,0 +1,191 @@
+package validator
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/google/go-github/github"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestParseRulePath(t *testing.T) {
+	tests := []struct {
+		path string
+		want []pathSegment
+	}{
+		{"spec.replicas", []pathSegment{{key: "spec"}, {key: "replicas"}}},
+		{"$.spec.containers[*].image", []pathSegment{{key: "spec"}, {key: "containers"}, {wildcard: true}, {key: "image"}}},
+		{".spec.containers[1]", []pathSegment{{key: "spec"}, {key: "containers"}, {index: 1, isIndex: true}}},
+		{"metadata.annotations['example.com/owner']", []pathSegment{{key: "metadata"}, {key: "annotations"}, {key: "example.com/owner"}}},
+		{"metadata.labels.*", []pathSegment{{key: "metadata"}, {key: "labels"}, {wildcard: true}}},
+	}
+	for _, test := range tests {
+		segments, err := parseRulePath(test.path)
+		if err != nil {
+			t.Errorf("couldn't parse %s: %v", test.path, err)
+			continue
+		}
+		if diff := deep.Equal(segments, test.want); diff != nil {
+			t.Errorf("%s: %v", test.path, diff)
+		}
+	}
+
+	for _, path := range []string{"", "spec..replicas", "spec.containers[x]"} {
+		if _, err := parseRulePath(path); err == nil {
+			t.Errorf("expected %q to be invalid", path)
+		}
+	}
+}
+
+func TestRuleSatisfiedBy(t *testing.T) {
+	tests := []struct {
+		rule  KubeValidatorConfigRule
+		match pathMatch
+		want  bool
+	}{
+		{KubeValidatorConfigRule{Operator: "exists"}, pathMatch{found: true}, true},
+		{KubeValidatorConfigRule{Operator: "exists"}, pathMatch{}, false},
+		{KubeValidatorConfigRule{Operator: "not-exists"}, pathMatch{}, true},
+		{KubeValidatorConfigRule{Operator: "equals", Value: 3}, pathMatch{value: 3.0, found: true}, true},
+		{KubeValidatorConfigRule{Operator: "equals", Value: "a"}, pathMatch{value: "b", found: true}, false},
+		{KubeValidatorConfigRule{Operator: "not-equals", Value: "a"}, pathMatch{}, true},
+		{KubeValidatorConfigRule{Operator: "matches", Value: "^nginx:"}, pathMatch{value: "nginx:1.15", found: true}, true},
+		{KubeValidatorConfigRule{Operator: "not-matches", Value: ":latest$"}, pathMatch{value: "nginx:latest", found: true}, false},
+		{KubeValidatorConfigRule{Operator: "in", Values: []interface{}{"a", "b"}}, pathMatch{value: "b", found: true}, true},
+		{KubeValidatorConfigRule{Operator: "in", Values: []interface{}{"a", "b"}}, pathMatch{}, false},
+		{KubeValidatorConfigRule{Operator: "not-in", Values: []interface{}{"a", "b"}}, pathMatch{value: "c", found: true}, true},
+		{KubeValidatorConfigRule{Operator: "gt", Value: 1}, pathMatch{value: 2, found: true}, true},
+		{KubeValidatorConfigRule{Operator: "gte", Value: 2}, pathMatch{value: 2, found: true}, true},
+		{KubeValidatorConfigRule{Operator: "lt", Value: 2}, pathMatch{value: 2, found: true}, false},
+		{KubeValidatorConfigRule{Operator: "lte", Value: 2}, pathMatch{value: "asdf", found: true}, false},
+	}
+	for _, test := range tests {
+		if got := test.rule.satisfiedBy(test.match); got != test.want {
+			t.Errorf("%s %v against %+v: expected %v, got %v", test.rule.Operator, test.rule.Value, test.match, test.want, got)
+		}
+	}
+}
+
+func TestInvalidRules(t *testing.T) {
+	rules := []*KubeValidatorConfigRule{
+		{Path: "spec.replicas", Operator: "bigger"},
+		{Path: "spec[", Operator: "exists"},
+		{Path: "spec.replicas", Operator: "exists", Severity: "fatal"},
+		{Path: "spec.replicas", Operator: "matches", Value: "("},
+		{Path: "spec.replicas", Operator: "in"},
+		{Path: "spec.replicas", Operator: "gt", Value: "many"},
+	}
+	for _, rule := range rules {
+		config := &KubeValidatorConfig{
+			Spec: &KubeValidatorConfigSpec{
+				Rules: []*KubeValidatorConfigRule{rule},
+			},
+		}
+		if config.Valid() {
+			t.Errorf("expected rule to be invalid: %+v", rule)
+		}
+	}
+}
+
+func TestAnnotationsForRules(t *testing.T) {
+	configContents, _ := ioutil.ReadFile("../fixtures/rules/kubevalidator.yaml")
+	config := &KubeValidatorConfig{}
+	if err := yaml.Unmarshal(configContents, config); err != nil {
+		t.Fatal(err)
+	}
+	if !config.Valid() {
+		t.Fatalf("Config expected to be valid: %+v", config)
+	}
+
+	candidate := NewCandidate(
+		&Context{
+			Event: &github.CheckSuiteEvent{},
+		}, &github.CommitFile{
+			Filename: github.String("deployment.yaml"),
+		}, nil)
+	fileContents, _ := ioutil.ReadFile("../fixtures/rules/deployment.yaml")
+	candidate.setBytes(&fileContents)
+	annotations := candidate.EvaluateRules(config.rules())
+
+	want := Annotations{
+		{
+			Path:            github.String("deployment.yaml"),
+			StartLine:       github.Int(23),
+			EndLine:         github.Int(24),
+			AnnotationLevel: github.String("failure"),
+			Title:           github.String("Deployment frontend doesn't satisfy rule memory-limits"),
+			Message:         github.String("Containers must set a memory limit; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.32/#container-v1-core for more details"),
+			RawDetails:      github.String("* rule: memory-limits\n* path: spec.template.spec.containers[*].resources.limits.memory\n"),
+		},
+		{
+			Path:            github.String("deployment.yaml"),
+			StartLine:       github.Int(19),
+			EndLine:         github.Int(19),
+			AnnotationLevel: github.String("warning"),
+			Title:           github.String("Deployment frontend doesn't satisfy rule no-latest"),
+			Message:         github.String("spec.template.spec.containers[0].image must not match :latest$; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.32/#container-v1-core for more details"),
+			RawDetails:      github.String("* rule: no-latest\n* path: spec.template.spec.containers[0].image\n* value: nginx:latest\n"),
+		},
+		{
+			Path:            github.String("deployment.yaml"),
+			StartLine:       github.Int(8),
+			EndLine:         github.Int(8),
+			AnnotationLevel: github.String("failure"),
+			Title:           github.String("Deployment frontend doesn't satisfy rule replicas"),
+			Message:         github.String("spec.replicas must be greater than or equal to 2; see https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.32/#deploymentspec-v1-apps for more details"),
+			RawDetails:      github.String("* rule: replicas\n* path: spec.replicas\n* value: 1\n"),
+		},
+	}
+	if diff := deep.Equal(annotations, want); diff != nil {
+		t.Errorf("%s", github.Stringify(annotations))
+		t.Error(diff)
+	}
+}
+
+func TestRuleSeverityTakesPrecedenceOverKinds(t *testing.T) {
+	configContents, _ := ioutil.ReadFile("../fixtures/rules/kubevalidator.yaml")
+	config := &KubeValidatorConfig{}
+	if err := yaml.Unmarshal(configContents, config); err != nil {
+		t.Fatal(err)
+	}
+
+	context := &Context{
+		Event:    &github.CheckSuiteEvent{},
+		severity: &KubeValidatorConfigSeverity{Kinds: map[string]string{"Deployment": "notice"}},
+	}
+	var candidates Candidates
+	// The same file matched by two manifests
+	for i := 0; i < 2; i++ {
+		candidate := NewCandidate(context, &github.CommitFile{
+			Filename: github.String("deployment.yaml"),
+		}, nil)
+		fileContents, _ := ioutil.ReadFile("../fixtures/rules/deployment.yaml")
+		candidate.setBytes(&fileContents)
+		candidates = append(candidates, candidate)
+	}
+
+	levels := make(map[string]string)
+	annotations := candidates.EvaluateRules(config.rules())
+	for _, annotation := range annotations {
+		levels[annotation.GetTitle()] = annotation.GetAnnotationLevel()
+	}
+	want := map[string]string{
+		"Deployment frontend doesn't satisfy rule memory-limits": "notice",
+		"Deployment frontend doesn't satisfy rule no-latest":     "warning",
+		"Deployment frontend doesn't satisfy rule replicas":      "notice",
+	}
+	if diff := deep.Equal(levels, want); diff != nil {
+		t.Error(diff)
+	}
+	if len(annotations) != 3 {
+		t.Errorf("expected 3 annotations, got %d: %s", len(annotations), github.Stringify(annotations))
+	}
+}
+
+func TestDocumentStartLines(t *testing.T) {
+	fileContents, _ := ioutil.ReadFile("../fixtures/rules/deployment.yaml")
+	if diff := deep.Equal(documentStartLines(fileContents), []int{1, 26}); diff != nil {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,269 @@
+package validator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	schemaCacheSuffix     = ".json"
+	schemaCacheMetaSuffix = ".meta"
+)
+
+// SchemaCache keeps schemas fetched over the network on local disk so that
+// each schema is fetched at most once per TTL no matter how many documents are
+// validated against it.
+type SchemaCache struct {
+	// Dir is where cached schemas are stored
+	Dir string
+	// TTL is how long a cached schema is used before it's fetched again. Zero
+	// means cached schemas never expire.
+	TTL time.Duration
+	// MaxBytes bounds the size of Dir. The least recently used schemas are
+	// evicted first. Zero means unbounded.
+	MaxBytes int64
+	// Transport is used to fetch schemas that aren't cached. Defaults to
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+
+	mu      sync.Mutex
+	pending map[string]*pendingSchema
+}
+
+// pendingSchema serializes the Gets of a single schema. It's forgotten once
+// none are waiting for it.
+type pendingSchema struct {
+	sync.Mutex
+	waiters int
+}
+
+// schemaCacheEntry is stored alongside each cached schema
+type schemaCacheEntry struct {
+	URL       string    `json:"url"`
+	FetchedAt time.Time `json:"fetchedAt"`
+	SHA256    string    `json:"sha256"`
+}
+
+// NewSchemaCache initializes a SchemaCache, creating dir if necessary
+func NewSchemaCache(dir string, ttl time.Duration, maxBytes int64) (*SchemaCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Couldn't create schema cache in %s", dir))
+	}
+	return &SchemaCache{
+		Dir:      dir,
+		TTL:      ttl,
+		MaxBytes: maxBytes,
+	}, nil
+}
+
+// Get returns the schema at url, fetching it only if it isn't cached, has
+// expired, or fails checksum verification
+func (sc *SchemaCache) Get(url string) ([]byte, error) {
+	key := schemaCacheKey(url)
+	pending := sc.lockFor(key)
+	defer sc.unlock(key, pending)
+
+	cached, entry, err := sc.read(key)
+	if err == nil && !sc.expired(entry) {
+		return cached, nil
+	}
+
+	b, fetchErr := fetchSchema(sc.transport(), url)
+	if fetchErr != nil {
+		// Prefer a stale schema to no schema at all
+		if err == nil {
+			return cached, nil
+		}
+		return nil, fetchErr
+	}
+
+	if err := sc.write(key, url, b); err != nil {
+		return nil, err
+	}
+	sc.evict()
+	return b, nil
+}
+
+// schemaStatusError is returned when a schema can't be fetched because of an
+// unexpected HTTP status
+type schemaStatusError struct {
+	Status     string
+	StatusCode int
+}
+
+func (e *schemaStatusError) Error() string {
+	return fmt.Sprintf("Could not read schema from HTTP, response status is %s", e.Status)
+}
+
+// lockFor waits until no other Get is using the schema with key
+func (sc *SchemaCache) lockFor(key string) *pendingSchema {
+	sc.mu.Lock()
+	if sc.pending == nil {
+		sc.pending = make(map[string]*pendingSchema)
+	}
+	pending, ok := sc.pending[key]
+	if !ok {
+		pending = &pendingSchema{}
+		sc.pending[key] = pending
+	}
+	pending.waiters++
+	sc.mu.Unlock()
+
+	pending.Lock()
+	return pending
+}
+
+// unlock releases the schema with key, forgetting it if no other Gets are
+// waiting for it
+func (sc *SchemaCache) unlock(key string, pending *pendingSchema) {
+	pending.Unlock()
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	pending.waiters--
+	if pending.waiters == 0 {
+		delete(sc.pending, key)
+	}
+}
+
+func (sc *SchemaCache) transport() http.RoundTripper {
+	if sc.Transport != nil {
+		return sc.Transport
+	}
+	return http.DefaultTransport
+}
+
+func (sc *SchemaCache) expired(entry *schemaCacheEntry) bool {
+	if sc.TTL == 0 {
+		return false
+	}
+	return time.Since(entry.FetchedAt) > sc.TTL
+}
+
+// read returns a cached schema after verifying its checksum
+func (sc *SchemaCache) read(key string) ([]byte, *schemaCacheEntry, error) {
+	metaBytes, err := ioutil.ReadFile(sc.path(key, schemaCacheMetaSuffix))
+	if err != nil {
+		return nil, nil, err
+	}
+	entry := &schemaCacheEntry{}
+	if err := json.Unmarshal(metaBytes, entry); err != nil {
+		return nil, nil, err
+	}
+
+	b, err := ioutil.ReadFile(sc.path(key, schemaCacheSuffix))
+	if err != nil {
+		return nil, nil, err
+	}
+	if checksum(b) != entry.SHA256 {
+		sc.remove(key)
+		return nil, nil, fmt.Errorf("Checksum mismatch for cached schema %s", entry.URL)
+	}
+
+	// Keep track of use for eviction
+	now := time.Now()
+	os.Chtimes(sc.path(key, schemaCacheSuffix), now, now)
+	return b, entry, nil
+}
+
+func (sc *SchemaCache) write(key string, url string, b []byte) error {
+	metaBytes, err := json.Marshal(&schemaCacheEntry{
+		URL:       url,
+		FetchedAt: time.Now(),
+		SHA256:    checksum(b),
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomically(sc.path(key, schemaCacheSuffix), b); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Couldn't cache %s", url))
+	}
+	if err := writeFileAtomically(sc.path(key, schemaCacheMetaSuffix), metaBytes); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Couldn't cache %s", url))
+	}
+	return nil
+}
+
+func (sc *SchemaCache) remove(key string) {
+	os.Remove(sc.path(key, schemaCacheSuffix))
+	os.Remove(sc.path(key, schemaCacheMetaSuffix))
+}
+
+// evict removes the least recently used schemas until the cache fits within
+// MaxBytes. Schemas which other Gets are using are left alone so that they
+// aren't removed while being read.
+func (sc *SchemaCache) evict() {
+	if sc.MaxBytes <= 0 {
+		return
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	files, err := ioutil.ReadDir(sc.Dir)
+	if err != nil {
+		return
+	}
+	var schemas []os.FileInfo
+	var total int64
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), schemaCacheSuffix) {
+			schemas = append(schemas, file)
+			total += file.Size()
+		}
+	}
+	sort.Slice(schemas, func(i, j int) bool {
+		return schemas[i].ModTime().Before(schemas[j].ModTime())
+	})
+	for _, file := range schemas {
+		if total <= sc.MaxBytes {
+			return
+		}
+		key := strings.TrimSuffix(file.Name(), schemaCacheSuffix)
+		if _, ok := sc.pending[key]; ok {
+			continue
+		}
+		sc.remove(key)
+		total -= file.Size()
+	}
+}
+
+func (sc *SchemaCache) path(key string, suffix string) string {
+	return filepath.Join(sc.Dir, key+suffix)
+}
+
+func schemaCacheKey(url string) string {
+	return checksum([]byte(url))
+}
+
+func checksum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func writeFileAtomically(path string, b []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
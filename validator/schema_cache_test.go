@@ -0,0 +1,196 @@
+package validator
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestSchemaServer(t *testing.T) (*httptest.Server, *int) {
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if strings.HasSuffix(r.URL.Path, "missing.json") {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"description": "%s"}`, r.URL.Path)
+	}))
+	return server, &hits
+}
+
+func newTestSchemaCache(t *testing.T, ttl time.Duration, maxBytes int64) (*SchemaCache, func()) {
+	dir, err := ioutil.TempDir("", "kubevalidator-schema-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache, err := NewSchemaCache(dir, ttl, maxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cache, func() { os.RemoveAll(dir) }
+}
+
+func TestSchemaCacheFetchesEachSchemaOnce(t *testing.T) {
+	server, hits := newTestSchemaServer(t)
+	defer server.Close()
+	cache, teardown := newTestSchemaCache(t, time.Hour, 0)
+	defer teardown()
+
+	for i := 0; i < 40; i++ {
+		for _, version := range []string{"v1.12.0", "v1.13.0", "v1.14.0"} {
+			b, err := cache.Get(fmt.Sprintf("%s/%s-standalone-strict/deployment-apps-v1.json", server.URL, version))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(b), version) {
+				t.Errorf("unexpected schema %s", b)
+			}
+		}
+	}
+
+	if *hits != 3 {
+		t.Errorf("expected 3 requests, got %d", *hits)
+	}
+}
+
+func TestSchemaCacheExpiresSchemas(t *testing.T) {
+	server, hits := newTestSchemaServer(t)
+	defer server.Close()
+	cache, teardown := newTestSchemaCache(t, time.Nanosecond, 0)
+	defer teardown()
+
+	for i := 0; i < 2; i++ {
+		_, err := cache.Get(server.URL + "/deployment.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if *hits != 2 {
+		t.Errorf("expected 2 requests, got %d", *hits)
+	}
+}
+
+func TestSchemaCacheVerifiesChecksums(t *testing.T) {
+	server, hits := newTestSchemaServer(t)
+	defer server.Close()
+	cache, teardown := newTestSchemaCache(t, time.Hour, 0)
+	defer teardown()
+
+	url := server.URL + "/deployment.json"
+	_, err := cache.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ioutil.WriteFile(cache.path(schemaCacheKey(url), schemaCacheSuffix), []byte(`{"tampered": true}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := cache.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "tampered") {
+		t.Errorf("tampered schema was returned: %s", b)
+	}
+	if *hits != 2 {
+		t.Errorf("expected 2 requests, got %d", *hits)
+	}
+}
+
+func TestSchemaCacheEvictsLeastRecentlyUsedSchemas(t *testing.T) {
+	server, _ := newTestSchemaServer(t)
+	defer server.Close()
+	cache, teardown := newTestSchemaCache(t, time.Hour, 100)
+	defer teardown()
+
+	for _, name := range []string{"one", "two", "three", "four"} {
+		_, err := cache.Get(fmt.Sprintf("%s/%s.json", server.URL, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(cache.Dir, "*"+schemaCacheSuffix))
+	if len(matches) != 3 {
+		t.Errorf("expected 3 cached schemas, got %d", len(matches))
+	}
+	if _, err := os.Stat(cache.path(schemaCacheKey(server.URL+"/one.json"), schemaCacheSuffix)); !os.IsNotExist(err) {
+		t.Errorf("expected the least recently used schema to be evicted")
+	}
+}
+
+func TestSchemaCacheDoesntEvictSchemasBeingRead(t *testing.T) {
+	server, _ := newTestSchemaServer(t)
+	defer server.Close()
+	cache, teardown := newTestSchemaCache(t, time.Hour, 10)
+	defer teardown()
+
+	url := server.URL + "/one.json"
+	key := schemaCacheKey(url)
+	if err := cache.write(key, url, []byte(`{"description": "/one.json"}`)); err != nil {
+		t.Fatal(err)
+	}
+	pending := cache.lockFor(key)
+	cache.evict()
+	if _, _, err := cache.read(key); err != nil {
+		t.Errorf("expected a schema being read not to be evicted, got %v", err)
+	}
+	cache.unlock(key, pending)
+	cache.evict()
+	if _, _, err := cache.read(key); err == nil {
+		t.Error("expected the schema to be evicted once it isn't being read")
+	}
+}
+
+func TestSchemaCacheForgetsFinishedGets(t *testing.T) {
+	server, _ := newTestSchemaServer(t)
+	defer server.Close()
+	cache, teardown := newTestSchemaCache(t, time.Hour, 0)
+	defer teardown()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := cache.Get(fmt.Sprintf("%s/%d.json", server.URL, i%5)); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if len(cache.pending) != 0 {
+		t.Errorf("expected finished Gets to be forgotten, got %d", len(cache.pending))
+	}
+}
+
+func TestSchemaCacheDoesntCacheMissingSchemas(t *testing.T) {
+	server, hits := newTestSchemaServer(t)
+	defer server.Close()
+	cache, teardown := newTestSchemaCache(t, time.Hour, 0)
+	defer teardown()
+
+	for i := 0; i < 2; i++ {
+		_, err := cache.Get(server.URL + "/missing.json")
+		if err == nil || err.Error() != "Could not read schema from HTTP, response status is 404 Not Found" {
+			t.Errorf("unexpected error %v", err)
+		}
+	}
+
+	if *hits != 2 {
+		t.Errorf("expected 2 requests, got %d", *hits)
+	}
+}
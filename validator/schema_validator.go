@@ -0,0 +1,490 @@
+package validator
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/instrumenta/kubeval/kubeval"
+	"github.com/xeipuuv/gojsonschema"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func init() {
+	// Without forcing these types the schemas fail to load. Registered once
+	// here rather than on every validation as gojsonschema's FormatCheckers
+	// isn't safe for concurrent use.
+	gojsonschema.FormatCheckers.Add("int64", kubeval.ValidFormat{})
+	gojsonschema.FormatCheckers.Add("byte", kubeval.ValidFormat{})
+	gojsonschema.FormatCheckers.Add("int32", kubeval.ValidFormat{})
+	gojsonschema.FormatCheckers.Add("int-or-string", kubeval.ValidFormat{})
+}
+
+// schemaLoader loads the schema found at a URL
+type schemaLoader interface {
+	Get(url string) ([]byte, error)
+}
+
+// defaultSchemaLoader loads schemas from local files or the network, using a
+// SchemaCache for the latter if one is configured
+type defaultSchemaLoader struct {
+	cache *SchemaCache
+}
+
+func (l *defaultSchemaLoader) Get(schemaURL string) ([]byte, error) {
+	if strings.HasPrefix(schemaURL, "file://") {
+		u, err := url.Parse(schemaURL)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.ReadFile(u.Path)
+	}
+	if l.cache != nil {
+		return l.cache.Get(schemaURL)
+	}
+	return fetchSchema(http.DefaultTransport, schemaURL)
+}
+
+// compiledSchemas caches the schemas compiled for each URL, as every resource
+// validated against the same schema would otherwise compile it again
+type compiledSchemas struct {
+	mu      sync.Mutex
+	schemas map[string]*compiledSchema
+}
+
+// compiledSchema is a schema compiled from its source, or the error which
+// prevented it from being loaded or compiled
+type compiledSchema struct {
+	source gojsonschema.JSONLoader
+	schema *gojsonschema.Schema
+	err    error
+}
+
+func newCompiledSchemas() *compiledSchemas {
+	return &compiledSchemas{schemas: make(map[string]*compiledSchema)}
+}
+
+// get returns the schema compiled for key, loading and compiling it first if
+// it hasn't been already
+func (s *compiledSchemas) get(key string, load func() (gojsonschema.JSONLoader, error)) *compiledSchema {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if compiled, ok := s.schemas[key]; ok {
+		return compiled
+	}
+	compiled := &compiledSchema{}
+	compiled.source, compiled.err = load()
+	if compiled.err == nil {
+		compiled.schema, compiled.err = gojsonschema.NewSchema(compiled.source)
+	}
+	s.schemas[key] = compiled
+	return compiled
+}
+
+// schemaValidator validates Kubernetes YAML like kubeval, but carries its
+// options with it rather than relying on kubeval's package globals so that
+// concurrent validations can't interfere with one another.
+type schemaValidator struct {
+	SchemaLocation string
+	Version        string
+	Strict         bool
+	OpenShift      bool
+
+	// IgnoreMissingSchemas reports resources without schemas as such rather
+	// than as errors
+	IgnoreMissingSchemas bool
+	SkipKinds            []string
+	OnlyKinds            []string
+
+	loader   schemaLoader
+	crds     *crdRegistry
+	compiled *compiledSchemas
+}
+
+// validationResult contains the details from validating a single Kubernetes
+// resource
+type validationResult struct {
+	FileName   string
+	Kind       string
+	APIVersion string
+	Name       string
+	Namespace  string
+	Errors     []gojsonschema.ResultError
+
+	// Document is the index of the document containing the resource
+	Document int
+	// Path is the JSON pointer of the resource within its document, which is
+	// set for the items of a List
+	Path string
+
+	// Err is set if the resource couldn't be validated
+	Err error
+
+	// Schema is the schema the resource was validated against
+	Schema gojsonschema.JSONLoader
+
+	// CustomResource is true when the resource was validated against the
+	// schema of a CustomResourceDefinition
+	CustomResource bool
+
+	// Skipped is true when the resource's kind was excluded from validation
+	Skipped bool
+
+	// MissingSchema is the URL of the schema which couldn't be found when
+	// missing schemas are ignored
+	MissingSchema string
+}
+
+func newSchemaValidator(schemaLocation string, schema *KubeValidatorConfigSchema, loader schemaLoader, crds *crdRegistry) *schemaValidator {
+	if loader == nil {
+		loader = &defaultSchemaLoader{}
+	}
+	version := schema.Version
+	if version == "" {
+		version = "master"
+	}
+	return &schemaValidator{
+		SchemaLocation:       schemaLocation,
+		Version:              version,
+		Strict:               schema.strict(),
+		OpenShift:            schema.ConfigType == "openshift",
+		IgnoreMissingSchemas: schema.IgnoreMissingSchemas,
+		SkipKinds:            schema.SkipKinds,
+		OnlyKinds:            schema.OnlyKinds,
+		loader:               loader,
+		crds:                 crds,
+		compiled:             newCompiledSchemas(),
+	}
+}
+
+// Validate a Kubernetes YAML or JSON file, parsing out individual resources
+// and validating each of them against the relevant schema
+func (v *schemaValidator) Validate(config []byte, fileName string) ([]validationResult, error) {
+	results := make([]validationResult, 0)
+
+	if len(config) == 0 {
+		results = append(results, validationResult{FileName: fileName})
+		return results, nil
+	}
+
+	var errs *multierror.Error
+	for i, element := range splitDocuments(config) {
+		if len(element) > 0 {
+			documentResults, err := v.validateDocument(element, fileName)
+			for _, result := range documentResults {
+				result.Document = i
+				results = append(results, result)
+			}
+			if err != nil {
+				errs = multierror.Append(errs, err)
+			}
+		} else {
+			results = append(results, validationResult{FileName: fileName, Document: i})
+		}
+	}
+	return results, errs.ErrorOrNil()
+}
+
+// validateDocument validates the resource in a document, or each of the items
+// of a List, against the relevant schema
+func (v *schemaValidator) validateDocument(data []byte, fileName string) ([]validationResult, error) {
+	var spec interface{}
+	err := yaml.Unmarshal(data, &spec)
+	if err != nil {
+		// Parse errors are reported once per Candidate rather than for each
+		// of its schemas, so they aren't returned
+		return []validationResult{{FileName: fileName, Err: newParseError(data, err)}}, nil
+	}
+
+	cast, _ := convertToStringKeys(spec).(map[string]interface{})
+	if len(cast) == 0 {
+		return []validationResult{{FileName: fileName}}, nil
+	}
+
+	var results []validationResult
+	var errs *multierror.Error
+	for _, item := range expandList(cast) {
+		if item.err != nil {
+			results = append(results, validationResult{FileName: fileName, Path: item.pointer, Err: item.err})
+			errs = multierror.Append(errs, item.err)
+			continue
+		}
+		result, err := v.validateResource(item.body, fileName)
+		result.Path = item.pointer
+		result.Err = err
+		results = append(results, result)
+		if err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+	// Empty Lists don't contain any resources
+	if len(results) == 0 {
+		results = append(results, validationResult{FileName: fileName})
+	}
+	return results, errs.ErrorOrNil()
+}
+
+// validateResource validates a single Kubernetes resource against the
+// relevant schema, detecting the type of resource automatically
+func (v *schemaValidator) validateResource(cast map[string]interface{}, fileName string) (validationResult, error) {
+	result := validationResult{FileName: fileName}
+	if len(cast) == 0 {
+		return result, nil
+	}
+
+	kind, err := stringField(cast, "kind")
+	if err != nil {
+		return result, err
+	}
+	result.Kind = kind
+
+	apiVersion, err := stringField(cast, "apiVersion")
+	if err != nil {
+		return result, err
+	}
+	result.APIVersion = apiVersion
+
+	if metadata, ok := cast["metadata"].(map[string]interface{}); ok {
+		result.Name, _ = metadata["name"].(string)
+		result.Namespace, _ = metadata["namespace"].(string)
+	}
+
+	if v.skipKind(kind) {
+		result.Skipped = true
+		return result, nil
+	}
+
+	var compiled *compiledSchema
+	if crdSchema, ok := v.crds.schemaFor(apiVersion, kind, v.Strict); ok {
+		result.CustomResource = true
+		compiled = v.compiled.get(fmt.Sprintf("crd:%s/%s:%t", apiVersion, kind, v.Strict), func() (gojsonschema.JSONLoader, error) {
+			return gojsonschema.NewGoLoader(crdSchema), nil
+		})
+		if compiled.err != nil {
+			return result, fmt.Errorf("Problem loading schema for %s from its CustomResourceDefinition: %s", kind, compiled.err)
+		}
+	} else {
+		schemaURL, err := v.schemaURL(kind, apiVersion)
+		if err != nil {
+			return result, fmt.Errorf("Problem finding schema for %s: %s", kind, err)
+		}
+		compiled = v.compiled.get(schemaURL, func() (gojsonschema.JSONLoader, error) {
+			schemaBytes, err := v.loader.Get(schemaURL)
+			if err != nil {
+				return nil, err
+			}
+			return gojsonschema.NewBytesLoader(schemaBytes), nil
+		})
+		if compiled.err != nil && v.IgnoreMissingSchemas && isMissingSchema(compiled.err) {
+			result.MissingSchema = schemaURL
+			return result, nil
+		}
+		if compiled.err != nil {
+			return result, fmt.Errorf("Problem loading schema %s: %s", schemaSource(schemaURL), compiled.err)
+		}
+	}
+
+	result.Schema = compiled.source
+	results, err := compiled.schema.Validate(gojsonschema.NewGoLoader(cast))
+	if err != nil {
+		return result, fmt.Errorf("Problem validating %s against its schema: %s", kind, err)
+	}
+	if !results.Valid() {
+		result.Errors = results.Errors()
+	}
+	return result, nil
+}
+
+// skipKind determines whether or not resources of kind should be validated
+func (v *schemaValidator) skipKind(kind string) bool {
+	for _, skipKind := range v.SkipKinds {
+		if skipKind == kind {
+			return true
+		}
+	}
+	if len(v.OnlyKinds) == 0 {
+		return false
+	}
+	for _, onlyKind := range v.OnlyKinds {
+		if onlyKind == kind {
+			return false
+		}
+	}
+	return true
+}
+
+// schemaNamePart matches the kinds and the parts of apiVersions which may be
+// used to build the URL of a schema
+var schemaNamePart = regexp.MustCompile(`^[A-Za-z0-9.-]+$`)
+
+// schemaURL returns the URL of the schema for a kind and apiVersion. Both come
+// from the resource being validated, so anything which could lead the URL
+// outside of the schemas is refused.
+func (v *schemaValidator) schemaURL(kind string, apiVersion string) (string, error) {
+	if !schemaNamePart.MatchString(kind) {
+		return "", fmt.Errorf("%q isn't a valid kind", kind)
+	}
+	groupParts := strings.Split(apiVersion, "/")
+	for _, part := range groupParts {
+		if len(groupParts) > 2 || !schemaNamePart.MatchString(part) {
+			return "", fmt.Errorf("%q isn't a valid apiVersion", apiVersion)
+		}
+	}
+
+	// Most of the directories which store the schemas are prefixed with a v
+	// so as to match the tagging in the Kubernetes repository, apart from
+	// master.
+	normalisedVersion := v.Version
+	if normalisedVersion != "master" {
+		normalisedVersion = "v" + normalisedVersion
+	}
+
+	baseURL := v.SchemaLocation
+	if baseURL == "" {
+		if v.OpenShift {
+			baseURL = kubeval.OpenShiftSchemaLocation
+		} else {
+			baseURL = kubeval.DefaultSchemaLocation
+		}
+	}
+
+	var strictSuffix string
+	if v.Strict {
+		strictSuffix = "-strict"
+	}
+
+	var kindSuffix string
+	versionParts := strings.Split(groupParts[0], ".")
+	if !v.OpenShift {
+		if len(groupParts) == 1 {
+			kindSuffix = "-" + strings.ToLower(versionParts[0])
+		} else {
+			kindSuffix = fmt.Sprintf("-%s-%s", strings.ToLower(versionParts[0]), strings.ToLower(groupParts[1]))
+		}
+	}
+
+	schemaURL := fmt.Sprintf("%s/%s-standalone%s/%s%s.json", baseURL, normalisedVersion, strictSuffix, strings.ToLower(kind), kindSuffix)
+	if strings.HasPrefix(baseURL, "file://") {
+		base, err := url.Parse(baseURL)
+		if err != nil {
+			return "", err
+		}
+		u, err := url.Parse(schemaURL)
+		if err != nil {
+			return "", err
+		}
+		if !strings.HasPrefix(path.Clean(u.Path), path.Clean(base.Path)+"/") {
+			return "", fmt.Errorf("The schema for %s %s would be outside of the schema directory", apiVersion, kind)
+		}
+	}
+	return schemaURL, nil
+}
+
+// fetchSchema loads a schema over HTTP
+func fetchSchema(transport http.RoundTripper, schemaURL string) ([]byte, error) {
+	client := &http.Client{Transport: transport}
+	resp, err := client.Get(schemaURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &schemaStatusError{
+			Status:     resp.Status,
+			StatusCode: resp.StatusCode,
+		}
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// schemaSource describes where the schema at a URL is loaded from
+func schemaSource(schemaURL string) string {
+	if strings.HasPrefix(schemaURL, "file://") {
+		return fmt.Sprintf("from the schema directory at %s", strings.TrimPrefix(schemaURL, "file://"))
+	}
+	return fmt.Sprintf("from the network at %s", schemaURL)
+}
+
+// isMissingSchema determines whether err indicates a schema doesn't exist
+func isMissingSchema(err error) bool {
+	if statusErr, ok := err.(*schemaStatusError); ok {
+		return statusErr.StatusCode == http.StatusNotFound
+	}
+	return os.IsNotExist(err)
+}
+
+func stringField(body map[string]interface{}, field string) (string, error) {
+	value, ok := body[field]
+	if !ok {
+		return "", fmt.Errorf("Missing a %s key", field)
+	}
+	if value == nil {
+		return "", fmt.Errorf("Missing a %s value", field)
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("Expected %s to be a string", field)
+	}
+	return s, nil
+}
+
+// splitDocuments splits a YAML file into its documents. JSON files contain a
+// single document.
+func splitDocuments(config []byte) [][]byte {
+	if isJSON(config) {
+		return [][]byte{config}
+	}
+	lineBreak := detectLineBreak(config)
+	return bytes.Split(config, []byte(lineBreak+"---"+lineBreak))
+}
+
+// documentStartLines returns the line of config on which each of the documents
+// returned by splitDocuments starts
+func documentStartLines(config []byte) []int {
+	var lines []int
+	line := 1
+	for _, document := range splitDocuments(config) {
+		lines = append(lines, line)
+		// Each document is followed by a separator on a line of its own
+		line += bytes.Count(document, []byte("\n")) + 2
+	}
+	return lines
+}
+
+// detectLineBreak returns the relevant platform specific line ending
+func detectLineBreak(haystack []byte) string {
+	windowsLineEnding := bytes.Contains(haystack, []byte("\r\n"))
+	if windowsLineEnding && runtime.GOOS == "windows" {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// convertToStringKeys recursively converts the map[interface{}]interface{}
+// values produced by yaml.v2 into map[string]interface{} values that can be
+// validated as JSON
+func convertToStringKeys(i interface{}) interface{} {
+	switch x := i.(type) {
+	case map[interface{}]interface{}:
+		m2 := map[string]interface{}{}
+		for k, v := range x {
+			m2[fmt.Sprintf("%v", k)] = convertToStringKeys(v)
+		}
+		return m2
+	case []interface{}:
+		for i, v := range x {
+			x[i] = convertToStringKeys(v)
+		}
+	}
+	return i
+}
@@ -0,0 +1,146 @@
+package validator
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSchemaURL(t *testing.T) {
+	tests := []struct {
+		validator  *schemaValidator
+		kind       string
+		apiVersion string
+		want       string
+	}{
+		{
+			newSchemaValidator("", &KubeValidatorConfigSchema{}, nil, nil),
+			"Deployment", "apps/v1",
+			"https://kubernetesjsonschema.dev/master-standalone-strict/deployment-apps-v1.json",
+		},
+		{
+			newSchemaValidator("file:///schemas", &KubeValidatorConfigSchema{Version: "1.13.0"}, nil, nil),
+			"Service", "v1",
+			"file:///schemas/v1.13.0-standalone-strict/service-v1.json",
+		},
+		{
+			newSchemaValidator("", &KubeValidatorConfigSchema{ConfigType: "openshift"}, nil, nil),
+			"DeploymentConfig", "apps.openshift.io/v1",
+			"https://raw.githubusercontent.com/garethr/openshift-json-schema/master/master-standalone-strict/deploymentconfig.json",
+		},
+	}
+	for _, test := range tests {
+		got, err := test.validator.schemaURL(test.kind, test.apiVersion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("expected %s, got %s", test.want, got)
+		}
+	}
+}
+
+func TestSchemaURLsStayInTheirLocation(t *testing.T) {
+	v := newSchemaValidator("file:///schemas", &KubeValidatorConfigSchema{Version: "1.13.0"}, nil, nil)
+	tests := []struct {
+		kind       string
+		apiVersion string
+	}{
+		{"../../../../etc/x", "v1"},
+		{"Deployment", "../../apps/v1"},
+		{"Deployment#", "apps/v1"},
+		{"Deployment", "apps/v1?x"},
+		{"Deploy%2fment", "apps/v1"},
+		{"Deployment", "a/b/v1"},
+		{"", "v1"},
+	}
+	for _, test := range tests {
+		if got, err := v.schemaURL(test.kind, test.apiVersion); err == nil {
+			t.Errorf("expected %s %s to be refused, got %s", test.apiVersion, test.kind, got)
+		}
+	}
+
+	v = newSchemaValidator("file:///schemas", &KubeValidatorConfigSchema{Version: "1/../../../etc"}, nil, nil)
+	if got, err := v.schemaURL("Service", "v1"); err == nil {
+		t.Errorf("expected a schema outside of the schema directory to be refused, got %s", got)
+	}
+}
+
+func TestConcurrentSchemaValidatorsAreIsolated(t *testing.T) {
+	schemaDir, _ := filepath.Abs("../fixtures/schemas")
+	schemaLocation := fmt.Sprintf("file://%s", filepath.ToSlash(schemaDir))
+	fileContents, _ := ioutil.ReadFile("../fixtures/invalid.yaml")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			v := newSchemaValidator(schemaLocation, &KubeValidatorConfigSchema{}, nil, nil)
+			results, err := v.Validate(fileContents, "invalid.yaml")
+			if err != nil {
+				t.Errorf("unexpected error validating against master: %v", err)
+				return
+			}
+			if len(results) != 1 || len(results[0].Errors) != 3 {
+				t.Errorf("expected 3 errors validating against master, got %+v", results)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			v := newSchemaValidator(schemaLocation, &KubeValidatorConfigSchema{Version: "1.99.1"}, nil, nil)
+			_, err := v.Validate(fileContents, "invalid.yaml")
+			if err == nil || !strings.Contains(err.Error(), "v1.99.1-standalone-strict/deployment-apps-v1.json") {
+				t.Errorf("expected an error loading the 1.99.1 schema, got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// countingSchemaLoader counts the schemas it loads
+type countingSchemaLoader struct {
+	defaultSchemaLoader
+	loads int
+}
+
+func (l *countingSchemaLoader) Get(schemaURL string) ([]byte, error) {
+	l.loads++
+	return l.defaultSchemaLoader.Get(schemaURL)
+}
+
+func TestSchemasAreCompiledOnce(t *testing.T) {
+	schemaDir, _ := filepath.Abs("../fixtures/schemas")
+	schemaLocation := fmt.Sprintf("file://%s", filepath.ToSlash(schemaDir))
+	fileContents, _ := ioutil.ReadFile("../fixtures/invalid.yaml")
+	loader := &countingSchemaLoader{}
+	compiled := newCompiledSchemas()
+
+	for i := 0; i < 3; i++ {
+		v := newSchemaValidator(schemaLocation, &KubeValidatorConfigSchema{}, loader, nil)
+		v.compiled = compiled
+		results, err := v.Validate(fileContents, "invalid.yaml")
+		if err != nil || len(results) != 1 || len(results[0].Errors) != 3 {
+			t.Fatalf("expected 3 errors, got %+v, %v", results, err)
+		}
+	}
+	if loader.loads != 1 {
+		t.Errorf("expected the schema to be loaded once, got %d", loader.loads)
+	}
+}
+
+func TestSchemaLoadErrorsDescribeTheirSource(t *testing.T) {
+	schemaDir, _ := filepath.Abs("../fixtures/schemas")
+	schemaLocation := fmt.Sprintf("file://%s", filepath.ToSlash(schemaDir))
+	fileContents, _ := ioutil.ReadFile("../fixtures/invalid.yaml")
+
+	v := newSchemaValidator(schemaLocation, &KubeValidatorConfigSchema{Version: "1.99.1"}, nil, nil)
+	_, err := v.Validate(fileContents, "invalid.yaml")
+	want := fmt.Sprintf("Problem loading schema from the schema directory at %s/v1.99.1-standalone-strict/deployment-apps-v1.json", filepath.ToSlash(schemaDir))
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("expected %q, got %v", want, err)
+	}
+}
@@ -17,6 +17,9 @@ type Server struct {
 	WebhookSecret   string
 	PrivateKeyFile  string
 	AppID           int
+	SchemaDir       string
+	SchemaCache     *SchemaCache
+	BlobCache       *BlobCache
 	GitHubAppClient *github.Client
 	tr              *http.RoundTripper
 	ctx             *context.Context
@@ -81,11 +84,14 @@ func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
 	}
 
 	c := &Context{
-		Event:     event,
-		Ctx:       s.ctx,
-		AppID:     &s.AppID,
-		Github:    github.NewClient(&http.Client{Transport: installationTransport}),
-		AppGitHub: s.GitHubAppClient,
+		Event:       event,
+		Ctx:         s.ctx,
+		AppID:       &s.AppID,
+		Github:      github.NewClient(&http.Client{Transport: installationTransport}),
+		AppGitHub:   s.GitHubAppClient,
+		SchemaDir:   s.SchemaDir,
+		SchemaCache: s.SchemaCache,
+		BlobCache:   s.BlobCache,
 	}
 
 	// TODO Return a 500 if we don't make it through the complete CheckRun cycle
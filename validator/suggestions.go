@@ -0,0 +1,170 @@
+package validator
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// maxSuggestions is the most suggestions offered for a single error
+const maxSuggestions = 3
+
+// suggestionsFor returns the properties or values a resource may have meant
+// to use instead of the one which caused e, found in the schema it was
+// validated against
+func suggestionsFor(schema gojsonschema.JSONLoader, e gojsonschema.ResultError) []string {
+	if schema == nil {
+		return nil
+	}
+
+	var target string
+	switch e.Type() {
+	case "additional_property_not_allowed":
+		target, _ = e.Details()["property"].(string)
+	case "enum":
+		target, _ = e.Value().(string)
+	default:
+		return nil
+	}
+	if target == "" {
+		return nil
+	}
+
+	document, err := schema.LoadJSON()
+	if err != nil {
+		return nil
+	}
+	subSchema, ok := schemaAt(document, contextSegments(e))
+	if !ok {
+		return nil
+	}
+
+	var options []string
+	if e.Type() == "enum" {
+		values, _ := subSchema["enum"].([]interface{})
+		for _, value := range values {
+			options = append(options, fmt.Sprintf("%v", value))
+		}
+	} else {
+		// The context of an additional property is the mapping containing it,
+		// so its siblings are the properties of the mapping's schema
+		properties, _ := subSchema["properties"].(map[string]interface{})
+		for property := range properties {
+			options = append(options, property)
+		}
+	}
+	return closestMatches(target, options)
+}
+
+// schemaAt returns the schema describing the value found by following
+// segments from the root of a resource
+func schemaAt(schema interface{}, segments []string) (map[string]interface{}, bool) {
+	current, ok := schema.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	for _, segment := range segments {
+		if properties, ok := current["properties"].(map[string]interface{}); ok {
+			if property, ok := properties[segment].(map[string]interface{}); ok {
+				current = property
+				continue
+			}
+		}
+		if _, err := strconv.Atoi(segment); err == nil {
+			if items, ok := current["items"].(map[string]interface{}); ok {
+				current = items
+				continue
+			}
+		}
+		if additional, ok := current["additionalProperties"].(map[string]interface{}); ok {
+			current = additional
+			continue
+		}
+		return nil, false
+	}
+	return current, true
+}
+
+// closestMatches returns the options closest to target by edit distance,
+// ignoring those too different from it to be a likely typo
+func closestMatches(target string, options []string) []string {
+	type match struct {
+		option   string
+		distance int
+	}
+
+	// Case is ignored as it's the most common difference, but breaks ties
+	threshold := len(target) / 3
+	if threshold < 1 {
+		threshold = 1
+	}
+	var matches []match
+	for _, option := range options {
+		if option == target {
+			continue
+		}
+		distance := levenshtein(strings.ToLower(target), strings.ToLower(option))
+		if distance > threshold {
+			continue
+		}
+		matches = append(matches, match{option, distance*2 + levenshtein(target, option)})
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+		return matches[i].option < matches[j].option
+	})
+
+	var closest []string
+	for i := 0; i < len(matches) && i < maxSuggestions; i++ {
+		closest = append(closest, matches[i].option)
+	}
+	return closest
+}
+
+// levenshtein returns the number of single character insertions, deletions
+// and substitutions needed to turn a into b
+func levenshtein(a string, b string) int {
+	s, t := []rune(a), []rune(b)
+	previous := make([]int, len(t)+1)
+	current := make([]int, len(t)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		current[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			current[j] = previous[j-1] + cost
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+			if current[j-1]+1 < current[j] {
+				current[j] = current[j-1] + 1
+			}
+		}
+		previous, current = current, previous
+	}
+	return previous[len(t)]
+}
+
+// suggestionString formats suggestions as a question, like
+// `did you mean "a" or "b"?`
+func suggestionString(suggestions []string) string {
+	quoted := make([]string, len(suggestions))
+	for i, suggestion := range suggestions {
+		quoted[i] = strconv.Quote(suggestion)
+	}
+	if len(quoted) == 1 {
+		return fmt.Sprintf("did you mean %s?", quoted[0])
+	}
+	return fmt.Sprintf("did you mean %s or %s?", strings.Join(quoted[:len(quoted)-1], ", "), quoted[len(quoted)-1])
+}
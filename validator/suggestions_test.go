@@ -0,0 +1,52 @@
+package validator
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		distance int
+	}{
+		{"", "", 0},
+		{"replicas", "replicas", 0},
+		{"replcas", "replicas", 1},
+		{"kitten", "sitting", 3},
+		{"", "abc", 3},
+	}
+	for _, test := range tests {
+		if distance := levenshtein(test.a, test.b); distance != test.distance {
+			t.Errorf("levenshtein(%q, %q) = %d, wanted %d", test.a, test.b, distance, test.distance)
+		}
+	}
+}
+
+func TestClosestMatches(t *testing.T) {
+	options := []string{"image", "imagePullPolicy", "imagePullSecrets", "name", "ports"}
+	tests := []struct {
+		target string
+		want   []string
+	}{
+		{"imagepullpolicy", []string{"imagePullPolicy"}},
+		{"imagePullSecret", []string{"imagePullSecrets"}},
+		{"nme", []string{"name"}},
+		{"extra", nil},
+	}
+	for _, test := range tests {
+		if diff := deep.Equal(closestMatches(test.target, options), test.want); diff != nil {
+			t.Errorf("%s: %v", test.target, diff)
+		}
+	}
+}
+
+func TestSuggestionString(t *testing.T) {
+	if s := suggestionString([]string{"a"}); s != `did you mean "a"?` {
+		t.Errorf("unexpected %q", s)
+	}
+	if s := suggestionString([]string{"a", "b", "c"}); s != `did you mean "a", "b" or "c"?` {
+		t.Errorf("unexpected %q", s)
+	}
+}